@@ -0,0 +1,101 @@
+// Package echoadapter provides gorilla/csrf as Echo middleware, so that CSRF
+// protection runs inside Echo's handler chain: route parameters remain
+// available to handlers, and requests that fail validation are passed to
+// Echo's HTTPErrorHandler as a 403 *echo.HTTPError.
+//
+//	e := echo.New()
+//	e.Use(echoadapter.Middleware([]byte("32-byte-long-auth-key")))
+//
+//	e.GET("/signup", func(c echo.Context) error {
+//		return c.Render(http.StatusOK, "signup", map[string]interface{}{
+//			csrf.TemplateTag: echoadapter.TemplateField(c),
+//		})
+//	})
+package echoadapter
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo/v4"
+)
+
+// ContextKey is the key the masked token is stored under in the echo.Context
+// (see echo.Context.Get), for templates rendered with the context's values.
+const ContextKey = "csrf"
+
+// callKey is the request context key for the call being served.
+type callKey struct{}
+
+// call carries an echo.Context through the CSRF middleware, and the error the
+// request resulted in back out of it.
+type call struct {
+	c    echo.Context
+	next echo.HandlerFunc
+	err  error
+}
+
+// Middleware returns Echo middleware that protects requests with a CSRF
+// middleware configured with authKey and opts, as csrf.Protect. An
+// ErrorHandler in opts is ignored: failures are returned to Echo instead.
+func Middleware(authKey []byte, opts ...csrf.Option) echo.MiddlewareFunc {
+	opts = append(opts[:len(opts):len(opts)], csrf.ErrorHandler(http.HandlerFunc(reject)))
+	protect := csrf.Protect(authKey, opts...)(http.HandlerFunc(serve))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cl := &call{c: c, next: next}
+			r := c.Request()
+
+			// The middleware is given the writer c.Response() wraps, which
+			// serve then has c.Response() write through.
+			protect.ServeHTTP(c.Response().Writer, r.WithContext(context.WithValue(r.Context(), callKey{}, cl)))
+			return cl.err
+		}
+	}
+}
+
+// serve calls the next Echo handler for a request that passed validation.
+func serve(w http.ResponseWriter, r *http.Request) {
+	cl := r.Context().Value(callKey{}).(*call)
+	cl.c.SetRequest(r)
+	cl.c.Set(ContextKey, csrf.Token(r))
+
+	// Write the response through w, so that options that wrap it (such as
+	// InjectForms and CacheControl) apply.
+	res := cl.c.Response()
+	uw := res.Writer
+	res.Writer = w
+	defer func() { res.Writer = uw }()
+
+	cl.err = cl.next(cl.c)
+}
+
+// reject returns a 403 (or the csrf.FailureStatus) to Echo for a request that
+// failed validation.
+func reject(w http.ResponseWriter, r *http.Request) {
+	cl := r.Context().Value(callKey{}).(*call)
+	cl.c.SetRequest(r)
+
+	reason := csrf.FailureReason(r)
+	status := csrf.FailureStatusOf(r)
+	he := echo.NewHTTPError(status, http.StatusText(status))
+	if reason != nil {
+		he = he.SetInternal(reason)
+	}
+	cl.err = he
+}
+
+// Token returns the masked CSRF token for the request being served by c, as
+// csrf.Token.
+func Token(c echo.Context) string {
+	return csrf.Token(c.Request())
+}
+
+// TemplateField returns a hidden input field carrying the CSRF token for the
+// request being served by c, as csrf.TemplateField.
+func TemplateField(c echo.Context) template.HTML {
+	return csrf.TemplateField(c.Request())
+}
@@ -0,0 +1,100 @@
+package echoadapter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo/v4"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware(testKey))
+
+	var reason error
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			reason = he.Internal
+		}
+		c.NoContent(http.StatusTeapot)
+	}
+
+	var token, id string
+	handler := func(c echo.Context) error {
+		token = Token(c)
+		id = c.Param("id")
+		if c.Get(ContextKey) != token {
+			t.Errorf("token not stored in the context: got %v want %v", c.Get(ContextKey), token)
+		}
+		return c.NoContent(http.StatusOK)
+	}
+	e.GET("/items/:id", handler)
+	e.POST("/items/:id", handler)
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/items/42", nil)
+	rr := httptest.NewRecorder()
+	e.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK || id != "42" {
+		t.Fatalf("handler not served with route params: got %v, %q", rr.Code, id)
+	}
+
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var echoTests = []struct {
+		token  string
+		code   int
+		reason error
+	}{
+		{token, http.StatusOK, nil},
+		{"", http.StatusTeapot, csrf.ErrNoToken},
+	}
+
+	for _, et := range echoTests {
+		r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/items/7", nil)
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", et.token)
+
+		rr := httptest.NewRecorder()
+		reason = nil
+		e.ServeHTTP(rr, r)
+
+		if rr.Code != et.code || reason != et.reason {
+			t.Fatalf("wrong result: got %v, %v want %v, %v", rr.Code, reason, et.code, et.reason)
+		}
+	}
+
+	if id != "7" {
+		t.Fatalf("route params lost: got %q want %q", id, "7")
+	}
+}
+
+// TestMiddlewareWriter checks that Echo handlers write through the CSRF
+// middleware, so that options that rewrite responses apply.
+func TestMiddlewareWriter(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware(testKey, csrf.InjectForms(true), csrf.CacheControl("no-store")))
+	e.GET("/signup", func(c echo.Context) error {
+		Token(c)
+		return c.HTML(http.StatusOK, `<form method="post"></form>`)
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/signup", nil)
+	rr := httptest.NewRecorder()
+	e.ServeHTTP(rr, r)
+
+	if !strings.Contains(rr.Body.String(), `name="gorilla.csrf.Token"`) {
+		t.Fatalf("token field not injected: got %q", rr.Body.String())
+	}
+
+	if got := rr.Header().Get("Cache-Control"); got != "no-store" {
+		t.Fatalf("wrong Cache-Control header: got %q want %q", got, "no-store")
+	}
+}
@@ -0,0 +1,198 @@
+// Package fasthttpadapter provides gorilla/csrf for fasthttp servers. It
+// works on fasthttp's RequestCtx directly, using csrf.Tokens for the token
+// format and checks, so requests aren't converted to net/http.
+//
+//	p, err := fasthttpadapter.New([]byte("32-byte-long-auth-key"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	fasthttp.ListenAndServe(":8000", p.Handler(func(ctx *fasthttp.RequestCtx) {
+//		fmt.Fprintf(ctx, "token: %s", fasthttpadapter.Token(ctx))
+//	}))
+//
+// The middleware supports the options listed for csrf.Tokens.
+package fasthttpadapter
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/csrf"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// ContextKey is the user value the masked token is stored under (see
+	// fasthttp.RequestCtx.UserValue).
+	ContextKey = "csrf"
+	// FailureKey is the user value the failure reason of a rejected request
+	// is stored under.
+	FailureKey = "csrf.failure"
+)
+
+// Protector is CSRF middleware for fasthttp.
+type Protector struct {
+	tokens *csrf.Tokens
+	cookie csrf.CookieConfig
+
+	// ErrorHandler serves requests that fail validation. It defaults to
+	// responding with the FailureStatus (403 unless set with the
+	// csrf.FailureStatus option) and the failure reason. It must not be
+	// changed once the Protector is in use.
+	ErrorHandler fasthttp.RequestHandler
+}
+
+// New returns a Protector configured with authKey and opts, as csrf.Protect.
+// An error is returned if opts include an option that csrf.Tokens don't
+// support.
+func New(authKey []byte, opts ...csrf.Option) (*Protector, error) {
+	tokens, err := csrf.NewTokens(authKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Protector{
+		tokens: tokens,
+		cookie: tokens.Cookie(),
+	}
+	p.ErrorHandler = p.unauthorizedHandler
+
+	return p, nil
+}
+
+// FailureStatus returns the status code that requests failing validation
+// should be rejected with, as set by the csrf.FailureStatus option.
+func (p *Protector) FailureStatus() int {
+	return p.tokens.FailureStatus()
+}
+
+// Handler returns middleware that calls next for requests that pass
+// validation, and the ErrorHandler for those that don't.
+func (p *Protector) Handler(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		reason, err := p.Check(ctx)
+		if err != nil {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusServiceUnavailable),
+				fasthttp.StatusServiceUnavailable)
+			return
+		}
+
+		if reason != nil {
+			p.ErrorHandler(ctx)
+			return
+		}
+
+		next(ctx)
+	}
+}
+
+// Check does the middleware's work on ctx without calling a handler, for use
+// by other frameworks built on fasthttp. It sets a new CSRF cookie on the
+// response if required, stores the masked token for Token and, for requests
+// with unsafe methods, validates the request.
+//
+// reason is non-nil if the request failed validation, and is also stored for
+// FailureReason. err reports an internal failure, such as a failure to read
+// random bytes.
+func (p *Protector) Check(ctx *fasthttp.RequestCtx) (reason error, err error) {
+	s, err := p.tokens.Session(string(ctx.Request.Header.Cookie(p.cookie.Name)))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Cookie != "" {
+		p.setCookie(ctx, s)
+	}
+
+	token, err := s.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.SetUserValue(ContextKey, token)
+
+	// Protect clients from caching the response.
+	ctx.Response.Header.Add("Vary", "Cookie")
+
+	if p.tokens.Safe(string(ctx.Method())) {
+		return nil, nil
+	}
+
+	scheme := "http"
+	if ctx.IsTLS() {
+		scheme = "https"
+	}
+
+	reason = p.tokens.CheckOrigin(scheme, string(ctx.Host()),
+		string(ctx.Request.Header.Peek("Origin")), string(ctx.Referer()))
+	if reason == nil {
+		reason = s.Verify(p.requestToken(ctx))
+	}
+
+	if reason != nil {
+		ctx.SetUserValue(FailureKey, reason)
+	}
+
+	return reason, nil
+}
+
+// requestToken returns the masked token sent with the request, from the
+// request header or else the form field.
+func (p *Protector) requestToken(ctx *fasthttp.RequestCtx) string {
+	if token := ctx.Request.Header.Peek(p.tokens.RequestHeader()); len(token) > 0 {
+		return string(token)
+	}
+
+	return string(ctx.FormValue(p.tokens.FieldName()))
+}
+
+// setCookie sets the new CSRF cookie of s on the response.
+func (p *Protector) setCookie(ctx *fasthttp.RequestCtx, s *csrf.Session) {
+	c := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(c)
+
+	c.SetKey(p.cookie.Name)
+	c.SetValue(s.Cookie)
+	c.SetPath(p.cookie.Path)
+	c.SetDomain(p.cookie.Domain)
+	c.SetSecure(p.cookie.Secure)
+	c.SetHTTPOnly(p.cookie.HttpOnly)
+
+	// As with the middleware, a MaxAge of 0 or less issues a session cookie.
+	if p.cookie.MaxAge > 0 {
+		c.SetMaxAge(p.cookie.MaxAge)
+		c.SetExpire(s.Expires())
+	}
+
+	switch p.cookie.SameSite {
+	case csrf.SameSiteLaxMode:
+		c.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+	case csrf.SameSiteStrictMode:
+		c.SetSameSite(fasthttp.CookieSameSiteStrictMode)
+	case csrf.SameSiteNoneMode:
+		c.SetSameSite(fasthttp.CookieSameSiteNoneMode)
+	}
+
+	ctx.Response.Header.SetCookie(c)
+}
+
+// Token returns the masked CSRF token for the request, as csrf.Token. An
+// empty token is returned if the middleware has not been applied.
+func Token(ctx *fasthttp.RequestCtx) string {
+	token, _ := ctx.UserValue(ContextKey).(string)
+	return token
+}
+
+// FailureReason returns the reason the request failed validation, as
+// csrf.FailureReason.
+func FailureReason(ctx *fasthttp.RequestCtx) error {
+	reason, _ := ctx.UserValue(FailureKey).(error)
+	return reason
+}
+
+// unauthorizedHandler responds with the FailureStatus and the failure reason.
+func (p *Protector) unauthorizedHandler(ctx *fasthttp.RequestCtx) {
+	status := p.FailureStatus()
+	ctx.Error(fmt.Sprintf("%s - %s", http.StatusText(status), FailureReason(ctx)), status)
+}
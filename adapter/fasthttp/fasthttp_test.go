@@ -0,0 +1,118 @@
+package fasthttpadapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/csrf"
+	"github.com/valyala/fasthttp"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+// serve runs handler on a request with method and headers, returning the
+// response status and any cookie set.
+func serve(handler fasthttp.RequestHandler, method string, headers map[string]string) (int, string) {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI("http://www.gorillatoolkit.org/")
+	for k, v := range headers {
+		ctx.Request.Header.Set(k, v)
+	}
+
+	handler(&ctx)
+	return ctx.Response.StatusCode(), string(ctx.Response.Header.PeekCookie("_gorilla_csrf"))
+}
+
+func TestHandler(t *testing.T) {
+	p, err := New(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var token string
+	var reason error
+	handler := p.Handler(func(ctx *fasthttp.RequestCtx) {
+		token = Token(ctx)
+	})
+	p.ErrorHandler = func(ctx *fasthttp.RequestCtx) {
+		reason = FailureReason(ctx)
+		p.unauthorizedHandler(ctx)
+	}
+
+	code, setCookie := serve(handler, "GET", nil)
+	if code != fasthttp.StatusOK || token == "" || setCookie == "" {
+		t.Fatalf("no token issued: got %v, %q, %q", code, token, setCookie)
+	}
+
+	var c fasthttp.Cookie
+	if err := c.Parse(setCookie); err != nil {
+		t.Fatal(err)
+	}
+	cookie := "_gorilla_csrf=" + string(c.Value())
+
+	var handlerTests = []struct {
+		name    string
+		headers map[string]string
+		code    int
+		reason  error
+	}{
+		{"valid token", map[string]string{"Cookie": cookie, "X-CSRF-Token": token},
+			fasthttp.StatusOK, nil},
+		{"no token", map[string]string{"Cookie": cookie},
+			fasthttp.StatusForbidden, csrf.ErrNoToken},
+		{"no cookie", map[string]string{"X-CSRF-Token": token},
+			fasthttp.StatusForbidden, csrf.ErrNoCookie},
+	}
+
+	for _, ht := range handlerTests {
+		reason = nil
+		code, _ := serve(handler, "POST", ht.headers)
+		if code != ht.code || reason != ht.reason {
+			t.Errorf("%s: got %v, %v want %v, %v", ht.name, code, reason, ht.code, ht.reason)
+		}
+	}
+}
+
+// TestFailureStatus checks that failed requests are rejected with the status
+// set by the FailureStatus option.
+func TestFailureStatus(t *testing.T) {
+	p, err := New(testKey, csrf.FailureStatus(419))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := p.Handler(func(ctx *fasthttp.RequestCtx) {})
+	if code, _ := serve(handler, "POST", nil); code != 419 {
+		t.Fatalf("wrong status code: got %v want %v", code, 419)
+	}
+}
+
+// TestInterop checks that a cookie and token issued by the net/http
+// middleware are accepted by the fasthttp middleware.
+func TestInterop(t *testing.T) {
+	var token string
+	h := csrf.Protect(testKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = csrf.Token(r)
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil))
+
+	p, err := New(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := false
+	handler := p.Handler(func(ctx *fasthttp.RequestCtx) { served = true })
+
+	code, _ := serve(handler, "POST", map[string]string{
+		"Cookie":       rr.Header().Get("Set-Cookie"),
+		"X-CSRF-Token": token,
+	})
+	if code != fasthttp.StatusOK || !served {
+		t.Fatalf("net/http token rejected: got %v", code)
+	}
+}
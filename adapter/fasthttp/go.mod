@@ -0,0 +1,19 @@
+module github.com/gorilla/csrf/adapter/fasthttp
+
+go 1.25.0
+
+require (
+	github.com/gorilla/csrf v1.6.2
+	github.com/valyala/fasthttp v1.74.0
+)
+
+require (
+	github.com/gorilla/securecookie v1.1.1 // indirect
+	github.com/klauspost/compress v1.20.0 // indirect
+	github.com/molecule-man/go-brrr v1.0.1 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	golang.org/x/tools v0.48.0 // indirect
+)
+
+replace github.com/gorilla/csrf => ../../
@@ -0,0 +1,58 @@
+// Package fiberadapter provides gorilla/csrf as Fiber middleware. It is a thin
+// wrapper around the fasthttp adapter, which Fiber runs on.
+//
+//	h, err := fiberadapter.New([]byte("32-byte-long-auth-key"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	app := fiber.New()
+//	app.Use(h)
+//	app.Get("/signup", func(c *fiber.Ctx) error {
+//		return c.Render("signup", fiber.Map{"token": fiberadapter.Token(c)})
+//	})
+//
+// Requests that fail validation are passed to the app's ErrorHandler as a
+// 403 *fiber.Error, or with the status set by the csrf.FailureStatus option.
+package fiberadapter
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gorilla/csrf"
+	fasthttpadapter "github.com/gorilla/csrf/adapter/fasthttp"
+)
+
+// New returns Fiber middleware configured with authKey and opts, as
+// csrf.Protect. An error is returned if opts include an option that
+// csrf.Tokens don't support.
+func New(authKey []byte, opts ...csrf.Option) (fiber.Handler, error) {
+	p, err := fasthttpadapter.New(authKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *fiber.Ctx) error {
+		reason, err := p.Check(c.Context())
+		if err != nil {
+			return fiber.ErrServiceUnavailable
+		}
+
+		if reason != nil {
+			return fiber.NewError(p.FailureStatus(), reason.Error())
+		}
+
+		return c.Next()
+	}, nil
+}
+
+// Token returns the masked CSRF token for the request, as csrf.Token. It is
+// also available as c.Locals("csrf").
+func Token(c *fiber.Ctx) string {
+	return fasthttpadapter.Token(c.Context())
+}
+
+// FailureReason returns the reason the request failed validation, as
+// csrf.FailureReason.
+func FailureReason(c *fiber.Ctx) error {
+	return fasthttpadapter.FailureReason(c.Context())
+}
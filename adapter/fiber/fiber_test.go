@@ -0,0 +1,75 @@
+package fiberadapter
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gorilla/csrf"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestNew(t *testing.T) {
+	h, err := New(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reason error
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			reason = FailureReason(c)
+			return fiber.DefaultErrorHandler(c, err)
+		},
+	})
+	app.Use(h)
+
+	var token, id string
+	handler := func(c *fiber.Ctx) error {
+		token = Token(c)
+		id = c.Params("id")
+		if c.Locals("csrf") != token {
+			t.Errorf("token not stored in the locals: got %v want %v", c.Locals("csrf"), token)
+		}
+		return nil
+	}
+	app.Get("/items/:id", handler)
+	app.Post("/items/:id", handler)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/items/42", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != fiber.StatusOK || id != "42" {
+		t.Fatalf("handler not served with route params: got %v, %q", resp.StatusCode, id)
+	}
+
+	cookie := resp.Header.Get("Set-Cookie")
+
+	var fiberTests = []struct {
+		token  string
+		code   int
+		reason error
+	}{
+		{token, fiber.StatusOK, nil},
+		{"", fiber.StatusForbidden, csrf.ErrNoToken},
+	}
+
+	for _, ft := range fiberTests {
+		r := httptest.NewRequest("POST", "/items/7", nil)
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", ft.token)
+
+		reason = nil
+		resp, err := app.Test(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != ft.code || reason != ft.reason {
+			t.Fatalf("wrong result: got %v, %v want %v, %v", resp.StatusCode, reason, ft.code, ft.reason)
+		}
+	}
+}
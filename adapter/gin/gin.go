@@ -0,0 +1,141 @@
+// Package ginadapter provides gorilla/csrf as Gin middleware, reusing the
+// core middleware's token handling and validation.
+//
+//	r := gin.Default()
+//	r.Use(ginadapter.Middleware([]byte("32-byte-long-auth-key")))
+//
+//	r.GET("/signup", func(c *gin.Context) {
+//		c.HTML(http.StatusOK, "signup.tmpl", gin.H{
+//			csrf.TemplateTag: ginadapter.TemplateField(c),
+//		})
+//	})
+//
+// Requests that fail validation are aborted with a 403 status (or the status
+// set by the csrf.FailureStatus option), and the failure reason is added to
+// c.Errors for error-handling middleware.
+package ginadapter
+
+import (
+	"bufio"
+	"context"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/csrf"
+)
+
+// ContextKey is the key the masked token is stored under in the gin.Context
+// (see gin.Context.Get).
+const ContextKey = "csrf"
+
+// callKey is the request context key for the call being served.
+type callKey struct{}
+
+// call carries a gin.Context through the CSRF middleware.
+type call struct {
+	c      *gin.Context
+	served bool
+}
+
+// Middleware returns Gin middleware that protects requests with a CSRF
+// middleware configured with authKey and opts, as csrf.Protect. An
+// ErrorHandler in opts is ignored: failed requests are aborted instead.
+func Middleware(authKey []byte, opts ...csrf.Option) gin.HandlerFunc {
+	opts = append(opts[:len(opts):len(opts)], csrf.ErrorHandler(http.HandlerFunc(reject)))
+	protect := csrf.Protect(authKey, opts...)(http.HandlerFunc(serve))
+
+	return func(c *gin.Context) {
+		cl := &call{c: c}
+		r := c.Request
+		protect.ServeHTTP(c.Writer, r.WithContext(context.WithValue(r.Context(), callKey{}, cl)))
+
+		// The middleware answered the request itself (e.g. with an internal
+		// error).
+		if !cl.served {
+			c.Abort()
+		}
+	}
+}
+
+// serve runs the rest of the Gin handler chain for a request that passed
+// validation.
+func serve(w http.ResponseWriter, r *http.Request) {
+	cl := r.Context().Value(callKey{}).(*call)
+	cl.served = true
+	cl.c.Request = r
+	cl.c.Set(ContextKey, csrf.Token(r))
+
+	// Write the response through w, so that options that wrap it (such as
+	// InjectForms and CacheControl) apply.
+	gw := cl.c.Writer
+	cl.c.Writer = &responseWriter{ResponseWriter: gw, w: w}
+	defer func() { cl.c.Writer = gw }()
+
+	cl.c.Next()
+}
+
+// responseWriter is a gin.ResponseWriter that writes through the
+// http.ResponseWriter the CSRF middleware serves the request with, which in
+// turn writes to the Gin writer it wraps.
+type responseWriter struct {
+	gin.ResponseWriter
+	w http.ResponseWriter
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.w.Header()
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	rw.w.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	return rw.w.Write(b)
+}
+
+func (rw *responseWriter) WriteString(s string) (int, error) {
+	return io.WriteString(rw.w, s)
+}
+
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rw.w.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return rw.ResponseWriter.Hijack()
+}
+
+// reject aborts the Gin handler chain for a request that failed validation.
+func reject(w http.ResponseWriter, r *http.Request) {
+	cl := r.Context().Value(callKey{}).(*call)
+	cl.served = true
+	cl.c.Request = r
+
+	reason := csrf.FailureReason(r)
+	if reason == nil {
+		reason = csrf.ErrBadToken
+	}
+	cl.c.AbortWithError(csrf.FailureStatusOf(r), reason)
+}
+
+// Token returns the masked CSRF token for the request being served by c, as
+// csrf.Token.
+func Token(c *gin.Context) string {
+	return csrf.Token(c.Request)
+}
+
+// TemplateField returns a hidden input field carrying the CSRF token for the
+// request being served by c, as csrf.TemplateField.
+func TemplateField(c *gin.Context) template.HTML {
+	return csrf.TemplateField(c.Request)
+}
@@ -0,0 +1,102 @@
+package ginadapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/csrf"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+
+	// Record the error added by a rejected request.
+	var reason error
+	e.Use(func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) > 0 {
+			reason = c.Errors.Last().Err
+		}
+	})
+	e.Use(Middleware(testKey))
+
+	var token, id string
+	handler := func(c *gin.Context) {
+		token = Token(c)
+		id = c.Param("id")
+		if v, _ := c.Get(ContextKey); v != token {
+			t.Errorf("token not stored in the context: got %v want %v", v, token)
+		}
+		c.Status(http.StatusOK)
+	}
+	e.GET("/items/:id", handler)
+	e.POST("/items/:id", handler)
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/items/42", nil)
+	rr := httptest.NewRecorder()
+	e.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK || id != "42" {
+		t.Fatalf("handler not served with route params: got %v, %q", rr.Code, id)
+	}
+
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var ginTests = []struct {
+		token  string
+		code   int
+		reason error
+	}{
+		{token, http.StatusOK, nil},
+		{"", http.StatusForbidden, csrf.ErrNoToken},
+	}
+
+	for _, gt := range ginTests {
+		r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/items/7", nil)
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", gt.token)
+
+		rr := httptest.NewRecorder()
+		reason = nil
+		id = ""
+		e.ServeHTTP(rr, r)
+
+		if rr.Code != gt.code || reason != gt.reason {
+			t.Fatalf("wrong result: got %v, %v want %v, %v", rr.Code, reason, gt.code, gt.reason)
+		}
+	}
+
+	if id != "" {
+		t.Fatalf("handler ran for a rejected request")
+	}
+}
+
+// TestMiddlewareWriter checks that the Gin handlers write through the CSRF
+// middleware, so that options that rewrite responses apply.
+func TestMiddlewareWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(Middleware(testKey, csrf.InjectForms(true), csrf.CacheControl("no-store")))
+	e.GET("/signup", func(c *gin.Context) {
+		Token(c)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<form method="post"></form>`))
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/signup", nil)
+	rr := httptest.NewRecorder()
+	e.ServeHTTP(rr, r)
+
+	if !strings.Contains(rr.Body.String(), `name="gorilla.csrf.Token"`) {
+		t.Fatalf("token field not injected: got %q", rr.Body.String())
+	}
+
+	if got := rr.Header().Get("Cache-Control"); got != "no-store" {
+		t.Fatalf("wrong Cache-Control header: got %q want %q", got, "no-store")
+	}
+}
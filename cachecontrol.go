@@ -0,0 +1,81 @@
+package csrf
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// tokenUse records whether a request's token was used (see Token) while
+// serving it.
+type tokenUse struct {
+	used bool
+}
+
+// markTokenUsed notes that r's token was used, if the middleware is tracking
+// token use for r.
+func markTokenUsed(r *http.Request) {
+	if val, err := contextGet(r, tokenUseKey); err == nil {
+		if tu, ok := val.(*tokenUse); ok {
+			tu.used = true
+		}
+	}
+}
+
+// cacheControlWriter is a http.ResponseWriter that sets a Cache-Control
+// header on responses whose request's token was used, unless the handler set
+// one itself.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	directive string
+	use       *tokenUse
+	written   bool
+}
+
+// setCacheControl sets the Cache-Control header, if required, before the
+// response headers are written.
+func (cw *cacheControlWriter) setCacheControl() {
+	if cw.written {
+		return
+	}
+	cw.written = true
+
+	h := cw.ResponseWriter.Header()
+	if cw.use.used && h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", cw.directive)
+	}
+}
+
+func (cw *cacheControlWriter) WriteHeader(code int) {
+	cw.setCacheControl()
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheControlWriter) Write(b []byte) (int, error) {
+	cw.setCacheControl()
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter does.
+func (cw *cacheControlWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		cw.setCacheControl()
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying ResponseWriter does.
+func (cw *cacheControlWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New(errorPrefix + "ResponseWriter does not implement http.Hijacker")
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (cw *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
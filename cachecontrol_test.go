@@ -0,0 +1,51 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Tests that Cache-Control is only set on responses that used the token and
+// didn't set their own policy.
+func TestCacheControl(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/form", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(TemplateField(r)))
+	})
+	s.HandleFunc("/cached", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Write([]byte(Token(r)))
+	})
+	s.HandleFunc("/static", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("static"))
+	})
+
+	var cacheTests = []struct {
+		opts []Option
+		path string
+		want string
+	}{
+		{[]Option{CacheControl("no-store")}, "/form", "no-store"},
+		{[]Option{CacheControl("no-store")}, "/cached", "private, max-age=60"},
+		{[]Option{CacheControl("no-store")}, "/static", ""},
+		{[]Option{CacheControl("no-store"), ResponseHeaders("X-CSRF-Token")}, "/static", "no-store"},
+		{nil, "/form", ""},
+	}
+
+	for _, ct := range cacheTests {
+		p := Protect(testKey, ct.opts...)(s)
+
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org"+ct.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if got := rr.Header().Get("Cache-Control"); got != ct.want {
+			t.Fatalf("%s: wrong Cache-Control header: got %q want %q", ct.path, got, ct.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package csrf
+
+import (
+	"net/http"
+)
+
+// channelBindingLabel is the exporter label defined by RFC 9266 for the
+// tls-exporter channel binding type.
+const channelBindingLabel = "EXPORTER-Channel-Binding"
+
+// bindToken binds realToken to the TLS connection r arrived on, by deriving
+// a token from it and the connection's exported keying material. Requests that
+// were not made over TLS terminated by this process are left unbound.
+func (cs *csrf) bindToken(r *http.Request, realToken []byte) ([]byte, error) {
+	if !cs.opts.ChannelBinding || r.TLS == nil {
+		return realToken, nil
+	}
+
+	ekm, err := exportKeyingMaterial(r.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return deriveToken(realToken, ekm), nil
+}
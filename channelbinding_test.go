@@ -0,0 +1,70 @@
+//go:build go1.11
+// +build go1.11
+
+package csrf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests that bound tokens are accepted on the connection they were issued on,
+// and rejected on any other.
+func TestChannelBinding(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Token(r)))
+	})
+
+	srv := httptest.NewTLSServer(Protect(testKey, ChannelBinding(true))(s))
+	defer srv.Close()
+
+	// post issues a token and submits it, on a new connection if
+	// newConn is set.
+	post := func(client *http.Client, newConn bool) int {
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if newConn {
+			client.Transport.(*http.Transport).CloseIdleConnections()
+		}
+
+		req, err := http.NewRequest("POST", srv.URL, strings.NewReader(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range res.Cookies() {
+			req.AddCookie(c)
+		}
+		req.Header.Set("X-CSRF-Token", string(token))
+		req.Header.Set("Referer", srv.URL+"/")
+
+		res, err = client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	if code := post(srv.Client(), false); code != http.StatusOK {
+		t.Fatalf("bound token rejected on its own connection: got %v want %v",
+			code, http.StatusOK)
+	}
+
+	if code := post(srv.Client(), true); code != http.StatusForbidden {
+		t.Fatalf("bound token accepted on another connection: got %v want %v",
+			code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,66 @@
+package csrf
+
+import (
+	"net/http"
+	"time"
+)
+
+// Verdict is the outcome of a Classifier.
+type Verdict int
+
+const (
+	// Allow continues with CSRF processing as normal.
+	Allow Verdict = iota
+	// Tag continues with CSRF processing, but marks the request as suspected
+	// automation. Handlers can check the mark with Tagged.
+	Tag
+	// Tarpit delays the request by the TarpitDelay before CSRF processing
+	// continues, slowing down automated clients. The request is also tagged.
+	Tarpit
+	// Reject fails the request with ErrAutomated.
+	Reject
+)
+
+// defaultTarpitDelay is how long a Tarpit verdict delays a request by default.
+const defaultTarpitDelay = 3 * time.Second
+
+// Classifier inspects a request before the CSRF token is validated - e.g. for
+// signals of headless browsers or header combinations no real browser sends -
+// and returns a Verdict for it. Classifiers are attached with the Classify
+// option and are called for every request, including safe methods.
+type Classifier func(r *http.Request) Verdict
+
+// Tagged reports whether a Classifier tagged the request as suspected
+// automation.
+func Tagged(r *http.Request) bool {
+	if val, err := contextGet(r, taggedKey); err == nil {
+		if tagged, ok := val.(bool); ok {
+			return tagged
+		}
+	}
+
+	return false
+}
+
+// classify applies the configured Classifier to r. It returns the (possibly
+// tagged) request and false if the request was rejected and has been handled.
+func (cs *csrf) classify(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	switch cs.opts.Classifier(r) {
+	case Tag:
+		r = contextSave(r, taggedKey, true)
+	case Tarpit:
+		r = contextSave(r, taggedKey, true)
+
+		t := time.NewTimer(cs.opts.TarpitDelay)
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			t.Stop()
+		}
+	case Reject:
+		cs.fail(w, r, ErrAutomated)
+		return r, false
+	}
+
+	return r, true
+}
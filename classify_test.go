@@ -0,0 +1,70 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestClassify checks that each Verdict is applied before validation.
+func TestClassify(t *testing.T) {
+	classifier := func(r *http.Request) Verdict {
+		ua := r.UserAgent()
+		switch {
+		case strings.Contains(ua, "HeadlessChrome"):
+			return Reject
+		case strings.Contains(ua, "curl"):
+			return Tag
+		case strings.Contains(ua, "scraper"):
+			return Tarpit
+		}
+		return Allow
+	}
+
+	var tagged bool
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		tagged = Tagged(r)
+	})
+
+	delay := 20 * time.Millisecond
+	p := Protect(testKey, Classify(classifier), TarpitDelay(delay))(s)
+
+	var classifyTests = []struct {
+		ua     string
+		code   int
+		tagged bool
+	}{
+		{"Mozilla/5.0", http.StatusOK, false},
+		{"Mozilla/5.0 HeadlessChrome/120.0", http.StatusForbidden, false},
+		{"curl/8.0", http.StatusOK, true},
+		{"scraper/1.0", http.StatusOK, true},
+	}
+
+	for _, ct := range classifyTests {
+		tagged = false
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("User-Agent", ct.ua)
+
+		rr := httptest.NewRecorder()
+		start := time.Now()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != ct.code {
+			t.Fatalf("%s: got status %v want %v", ct.ua, rr.Code, ct.code)
+		}
+
+		if tagged != ct.tagged {
+			t.Fatalf("%s: got tagged %v want %v", ct.ua, tagged, ct.tagged)
+		}
+
+		if strings.Contains(ct.ua, "scraper") && time.Since(start) < delay {
+			t.Fatalf("%s: request was not tarpitted", ct.ua)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+)
+
+// Transport is an http.RoundTripper for Go clients of protected servers, such
+// as integration tests and other services. It remembers the token from each
+// host's responses and sends it with the unsafe requests that follow, so that
+// they pass validation. Use it in a client with a cookie jar, which keeps the
+// CSRF cookie the token was issued against (see NewClient).
+//
+// The server must hand out tokens in a response header (ResponseHeaders or
+// ReissueOnFailure) or a script-readable cookie (XSRFCookie); tokens fetched
+// another way can be given to the Transport with SetToken. Unsafe requests
+// that don't carry an Origin header get the origin they are made to, as a
+// browser would send for a same-origin request.
+type Transport struct {
+	// Base makes the requests. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Header is the header tokens are read from on responses and sent in on
+	// requests. The default is X-CSRF-Token.
+	Header string
+	// Cookie, if set, is the name of a cookie tokens are also read from,
+	// such as "XSRF-TOKEN" with the XSRFCookie option.
+	Cookie string
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient returns an http.Client with a cookie jar and a Transport that
+// makes requests with http.DefaultTransport.
+func NewClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar, Transport: &Transport{}}
+}
+
+// SetToken sets the token sent with unsafe requests to host (as in the URL,
+// including any port), e.g. one fetched from a TokenHandler.
+func (t *Transport) SetToken(host, token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tokens == nil {
+		t.tokens = make(map[string]string)
+	}
+	t.tokens[host] = token
+}
+
+// token returns the token for host, if one has been seen.
+func (t *Transport) token(host string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.tokens[host]
+}
+
+// header returns the name of the token header.
+func (t *Transport) header() string {
+	if t.Header != "" {
+		return t.Header
+	}
+
+	return headerName
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	name := t.header()
+	if !contains(safeMethods, req.Method) {
+		token := t.token(req.URL.Host)
+		setToken := token != "" && req.Header.Get(name) == ""
+		setOrigin := req.Header.Get("Origin") == ""
+
+		if setToken || setOrigin {
+			// RoundTrippers must not modify the request.
+			r := new(http.Request)
+			*r = *req
+			r.Header = make(http.Header, len(req.Header)+2)
+			for k, v := range req.Header {
+				r.Header[k] = v
+			}
+
+			if setToken {
+				r.Header.Set(name, token)
+			}
+			if setOrigin {
+				r.Header.Set("Origin", req.URL.Scheme+"://"+req.URL.Host)
+			}
+			req = r
+		}
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if token := resp.Header.Get(name); token != "" {
+		t.SetToken(req.URL.Host, token)
+	}
+	if t.Cookie != "" {
+		for _, c := range resp.Cookies() {
+			if c.Name == t.Cookie && c.Value != "" {
+				t.SetToken(req.URL.Host, c.Value)
+			}
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,93 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestTransport checks that a client using Transport passes validation with
+// each of the ways a server can hand out tokens.
+func TestTransport(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Token(r)
+	})
+
+	var transportTests = []struct {
+		name   string
+		opts   []Option
+		t      *Transport
+		status int
+	}{
+		{"response header", []Option{ResponseHeaders("X-CSRF-Token")}, &Transport{}, http.StatusOK},
+		{"xsrf cookie", []Option{XSRFCookie("", "")},
+			&Transport{Header: "X-XSRF-TOKEN", Cookie: "XSRF-TOKEN"}, http.StatusOK},
+		{"no token", nil, &Transport{}, http.StatusForbidden},
+	}
+
+	for _, tt := range transportTests {
+		srv := httptest.NewTLSServer(Protect(testKey, tt.opts...)(handler))
+
+		client := NewClient()
+		tt.t.Base = srv.Client().Transport
+		client.Transport = tt.t
+
+		resp, err := client.Get(srv.URL + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		resp, err = client.PostForm(srv.URL+"/", url.Values{"name": {"gorilla"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		srv.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: wrong status code: got %v want %v", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+// TestTransportReissue checks that a client recovers from a stale token when
+// the server reissues tokens on failure.
+func TestTransportReissue(t *testing.T) {
+	srv := httptest.NewTLSServer(Protect(testKey, ReissueOnFailure(""))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer srv.Close()
+
+	tr := &Transport{Base: srv.Client().Transport}
+	client := NewClient()
+	client.Transport = tr
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+	tr.SetToken(host, "stale")
+
+	for i, status := range []int{http.StatusForbidden, http.StatusOK} {
+		resp, err := client.Post(srv.URL+"/", "text/plain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Fatalf("request %d: wrong status code: got %v want %v", i, resp.StatusCode, status)
+		}
+	}
+
+	// The caller's request is left unmodified.
+	req, _ := http.NewRequest("POST", srv.URL+"/", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if req.Header.Get("X-CSRF-Token") != "" || req.Header.Get("Origin") != "" {
+		t.Fatalf("request modified: %v", req.Header)
+	}
+}
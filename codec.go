@@ -0,0 +1,234 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// codec authenticates and encodes the values stored in CSRF cookies.
+//
+// The default codec is backed by gorilla/securecookie. Builds for TinyGo,
+// which can't rely on the reflection securecookie's serializers need, use
+// hmacCodec instead. Both produce the same format, so cookies issued by one
+// are accepted by the other.
+type codec interface {
+	// Encode returns the authenticated, encoded form of value for the named
+	// cookie.
+	Encode(name string, value []byte) (string, error)
+	// Decode authenticates and decodes an encoded value for the named cookie.
+	// It returns ErrTokenExpired if the value is authentic but has expired.
+	Decode(name, value string) ([]byte, error)
+}
+
+// macPool reuses HMAC-SHA256 state for one key. hmac.New hashes the key into
+// the inner and outer pads, which would otherwise be repeated for every value.
+type macPool struct {
+	pool sync.Pool
+}
+
+// newMACPools returns a macPool for each of keys.
+func newMACPools(keys [][]byte) []*macPool {
+	pools := make([]*macPool, len(keys))
+	for i, key := range keys {
+		key := key
+		pools[i] = &macPool{}
+		pools[i].pool.New = func() interface{} {
+			return hmac.New(sha256.New, key)
+		}
+	}
+
+	return pools
+}
+
+// sum returns the MAC of the concatenation of msgs.
+func (p *macPool) sum(msgs ...[]byte) []byte {
+	h := p.pool.Get().(hash.Hash)
+	for _, msg := range msgs {
+		h.Write(msg)
+	}
+	mac := h.Sum(nil)
+
+	h.Reset()
+	p.pool.Put(h)
+	return mac
+}
+
+// Encoding identifies the format in which the CSRF cookie is authenticated and
+// encoded.
+type Encoding int
+
+const (
+	// SecureCookieEncoding is the format used by gorilla/securecookie. This
+	// is the default.
+	SecureCookieEncoding Encoding = iota
+	// CompactEncoding is a versioned HMAC-SHA256 format that is around a
+	// third shorter than SecureCookieEncoding.
+	CompactEncoding
+	// DoubleSubmitEncoding is a stateless signed double-submit format: the
+	// unpadded base64url encoding of the token followed by its HMAC-SHA256
+	// under the authentication key. Tokens can be validated with
+	// VerifyDoubleSubmit by anything that holds the key, such as an edge
+	// proxy. Cookies carry no timestamp, so they are only expired by the
+	// client (see MaxAge).
+	DoubleSubmitEncoding
+)
+
+// issuer is implemented by codecs that can report when a value was encoded.
+type issuer interface {
+	issued(name, value string) (time.Time, bool)
+}
+
+// issuedAt returns the timestamp of a value in securecookie's format, which is
+// the base64 encoding of "timestamp|value|mac". The value must already have
+// been authenticated.
+func issuedAt(value string) (time.Time, bool) {
+	b, err := base64.URLEncoding.DecodeString(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	parts := strings.SplitN(string(b), "|", 2)
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(ts, 0), true
+}
+
+// codecFor returns the codec to use for r: a codec backed by the Signer if one
+// is configured, the codec for the key ring returned by the KeyFunc if one is
+// configured, or else the codec for the key passed to Protect. Under
+// IsolatedScope the keys are first derived for r's host.
+func (cs *csrf) codecFor(r *http.Request) (codec, error) {
+	if cs.opts.Signer != nil {
+		sc := signerCodec{ctx: r.Context(), signer: cs.opts.Signer, maxAge: int64(cs.opts.MaxAge)}
+		if cs.opts.Scope == IsolatedScope {
+			sc.host = requestHost(r)
+		}
+
+		return sc, nil
+	}
+
+	if cs.opts.KeyFunc == nil && cs.opts.Scope != IsolatedScope {
+		return cs.sc, nil
+	}
+
+	keys, err := cs.keyRing(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var host string
+	if cs.opts.Scope == IsolatedScope {
+		host = requestHost(r)
+	}
+
+	return cs.codecs.get(host, keys, func() codec {
+		if cs.opts.Scope == IsolatedScope {
+			keys = hostKeys(r, keys)
+		}
+
+		return cs.newCodec(keys...)
+	}), nil
+}
+
+// graceCodecFor returns the codec for r's previous-token cookie (see
+// MigrateToken). Its values expire after graceAge whatever the CookieEncoding,
+// so that a client that keeps sending the cookie after it has been cleared
+// can't replay the previous token for longer.
+func (cs *csrf) graceCodecFor(r *http.Request) (codec, error) {
+	if cs.opts.Signer != nil {
+		sc := signerCodec{ctx: r.Context(), signer: cs.opts.Signer, maxAge: graceAge}
+		if cs.opts.Scope == IsolatedScope {
+			sc.host = requestHost(r)
+		}
+
+		return sc, nil
+	}
+
+	keys, err := cs.keyRing(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if cs.opts.Scope == IsolatedScope {
+		keys = hostKeys(r, keys)
+	}
+
+	return newCodec(graceAge, keys...), nil
+}
+
+// maxCachedCodecs is the number of codecs a codecCache holds before it is
+// cleared.
+const maxCachedCodecs = 1024
+
+// codecCache holds the codecs for the key rings returned by the KeyFunc (and
+// the hosts they are derived for under IsolatedScope), so that keys aren't
+// derived again, nor their codecs set up again, for every request.
+type codecCache struct {
+	mu     sync.Mutex
+	codecs map[string]codec
+}
+
+func newCodecCache() *codecCache {
+	return &codecCache{codecs: make(map[string]codec)}
+}
+
+// get returns the cached codec for host and keys, creating it with create if
+// there isn't one.
+func (cc *codecCache) get(host string, keys [][]byte, create func() codec) codec {
+	// Length-prefix each part, so that different key rings can't collide.
+	id := make([]byte, 0, 4*(len(keys)+1)+len(host)+len(keys)*tokenLength)
+	for _, part := range append([][]byte{[]byte(host)}, keys...) {
+		id = strconv.AppendInt(id, int64(len(part)), 10)
+		id = append(id, ':')
+		id = append(id, part...)
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if c, ok := cc.codecs[string(id)]; ok {
+		return c
+	}
+
+	if len(cc.codecs) >= maxCachedCodecs {
+		cc.codecs = make(map[string]codec)
+	}
+
+	c := create()
+	cc.codecs[string(id)] = c
+	return c
+}
+
+// newCodec returns a codec for the given keys in the configured
+// CookieEncoding.
+func (cs *csrf) newCodec(keys ...[]byte) codec {
+	switch cs.opts.Encoding {
+	case CompactEncoding:
+		return newCompactCodec(cs.opts.MaxAge, keys...)
+	case DoubleSubmitEncoding:
+		return newDoubleSubmitCodec(keys...)
+	}
+
+	return newCodec(cs.opts.MaxAge, keys...)
+}
+
+// keyRing returns the authentication keys for r: those returned by the
+// KeyFunc if one is configured, or else the key passed to Protect followed by
+// any PreviousKeys.
+func (cs *csrf) keyRing(r *http.Request) ([][]byte, error) {
+	if cs.opts.KeyFunc == nil {
+		return append([][]byte{cs.authKey}, cs.prevKeys...), nil
+	}
+
+	return cs.opts.KeyFunc(r)
+}
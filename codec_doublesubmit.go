@@ -0,0 +1,79 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+// doubleSubmitCodec is the codec for DoubleSubmitEncoding. It encodes values
+// as the unpadded base64url encoding of the value followed by its
+// HMAC-SHA256, with no timestamp or other framing, so that they can be
+// verified by anything that holds the key (see VerifyDoubleSubmit). Values are
+// encoded with the first key and decoded with any of the keys.
+type doubleSubmitCodec struct {
+	keys [][]byte
+	macs []*macPool
+}
+
+// newDoubleSubmitCodec returns a codec for the given keys.
+func newDoubleSubmitCodec(keys ...[]byte) doubleSubmitCodec {
+	return doubleSubmitCodec{keys: keys, macs: newMACPools(keys)}
+}
+
+func (dc doubleSubmitCodec) Encode(name string, value []byte) (string, error) {
+	if len(dc.keys) == 0 || len(dc.keys[0]) == 0 {
+		return "", errors.New(errorPrefix + "no authentication keys")
+	}
+
+	msg := make([]byte, 0, len(value)+sha256.Size)
+	msg = append(msg, value...)
+	msg = append(msg, dc.macs[0].sum(value)...)
+
+	return base64.RawURLEncoding.EncodeToString(msg), nil
+}
+
+func (dc doubleSubmitCodec) Decode(name, value string) ([]byte, error) {
+	if len(value) > maxCookieLength {
+		return nil, errors.New(errorPrefix + "cookie value too long")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "cookie value not valid base64")
+	}
+
+	if len(b) < sha256.Size {
+		return nil, errors.New(errorPrefix + "cookie value not valid")
+	}
+
+	token, mac := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	for i, key := range dc.keys {
+		if len(key) > 0 && hmac.Equal(mac, dc.macs[i].sum(token)) {
+			return token, nil
+		}
+	}
+
+	return nil, errors.New(errorPrefix + "cookie value not authentic")
+}
+
+// VerifyDoubleSubmit reports whether token - a masked token as returned by
+// Token - was issued against the value of a CSRF cookie in
+// DoubleSubmitEncoding, authenticated with one of keys. It lets layers that
+// don't run the middleware, such as an edge proxy, validate requests with
+// nothing but the key: no session state is needed.
+func VerifyDoubleSubmit(cookie, token string, keys ...[]byte) bool {
+	realToken, err := newDoubleSubmitCodec(keys...).Decode("", cookie)
+	if err != nil || len(realToken) != tokenLength {
+		return false
+	}
+
+	issued, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return false
+	}
+
+	return compareTokens(unmask(issued), realToken)
+}
@@ -0,0 +1,125 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxCookieLength is the longest encoded value hmacCodec will decode, matching
+// securecookie's default.
+const maxCookieLength = 4096
+
+// hmacCodec is a codec that produces the same HMAC-SHA256 authenticated
+// format as securecookie (with its JSON serializer), without relying on
+// reflection. Values are encoded with the first key and decoded with any of
+// the keys, allowing keys to be rotated.
+type hmacCodec struct {
+	keys   [][]byte
+	macs   []*macPool
+	maxAge int64
+}
+
+// newHMACCodec returns a codec for the given keys whose encoded values expire
+// after maxAge seconds (or never, if maxAge is 0).
+func newHMACCodec(maxAge int, keys ...[]byte) hmacCodec {
+	return hmacCodec{keys: keys, macs: newMACPools(keys), maxAge: int64(maxAge)}
+}
+
+// mac returns the MAC, under the i'th key, of the named cookie's timestamped,
+// encoded value.
+func (hc hmacCodec) mac(i int, name, ts, value string) []byte {
+	return hc.macs[i].sum([]byte(name + "|" + ts + "|" + value))
+}
+
+func (hc hmacCodec) Encode(name string, value []byte) (string, error) {
+	return hc.encodeAt(name, value, time.Now())
+}
+
+// encodeAt is Encode for a value encoded at time now.
+func (hc hmacCodec) encodeAt(name string, value []byte, now time.Time) (string, error) {
+	if len(hc.keys) == 0 || len(hc.keys[0]) == 0 {
+		return "", errors.New(errorPrefix + "no authentication keys")
+	}
+
+	// securecookie's JSON serializer encodes a []byte as a base64 string,
+	// followed by a newline.
+	serialized := "null\n"
+	if value != nil {
+		serialized = `"` + base64.StdEncoding.EncodeToString(value) + "\"\n"
+	}
+
+	encoded := base64.URLEncoding.EncodeToString([]byte(serialized))
+	ts := strconv.FormatInt(now.UTC().Unix(), 10)
+	mac := hc.mac(0, name, ts, encoded)
+
+	return base64.URLEncoding.EncodeToString(
+		[]byte(ts + "|" + encoded + "|" + string(mac))), nil
+}
+
+func (hc hmacCodec) Decode(name, value string) ([]byte, error) {
+	if len(value) > maxCookieLength {
+		return nil, errors.New(errorPrefix + "cookie value too long")
+	}
+
+	b, err := base64.URLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "cookie value not valid base64")
+	}
+
+	parts := strings.SplitN(string(b), "|", 3)
+	if len(parts) != 3 {
+		return nil, errors.New(errorPrefix + "cookie value not valid")
+	}
+
+	verified := false
+	for i, key := range hc.keys {
+		if len(key) > 0 && hmac.Equal([]byte(parts[2]), hc.mac(i, name, parts[0], parts[1])) {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, errors.New(errorPrefix + "cookie value not authentic")
+	}
+
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errors.New(errorPrefix + "cookie timestamp not valid")
+	}
+
+	if hc.maxAge != 0 && ts < time.Now().UTC().Unix()-hc.maxAge {
+		return nil, ErrTokenExpired
+	}
+
+	serialized, err := base64.URLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "cookie value not valid base64")
+	}
+
+	s := strings.TrimSpace(string(serialized))
+	if s == "null" {
+		return nil, nil
+	}
+
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return nil, errors.New(errorPrefix + "cookie value not valid")
+	}
+
+	return base64.StdEncoding.DecodeString(s[1 : len(s)-1])
+}
+
+// issued returns the time at which value was encoded, if it is a valid value
+// for the named cookie.
+func (hc hmacCodec) issued(name, value string) (time.Time, bool) {
+	if _, err := hc.Decode(name, value); err != nil {
+		return time.Time{}, false
+	}
+
+	return issuedAt(value)
+}
@@ -0,0 +1,114 @@
+//go:build !tinygo
+// +build !tinygo
+
+package csrf
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/pkg/errors"
+)
+
+// expiredCookieMsg is the message securecookie reports for a cookie that
+// authenticated correctly but is older than its MaxAge. securecookie does not
+// export this error, so we match on its message in order to report
+// ErrTokenExpired instead of a generic decoding failure.
+const expiredCookieMsg = "securecookie: expired timestamp"
+
+// newCodec returns a codec for the given keys whose encoded values expire
+// after maxAge seconds (or never, if maxAge is 0).
+func newCodec(maxAge int, keys ...[]byte) codec {
+	return newSecureCookieCodec(maxAge, keys...)
+}
+
+// secureCookies holds a securecookie instance for each key and MaxAge, so that
+// codecs with keys in common - such as those for successive KeyFunc key rings
+// - share them rather than each setting up their own.
+var secureCookies = struct {
+	sync.Mutex
+	m map[string]*securecookie.SecureCookie
+}{m: make(map[string]*securecookie.SecureCookie)}
+
+// secureCookie returns the securecookie instance for key and maxAge.
+func secureCookie(maxAge int, key []byte) *securecookie.SecureCookie {
+	id := strconv.Itoa(maxAge) + ":" + string(key)
+
+	secureCookies.Lock()
+	defer secureCookies.Unlock()
+
+	if s, ok := secureCookies.m[id]; ok {
+		return s
+	}
+
+	if len(secureCookies.m) >= maxCachedCodecs {
+		secureCookies.m = make(map[string]*securecookie.SecureCookie)
+	}
+
+	s := securecookie.New(key, nil)
+	// Use JSON serialization (faster than one-off gob encoding)
+	s.SetSerializer(securecookie.JSONEncoder{})
+	// Set the MaxAge of the underlying securecookie.
+	s.MaxAge(maxAge)
+
+	secureCookies.m[id] = s
+	return s
+}
+
+// secureCookieCodec is a codec backed by gorilla/securecookie. Values are
+// encoded with the first key and decoded with any of the keys, allowing keys
+// to be rotated.
+type secureCookieCodec []*securecookie.SecureCookie
+
+// newSecureCookieCodec returns a codec for the given keys whose encoded values
+// expire after maxAge seconds (or never, if maxAge is 0).
+func newSecureCookieCodec(maxAge int, keys ...[]byte) secureCookieCodec {
+	sc := make(secureCookieCodec, len(keys))
+	for i, key := range keys {
+		sc[i] = secureCookie(maxAge, key)
+	}
+
+	return sc
+}
+
+func (sc secureCookieCodec) Encode(name string, value []byte) (string, error) {
+	if len(sc) == 0 {
+		return "", errors.New(errorPrefix + "no authentication keys")
+	}
+
+	return sc[0].Encode(name, value)
+}
+
+func (sc secureCookieCodec) Decode(name, value string) ([]byte, error) {
+	if len(sc) == 0 {
+		return nil, errors.New(errorPrefix + "no authentication keys")
+	}
+
+	var err error
+	for _, c := range sc {
+		var token []byte
+		if err = c.Decode(name, value, &token); err == nil {
+			return token, nil
+		}
+
+		// The MAC has been verified by the time the timestamp is checked, so
+		// there's no point trying the remaining keys.
+		if err.Error() == expiredCookieMsg {
+			return nil, ErrTokenExpired
+		}
+	}
+
+	return nil, err
+}
+
+// issued returns the time at which value was encoded, if it is a valid value
+// for the named cookie.
+func (sc secureCookieCodec) issued(name, value string) (time.Time, bool) {
+	if _, err := sc.Decode(name, value); err != nil {
+		return time.Time{}, false
+	}
+
+	return issuedAt(value)
+}
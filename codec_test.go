@@ -0,0 +1,260 @@
+//go:build !tinygo
+// +build !tinygo
+
+package csrf
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+// Tests that values encoded by the securecookie and HMAC codecs can be
+// decoded by either, so that TinyGo builds interoperate with standard ones.
+func TestCodecCompatibility(t *testing.T) {
+	oldKey := []byte("old-key-0123456789abcdefghijklmn")
+	codecs := []codec{
+		newSecureCookieCodec(defaultAge, testKey, oldKey),
+		newHMACCodec(defaultAge, testKey, oldKey),
+		// Values encoded with a previous key are still accepted.
+		newSecureCookieCodec(defaultAge, oldKey),
+		newHMACCodec(defaultAge, oldKey),
+	}
+
+	token, err := generateRandomBytes(tokenLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, enc := range codecs {
+		encoded, err := enc.Encode(cookieName, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j, dec := range codecs[:2] {
+			decoded, err := dec.Decode(cookieName, encoded)
+			if err != nil {
+				t.Fatalf("codec %d failed to decode a value from codec %d: %v", j, i, err)
+			}
+
+			if !bytes.Equal(decoded, token) {
+				t.Fatalf("codec %d decoded the wrong value from codec %d: got %x want %x",
+					j, i, decoded, token)
+			}
+		}
+
+		if _, err := codecs[0].Decode("other", encoded); err == nil {
+			t.Fatalf("value from codec %d accepted for another cookie", i)
+		}
+	}
+}
+
+// Tests that the compact codec round-trips values, rejects tampered, foreign
+// and expired ones, and is smaller than the default encoding.
+func TestCompactCodec(t *testing.T) {
+	cc := newCompactCodec(defaultAge, testKey)
+
+	token, err := generateRandomBytes(tokenLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := cc.Encode(cookieName, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := cc.Decode(cookieName, encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decoded, token) {
+		t.Fatalf("compact codec decoded the wrong value: got %x want %x", decoded, token)
+	}
+
+	other, err := newSecureCookieCodec(defaultAge, testKey).Encode(cookieName, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(encoded) >= len(other) {
+		t.Fatalf("compact encoding is not smaller: got %d bytes want < %d", len(encoded), len(other))
+	}
+
+	b := []byte(encoded)
+	b[len(b)/2] ^= 1
+
+	var invalidTests = []struct {
+		name  string
+		codec codec
+		value string
+	}{
+		{"other", cc, encoded},
+		{cookieName, cc, string(b)},
+		{cookieName, newCompactCodec(defaultAge, []byte("some-other-key")), encoded},
+		{cookieName, cc, other},
+	}
+
+	for _, it := range invalidTests {
+		if _, err := it.codec.Decode(it.name, it.value); err == nil {
+			t.Fatalf("compact codec accepted an invalid value: %+v", it)
+		}
+	}
+
+	// Values older than the MaxAge are reported as expired.
+	cc = newCompactCodec(1, testKey)
+	encoded, err = cc.Encode(cookieName, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A negative MaxAge places the expiry in the future of any new value.
+	cc.maxAge = -2
+	if _, err := cc.Decode(cookieName, encoded); err != ErrTokenExpired {
+		t.Fatalf("expired value not reported: got %v want %v", err, ErrTokenExpired)
+	}
+}
+
+// Tests that tokens issued in DoubleSubmitEncoding are accepted by the
+// middleware, and can be verified with nothing but the key.
+func TestDoubleSubmitEncoding(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, CookieEncoding(DoubleSubmitEncoding))(s)
+
+	var token string
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	var cookie string
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == cookieName {
+			cookie = c.Value
+		}
+	}
+
+	otherKey := []byte("other-key-0123456789abcdefghijkl")
+	var verifyTests = []struct {
+		cookie string
+		token  string
+		keys   [][]byte
+		valid  bool
+	}{
+		{cookie, token, [][]byte{testKey}, true},
+		{cookie, token, [][]byte{otherKey, testKey}, true},
+		{cookie, token, [][]byte{otherKey}, false},
+		{cookie, "", [][]byte{testKey}, false},
+		{cookie[1:], token, [][]byte{testKey}, false},
+	}
+
+	for i, vt := range verifyTests {
+		if VerifyDoubleSubmit(vt.cookie, vt.token, vt.keys...) != vt.valid {
+			t.Fatalf("test %d: VerifyDoubleSubmit did not return %t", i, vt.valid)
+		}
+	}
+
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setCookie(rr, r)
+	r.Header.Set("X-CSRF-Token", token)
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("double-submit token rejected: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+// Tests that codecs for KeyFunc key rings and isolated hosts are reused
+// between requests, but not shared between key rings or hosts.
+func TestCodecCache(t *testing.T) {
+	otherKey := []byte("other-key-0123456789abcdefghijkl")
+	key := testKey
+	cs := parseOptions(nil, Scope(IsolatedScope), KeyFunc(func(r *http.Request) ([][]byte, error) {
+		return [][]byte{key}, nil
+	}))
+	cs.setup(testKey)
+
+	mac := func(host string) *securecookie.SecureCookie {
+		r := httptest.NewRequest("GET", "http://"+host+"/", nil)
+		c, err := cs.codecFor(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c.(secureCookieCodec)[0]
+	}
+
+	first := mac("a.example.com")
+	if mac("a.example.com") != first {
+		t.Fatal("codec not reused for the same host and keys")
+	}
+
+	if mac("b.example.com") == first {
+		t.Fatal("codec shared between hosts")
+	}
+
+	key = otherKey
+	if mac("a.example.com") == first {
+		t.Fatal("codec shared between key rings")
+	}
+}
+
+// Tests that securecookie instances are shared between codecs with the same
+// key and MaxAge, and only those.
+func TestSecureCookieCache(t *testing.T) {
+	otherKey := []byte("other-key-0123456789abcdefghijkl")
+	sc := newSecureCookieCodec(defaultAge, testKey, otherKey)
+
+	if newSecureCookieCodec(defaultAge, otherKey)[0] != sc[1] {
+		t.Fatal("securecookie not reused for the same key and MaxAge")
+	}
+
+	if newSecureCookieCodec(graceAge, testKey)[0] == sc[0] {
+		t.Fatal("securecookie shared between MaxAges")
+	}
+}
+
+// Tests that the HMAC state reused by the codecs gives the same MACs as fresh
+// state, including under concurrent use.
+func TestMACPool(t *testing.T) {
+	p := newMACPools([][]byte{testKey})[0]
+
+	h := hmac.New(sha256.New, testKey)
+	h.Write([]byte("name|value"))
+	want := h.Sum(nil)
+
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				if got := p.sum([]byte("name|"), []byte("value")); !hmac.Equal(got, want) {
+					t.Errorf("wrong MAC: got %x want %x", got, want)
+				}
+			}
+			done <- true
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+}
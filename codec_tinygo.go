@@ -0,0 +1,10 @@
+//go:build tinygo
+// +build tinygo
+
+package csrf
+
+// newCodec returns a codec for the given keys whose encoded values expire
+// after maxAge seconds (or never, if maxAge is 0).
+func newCodec(maxAge int, keys ...[]byte) codec {
+	return newHMACCodec(maxAge, keys...)
+}
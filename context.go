@@ -1,29 +1,40 @@
-// +build go1.7
-
 package csrf
 
 import (
 	"context"
 	"net/http"
 
+	"github.com/gorilla/csrf/internal/testhook"
 	"github.com/pkg/errors"
 )
 
-func contextGet(r *http.Request, key string) (interface{}, error) {
+func init() {
+	testhook.WithToken = func(r *http.Request, token, field string) *http.Request {
+		r = contextSave(r, tokenKey, token)
+		return contextSave(r, formKey, field)
+	}
+}
+
+// contextKey is the type of the keys under which the middleware stores
+// request-scoped values in the request context. Being unexported, it can't
+// collide with keys defined by other packages.
+type contextKey string
+
+// errNoContextValue is returned by contextGet for a missing key. Helpers look
+// up keys that are often missing on every request, so it is allocated once.
+var errNoContextValue = errors.New("no value exists in the context for the key")
+
+func contextGet(r *http.Request, key contextKey) (interface{}, error) {
 	val := r.Context().Value(key)
 	if val == nil {
-		return nil, errors.Errorf("no value exists in the context for key %q", key)
+		return nil, errNoContextValue
 	}
 
 	return val, nil
 }
 
-func contextSave(r *http.Request, key string, val interface{}) *http.Request {
+func contextSave(r *http.Request, key contextKey, val interface{}) *http.Request {
 	ctx := r.Context()
 	ctx = context.WithValue(ctx, key, val)
 	return r.WithContext(ctx)
 }
-
-func contextClear(r *http.Request) {
-	// no-op for go1.7+
-}
@@ -0,0 +1,152 @@
+package csrf
+
+import (
+	"net/http"
+	"time"
+)
+
+// SameSiteMode is the value of the SameSite attribute of the CSRF cookie.
+type SameSiteMode int
+
+const (
+	// SameSiteDefaultMode omits the SameSite attribute, leaving the browser
+	// to apply its default.
+	SameSiteDefaultMode SameSiteMode = iota
+	// SameSiteLaxMode sets "SameSite=Lax".
+	SameSiteLaxMode
+	// SameSiteStrictMode sets "SameSite=Strict".
+	SameSiteStrictMode
+	// SameSiteNoneMode sets "SameSite=None". Browsers ignore it unless the
+	// cookie is also Secure.
+	SameSiteNoneMode
+)
+
+// String returns the attribute value for s, or "" for SameSiteDefaultMode.
+func (s SameSiteMode) String() string {
+	switch s {
+	case SameSiteLaxMode:
+		return "Lax"
+	case SameSiteStrictMode:
+		return "Strict"
+	case SameSiteNoneMode:
+		return "None"
+	}
+
+	return ""
+}
+
+// CookieAttributes overrides the attributes of the CSRF cookie issued while
+// serving a single request. Zero values leave the configured attributes
+// unchanged.
+type CookieAttributes struct {
+	// MaxAge overrides the lifetime of the cookie in seconds. A negative value
+	// issues a session cookie. Note that tokens are still only accepted for
+	// the MaxAge configured on the middleware, so this should only be used to
+	// shorten the lifetime of the cookie.
+	MaxAge int
+	// SameSite sets the SameSite attribute of the cookie.
+	SameSite SameSiteMode
+	// Partitioned sets the Partitioned attribute of the cookie (CHIPS), which
+	// is needed for the cookie to be sent to pages embedded in a third-party
+	// iframe. Browsers ignore it unless the cookie is also Secure.
+	Partitioned bool
+	// Domain overrides the Domain attribute of the cookie - e.g. to scope it
+	// to the current tenant's apex domain. It is ignored for __Host- cookies
+	// (see WithCookiePrefix) and under IsolatedScope.
+	Domain string
+	// Path overrides the Path attribute of the cookie. It is ignored for
+	// __Host- cookies.
+	Path string
+}
+
+// WithCookieAttributes overrides the attributes of the CSRF cookie for a
+// single request - e.g. to issue a partitioned, SameSite=None cookie on the
+// handful of routes rendered inside a payment provider's iframe. This must be
+// called before the CSRF middleware.
+func WithCookieAttributes(r *http.Request, attrs CookieAttributes) *http.Request {
+	return contextSave(r, attrsKey, attrs)
+}
+
+// cookieAttributes returns the cookie attribute overrides for r, if any.
+func cookieAttributes(r *http.Request) CookieAttributes {
+	if r != nil {
+		if val, err := contextGet(r, attrsKey); err == nil {
+			if attrs, ok := val.(CookieAttributes); ok {
+				return attrs
+			}
+		}
+	}
+
+	return CookieAttributes{}
+}
+
+// scopeCookies saves the cookie Domain and Path returned by the DomainFunc and
+// PathFunc for r as overrides, unless WithCookieAttributes already set them.
+// Overrides that browsers would reject on a __Host- cookie, or that would
+// share the cookie across hosts under IsolatedScope, are dropped.
+func (cs *csrf) scopeCookies(r *http.Request) *http.Request {
+	attrs := cookieAttributes(r)
+	hostOnly := cs.opts.CookiePrefix == HostPrefix
+
+	if hostOnly || cs.opts.Scope == IsolatedScope {
+		attrs.Domain = ""
+	} else if cs.opts.DomainFunc != nil && attrs.Domain == "" {
+		attrs.Domain = cs.opts.DomainFunc(r)
+	}
+
+	if hostOnly {
+		attrs.Path = ""
+	} else if cs.opts.PathFunc != nil && attrs.Path == "" {
+		attrs.Path = cs.opts.PathFunc(r)
+	}
+
+	return contextSave(r, attrsKey, attrs)
+}
+
+// scopeCookie applies the Domain and Path overrides for r to cookie.
+func scopeCookie(r *http.Request, cookie *http.Cookie) {
+	attrs := cookieAttributes(r)
+	if attrs.Domain != "" {
+		cookie.Domain = attrs.Domain
+	}
+
+	if attrs.Path != "" {
+		cookie.Path = attrs.Path
+	}
+}
+
+// writeCookie adds a Set-Cookie header for cookie to w, with any attribute
+// overrides for r applied. The SameSite and Partitioned attributes are
+// appended by hand so that they can be set on any version of Go.
+func writeCookie(w http.ResponseWriter, r *http.Request, cookie *http.Cookie, sameSite SameSiteMode) {
+	scopeCookie(r, cookie)
+
+	attrs := cookieAttributes(r)
+	if attrs.SameSite != SameSiteDefaultMode {
+		sameSite = attrs.SameSite
+	}
+
+	switch {
+	case attrs.MaxAge < 0:
+		cookie.MaxAge = 0
+		cookie.Expires = time.Time{}
+	case attrs.MaxAge > 0:
+		cookie.MaxAge = attrs.MaxAge
+		cookie.Expires = time.Now().Add(time.Duration(attrs.MaxAge) * time.Second)
+	}
+
+	v := cookie.String()
+	if v == "" {
+		return
+	}
+
+	if s := sameSite.String(); s != "" {
+		v += "; SameSite=" + s
+	}
+
+	if attrs.Partitioned {
+		v += "; Partitioned"
+	}
+
+	w.Header().Add("Set-Cookie", v)
+}
@@ -0,0 +1,202 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests that per-request overrides are applied to the issued cookie.
+func TestCookieAttributes(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+	p := Protect(testKey, MaxAge(3600))(s)
+
+	var attrTests = []struct {
+		attrs CookieAttributes
+		want  []string
+		not   []string
+	}{
+		{CookieAttributes{}, []string{"Max-Age=3600"}, []string{"SameSite", "Partitioned"}},
+		{CookieAttributes{MaxAge: 60}, []string{"Max-Age=60"}, nil},
+		{CookieAttributes{MaxAge: -1}, nil, []string{"Max-Age", "Expires"}},
+		{
+			CookieAttributes{SameSite: SameSiteNoneMode, Partitioned: true},
+			[]string{"SameSite=None", "; Partitioned"},
+			nil,
+		},
+		{CookieAttributes{SameSite: SameSiteStrictMode}, []string{"SameSite=Strict"}, nil},
+	}
+
+	for _, at := range attrTests {
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, WithCookieAttributes(r, at.attrs))
+
+		cookie := rr.Header().Get("Set-Cookie")
+		for _, want := range at.want {
+			if !strings.Contains(cookie, want) {
+				t.Errorf("%+v: cookie %q does not contain %q", at.attrs, cookie, want)
+			}
+		}
+
+		for _, not := range at.not {
+			if strings.Contains(cookie, not) {
+				t.Errorf("%+v: cookie %q should not contain %q", at.attrs, cookie, not)
+			}
+		}
+	}
+}
+
+// Tests that the SameSite option sets the attribute on every cookie.
+func TestSameSite(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+
+	var sameSiteTests = []struct {
+		mode SameSiteMode
+		want string
+	}{
+		{SameSiteLaxMode, "; SameSite=Lax"},
+		{SameSiteStrictMode, "; SameSite=Strict"},
+		{SameSiteNoneMode, "; SameSite=None"},
+	}
+
+	for _, st := range sameSiteTests {
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, SameSite(st.mode))(s).ServeHTTP(rr, r)
+
+		cookie := rr.Header().Get("Set-Cookie")
+		if !strings.Contains(cookie, st.want) || !strings.Contains(cookie, "; Secure") {
+			t.Errorf("%v: cookie %q does not contain %q", st.mode, cookie, st.want)
+		}
+	}
+}
+
+func TestCookiePrefix(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+
+	var prefixTests = []struct {
+		opts  []Option
+		attrs CookieAttributes
+		want  []string
+		not   []string
+	}{
+		{
+			[]Option{WithCookiePrefix(HostPrefix), Domain("example.com"), Path("/app"), Secure(false)},
+			CookieAttributes{},
+			[]string{"__Host-" + cookieName + "=", "; Path=/;", "; Secure"},
+			[]string{"Domain=", "/app"},
+		},
+		{
+			[]Option{WithCookiePrefix(HostPrefix)},
+			CookieAttributes{Domain: "example.com", Path: "/app"},
+			[]string{"__Host-" + cookieName + "=", "; Path=/;", "; Secure"},
+			[]string{"Domain=", "/app"},
+		},
+		{
+			[]Option{Scope(IsolatedScope)},
+			CookieAttributes{Domain: "example.com", Path: "/app"},
+			[]string{"; Path=/app"},
+			[]string{"Domain="},
+		},
+		{
+			[]Option{WithCookiePrefix(SecurePrefix), Secure(false), Development(DevModeOn)},
+			CookieAttributes{},
+			[]string{"__Secure-" + cookieName + "=", "; Secure"},
+			nil,
+		},
+	}
+
+	for _, pt := range prefixTests {
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = WithCookieAttributes(r, pt.attrs)
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, pt.opts...)(s).ServeHTTP(rr, r)
+
+		cookie := rr.Header().Get("Set-Cookie")
+		for _, want := range pt.want {
+			if !strings.Contains(cookie, want) {
+				t.Errorf("cookie %q does not contain %q", cookie, want)
+			}
+		}
+
+		for _, not := range pt.not {
+			if strings.Contains(cookie, not) {
+				t.Errorf("cookie %q contains %q", cookie, not)
+			}
+		}
+	}
+}
+
+// Tests that the DomainFunc and PathFunc scope the cookie per request.
+func TestDomainFunc(t *testing.T) {
+	domain := DomainFunc(func(r *http.Request) string {
+		// Scope the cookie to the tenant's apex domain.
+		parts := strings.Split(r.Host, ".")
+		return strings.Join(parts[len(parts)-2:], ".")
+	})
+	path := PathFunc(func(r *http.Request) string {
+		return "/app"
+	})
+
+	var domainTests = []struct {
+		name     string
+		opts     []Option
+		host     string
+		attrs    *CookieAttributes
+		expected []string
+		absent   []string
+	}{
+		{"domain", []Option{domain}, "www.tenant-a.com", nil,
+			[]string{"Domain=tenant-a.com"}, nil},
+		{"other tenant", []Option{domain, Domain("example.com")}, "app.tenant-b.com", nil,
+			[]string{"Domain=tenant-b.com"}, nil},
+		{"path", []Option{path}, "www.tenant-a.com", nil,
+			[]string{"Path=/app"}, []string{"Domain="}},
+		{"overridden", []Option{domain}, "www.tenant-a.com", &CookieAttributes{Domain: "other.com"},
+			[]string{"Domain=other.com"}, nil},
+		{"host prefix", []Option{domain, path, WithCookiePrefix(HostPrefix)}, "www.tenant-a.com", nil,
+			[]string{"Path=/"}, []string{"Domain=", "Path=/app"}},
+		{"isolated", []Option{domain, Scope(IsolatedScope)}, "www.tenant-a.com", nil,
+			nil, []string{"Domain="}},
+	}
+
+	for _, dt := range domainTests {
+		r := httptest.NewRequest("GET", "https://"+dt.host+"/", nil)
+		if dt.attrs != nil {
+			r = WithCookieAttributes(r, *dt.attrs)
+		}
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, dt.opts...)(http.HandlerFunc(testHandler)).ServeHTTP(rr, r)
+
+		cookie := rr.Header().Get("Set-Cookie")
+		for _, want := range dt.expected {
+			if !strings.Contains(cookie, want) {
+				t.Errorf("%s: cookie %q does not contain %q", dt.name, cookie, want)
+			}
+		}
+
+		for _, unwanted := range dt.absent {
+			if strings.Contains(cookie, unwanted) {
+				t.Errorf("%s: cookie %q contains %q", dt.name, cookie, unwanted)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package csrf
+
+import (
+	"log"
+	"strings"
+)
+
+// CookiePrefix is a cookie name prefix that makes browsers enforce the
+// attributes of the CSRF cookie. See WithCookiePrefix.
+type CookiePrefix string
+
+const (
+	// HostPrefix ("__Host-") requires the cookie to be Secure, to have Path
+	// "/" and no Domain, so that it can only be set by the exact host over
+	// HTTPS - a sibling subdomain can't overwrite it.
+	HostPrefix CookiePrefix = "__Host-"
+	// SecurePrefix ("__Secure-") requires the cookie to be Secure, so that it
+	// can't be set over plaintext HTTP.
+	SecurePrefix CookiePrefix = "__Secure-"
+)
+
+// prefixed reports whether name has a cookie prefix, which browsers only
+// accept on Secure cookies.
+func prefixed(name string) bool {
+	return strings.HasPrefix(name, string(HostPrefix)) ||
+		strings.HasPrefix(name, string(SecurePrefix))
+}
+
+// applyPrefix prefixes the cookie name with the CookiePrefix, if any, and sets
+// the cookie options the prefix requires. Options that contradict them are
+// logged and overridden.
+func (cs *csrf) applyPrefix() {
+	prefix := cs.opts.CookiePrefix
+	if prefix == "" {
+		return
+	}
+
+	if !strings.HasPrefix(cs.opts.CookieName, string(prefix)) {
+		cs.opts.CookieName = string(prefix) + cs.opts.CookieName
+	}
+
+	cs.opts.Secure = true
+	if prefix != HostPrefix {
+		return
+	}
+
+	if cs.opts.Domain != "" || cs.opts.SharedDomain != "" {
+		log.Printf("%signoring cookie domain %q: %s cookies are host-only",
+			errorPrefix, cs.opts.Domain, prefix)
+		cs.opts.Domain = ""
+		cs.opts.SharedDomain = ""
+	}
+
+	if cs.opts.Path != "" && cs.opts.Path != "/" {
+		log.Printf("%signoring cookie path %q: %s cookies must have path \"/\"",
+			errorPrefix, cs.opts.Path, prefix)
+	}
+	cs.opts.Path = "/"
+}
@@ -2,38 +2,109 @@ package csrf
 
 import (
 	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
-
-	"github.com/gorilla/securecookie"
 )
 
 // CSRF token length in bytes.
 const tokenLength = 32
 
-// Context/session keys & prefixes
+// Context keys
 const (
-	tokenKey     string = "gorilla.csrf.Token"
-	formKey      string = "gorilla.csrf.Form"
-	errorKey     string = "gorilla.csrf.Error"
-	skipCheckKey string = "gorilla.csrf.Skip"
-	cookieName   string = "_gorilla_csrf"
-	errorPrefix  string = "gorilla/csrf: "
+	tokenKey     contextKey = "gorilla.csrf.Token"
+	formKey      contextKey = "gorilla.csrf.Form"
+	errorKey     contextKey = "gorilla.csrf.Error"
+	skipCheckKey contextKey = "gorilla.csrf.Skip"
+	baseTokenKey contextKey = "gorilla.csrf.BaseToken"
+	csrfKey      contextKey = "gorilla.csrf.Middleware"
+	honeypotKey  contextKey = "gorilla.csrf.Honeypot"
+	taggedKey    contextKey = "gorilla.csrf.Tagged"
+	attrsKey     contextKey = "gorilla.csrf.CookieAttributes"
+	issuedKey    contextKey = "gorilla.csrf.Issued"
+	devKey       contextKey = "gorilla.csrf.Development"
+	tokenUseKey  contextKey = "gorilla.csrf.TokenUse"
+	failureKey   contextKey = "gorilla.csrf.FailureKind"
+	spanKey      contextKey = "gorilla.csrf.Span"
+	bodyLimitKey contextKey = "gorilla.csrf.BodyLimit"
+	crossSiteKey contextKey = "gorilla.csrf.CrossSite"
+	statusKey    contextKey = "gorilla.csrf.FailureStatus"
+)
+
+// Cookie name & prefixes
+const (
+	cookieName  string = "_gorilla_csrf"
+	errorPrefix string = "gorilla/csrf: "
 )
 
 var (
 	// The name value used in form fields.
-	fieldName = tokenKey
+	fieldName = string(tokenKey)
 	// defaultAge sets the default MaxAge for cookies.
 	defaultAge = 3600 * 12
 	// The default HTTP request header to inspect
 	headerName = "X-CSRF-Token"
+	// The default response header for the token's expiry (see ExpiryHeader)
+	expiryHeaderName = "X-CSRF-Token-Expires"
 	// Idempotent (safe) methods as defined by RFC7231 section 4.2.2.
 	safeMethods = []string{"GET", "HEAD", "OPTIONS", "TRACE"}
 )
 
+// errorRoute is an error handler registered with ErrorHandlerFor.
+type errorRoute struct {
+	match func(r *http.Request) bool
+	h     http.Handler
+}
+
+// FailureMode describes how the middleware responds when it cannot process a
+// request because of an internal error, such as the system's secure random
+// number generator failing, a panic in the cookie codec or an unavailable
+// token store.
+type FailureMode int
+
+const (
+	// FailClosed rejects the request with a HTTP 503 Service Unavailable
+	// status. This is the default.
+	FailClosed FailureMode = iota
+	// FailOpen logs the error and serves the request without CSRF protection.
+	// The error remains available via FailureReason.
+	FailOpen
+)
+
+// Validator is an additional check run on requests with unsafe methods after
+// their CSRF token has been validated - e.g. to require that the token was
+// issued by the current deployment epoch. A non-nil error fails the request:
+// it is made available via FailureReason and handled like any other CSRF
+// failure.
+type Validator func(r *http.Request) error
+
+// Normalizer rewrites a request before the middleware inspects it - e.g. to
+// strip tracking parameters, canonicalize the host or map legacy header names -
+// so that quirky clients don't need blanket exemptions. It may modify r in
+// place or return a copy; the returned request is used for the remainder of
+// CSRF processing and passed on to the wrapped handler.
+type Normalizer func(r *http.Request) *http.Request
+
+// HeaderAlias returns a Normalizer that copies the value of the legacy header
+// to the canonical header if the latter is not already set - e.g.
+// HeaderAlias("X-XSRF-Token", "X-CSRF-Token").
+func HeaderAlias(legacy, canonical string) Normalizer {
+	return func(r *http.Request) *http.Request {
+		if v := r.Header.Get(legacy); v != "" && r.Header.Get(canonical) == "" {
+			r.Header.Set(canonical, v)
+		}
+
+		return r
+	}
+}
+
 // TemplateTag provides a default template tag - e.g. {{ .csrfField }} - for use
 // with the TemplateField function.
 var TemplateTag = "csrfField"
@@ -50,13 +121,96 @@ var (
 	// ErrBadToken is returned if the CSRF token in the request does not match
 	// the token in the session, or is otherwise malformed.
 	ErrBadToken = errors.New("CSRF token invalid")
+	// ErrHoneypot is returned if the request filled in the honeypot field
+	// configured with the Honeypot option.
+	ErrHoneypot = errors.New("honeypot field submitted")
+	// ErrAutomated is returned if a Classifier rejected the request as
+	// automated.
+	ErrAutomated = errors.New("request rejected as automated")
+	// ErrTokenExpired is returned if the request carries a CSRF token but the
+	// session token it was issued against has outlived its MaxAge, or the
+	// token itself has outlived the TokenMaxAge. Clients should fetch a fresh
+	// token (e.g. by reloading the form) and retry.
+	ErrTokenExpired = errors.New("CSRF token expired")
+	// ErrInsecureRequest is returned if EnforceTLS is set and the request was
+	// not made over TLS.
+	ErrInsecureRequest = errors.New("CSRF protection requires TLS")
+	// ErrBadSignature is returned if RequestSigning is enabled and the request
+	// carries a signature that is invalid or was made outside the replay
+	// window.
+	ErrBadSignature = errors.New("request signature invalid")
+	// ErrTokenNotFound is returned by a TokenStore that holds no token for an
+	// ID.
+	ErrTokenNotFound = errors.New("CSRF token not found in store")
+	// ErrNoCookie is returned if the request carries a token but no CSRF
+	// cookie - typically because the cookie expired or was cleared. It is a
+	// form of ErrBadToken, so errors.Is(err, ErrBadToken) also reports true.
+	ErrNoCookie error = &wrappedError{"CSRF cookie not found in request", ErrBadToken}
+	// ErrCookieDecode is returned if the request's CSRF cookie could not be
+	// decoded or authenticated - e.g. because it was tampered with or the
+	// authentication key changed. It is a form of ErrBadToken.
+	ErrCookieDecode error = &wrappedError{"CSRF cookie invalid", ErrBadToken}
+	// ErrBadOrigin is returned when the request's Origin header names another
+	// origin than the one the request was made to. It is a form of
+	// ErrBadReferer.
+	ErrBadOrigin error = &wrappedError{"origin invalid", ErrBadReferer}
+	// ErrTokenUsed is returned if SingleUseTokens applies to the request and
+	// its token was not issued by OneTimeToken or has already been used. It
+	// is a form of ErrBadToken.
+	ErrTokenUsed error = &wrappedError{"CSRF token already used", ErrBadToken}
+	// ErrCrossSite is returned if FetchMetadata is set and the browser marked
+	// the request as sent from another site. It is a form of ErrBadOrigin.
+	ErrCrossSite error = &wrappedError{"cross-site request", ErrBadOrigin}
 )
 
+// wrappedError is a sentinel error that is a more specific form of another,
+// so that errors.Is matches either.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e *wrappedError) Error() string { return e.msg }
+
+// Unwrap returns the less specific error.
+func (e *wrappedError) Unwrap() error { return e.err }
+
 type csrf struct {
 	h    http.Handler
-	sc   *securecookie.SecureCookie
+	sc   codec
 	st   store
 	opts options
+	// authKey is the key passed to Protect.
+	authKey []byte
+	// prevKeys are previous authentication keys, set with PreviousKeys. They
+	// are kept out of the options so that they aren't fingerprinted.
+	prevKeys [][]byte
+	// stampKeys authenticate the timestamps of issued tokens, if TokenMaxAge
+	// is set.
+	stampKeys [][]byte
+	// fingerprint is a hash of opts, reported via the FingerprintHeader.
+	fingerprint string
+	// grace holds the previous real token after a MigrateToken call.
+	grace *cookieStore
+	// hosts holds the handlers for hosts configured with HostOptions.
+	hosts map[string]*csrf
+	// replays records requests that carried an idempotency key.
+	replays *replayCache
+	// pool holds pre-generated tokens, if a TokenPool is configured.
+	pool *tokenPool
+	// random replaces crypto/rand as the source of random bytes for tokens
+	// and one-time pads, in tests.
+	random io.Reader
+	// exempt matches the paths configured with ExemptPaths.
+	exempt []pathMatcher
+	// extract is the chain of TokenExtractors, built by setup.
+	extract []TokenExtractor
+	// singleUsePaths matches the paths configured with SingleUseTokens.
+	singleUsePaths []pathMatcher
+	// proxies holds the networks configured with TrustedProxies.
+	proxies []*net.IPNet
+	// codecs holds the codecs for KeyFunc key rings and isolated hosts.
+	codecs *codecCache
 }
 
 // options contains the optional settings for the CSRF middleware.
@@ -66,12 +220,83 @@ type options struct {
 	Path   string
 	// Note that the function and field names match the case of the associated
 	// http.Cookie field instead of the "correct" HTTPOnly name that golint suggests.
-	HttpOnly      bool
-	Secure        bool
-	RequestHeader string
-	FieldName     string
-	ErrorHandler  http.Handler
-	CookieName    string
+	HttpOnly          bool
+	Secure            bool
+	RequestHeader     string
+	FieldName         string
+	ErrorHandler      http.Handler
+	ErrorHandlers     []errorRoute
+	CookieName        string
+	Enforcement       *Switch
+	Mode              Enforcement
+	FingerprintHeader string
+	FailurePolicy     FailureMode
+	HoneypotField     string
+	HoneypotAudit     func(r *http.Request)
+	Classifier        Classifier
+	TarpitDelay       time.Duration
+	Validators        []Validator
+	Normalizers       []Normalizer
+	Hosts             map[string][]Option
+	KeyFunc           func(r *http.Request) ([][]byte, error)
+	EnforceTLS        bool
+	ExpiryHeader      string
+	DevMode           DevMode
+	TrustForwarded    bool
+	SchemeFunc        func(r *http.Request) string
+	ResponseHeaders   []string
+	SigningWindow     time.Duration
+	ReplayLimit       int
+	ReplayTTL         time.Duration
+	Encoding          Encoding
+	Vary              []string
+	CacheControl      string
+	DeferredEndpoint  string
+	SameSite          SameSiteMode
+	TrustedOrigins    []string
+	StaticSite        StaticSite
+	TokenPool         int
+	Name              string
+	Store             TokenStore
+	SessionCookie     string
+	SharedDomain      string
+	Scope             CookieScope
+	ChannelBinding    bool
+	RenewEndpoint     string
+	AuthScheme        string
+	BoundMethods      []string
+	RandAttempts      int
+	RandBackoff       time.Duration
+	Alert             func(r *http.Request, err error)
+	ExemptPaths       []string
+	SkipFunc          func(r *http.Request) bool
+	XSRFCookie        string
+	XSRFHeader        string
+	Signer            Signer
+	Metrics           Metrics
+	Tracer            Tracer
+	Logger            eventLogger
+	JSONField         string
+	Extractors        []TokenExtractor
+	MaxBodyBytes      int64
+	SafeMethods       []string
+	SingleUseStore    TokenStore
+	SingleUsePaths    []string
+	TokenMaxAge       time.Duration
+	CookiePrefix      CookiePrefix
+	WebSockets        bool
+	WebSocketToken    bool
+	FetchMetadata     FetchMetadataMode
+	OriginMode        OriginMode
+	OriginFunc        func(r *http.Request, origin *url.URL) bool
+	TrustedProxies    []string
+	DomainFunc        func(r *http.Request) string
+	PathFunc          func(r *http.Request) string
+	InjectForms       bool
+	PublicCache       PublicCacheMode
+	FailureStatus     int
+	Reissue           bool
+	ReissueHeader     string
 }
 
 // Protect is HTTP middleware that provides Cross-Site Request Forgery
@@ -125,155 +350,544 @@ type options struct {
 //
 func Protect(authKey []byte, opts ...Option) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
-		cs := parseOptions(h, opts...)
+		return newCSRF(authKey, h, opts...)
+	}
+}
 
-		// Set the defaults if no options have been specified
-		if cs.opts.ErrorHandler == nil {
-			cs.opts.ErrorHandler = http.HandlerFunc(unauthorizedHandler)
+// newCSRF returns a csrf handler for h configured with opts, along with a
+// handler for each host configured with HostOptions.
+func newCSRF(authKey []byte, h http.Handler, opts ...Option) *csrf {
+	cs := parseOptions(h, opts...)
+	hosts := cs.opts.Hosts
+	cs.setup(authKey)
+
+	if len(hosts) > 0 {
+		cs.hosts = make(map[string]*csrf, len(hosts))
+		for host, hostOpts := range hosts {
+			// Host options are applied on top of the shared options.
+			hcs := parseOptions(h, append(opts[:len(opts):len(opts)], hostOpts...)...)
+			hcs.setup(authKey)
+			cs.hosts[strings.ToLower(host)] = hcs
 		}
+	}
 
-		if cs.opts.MaxAge < 0 {
-			// Default of 12 hours
-			cs.opts.MaxAge = defaultAge
-		}
+	return cs
+}
 
-		if cs.opts.FieldName == "" {
-			cs.opts.FieldName = fieldName
-		}
+// setup applies defaults to the parsed options and creates the codec and
+// stores they require.
+func (cs *csrf) setup(authKey []byte) {
+	// Per-host handlers are created by newCSRF; they don't nest.
+	cs.opts.Hosts = nil
+
+	// Set the defaults if no options have been specified
+	cs.opts.setDefaults()
+	cs.authKey = authKey
+	cs.checkScope()
+	cs.applyPrefix()
+	cs.exempt = compilePaths("exempt", cs.opts.ExemptPaths)
+	cs.extract = cs.extractors()
+	cs.singleUsePaths = compilePaths("single-use", cs.opts.SingleUsePaths)
+	cs.proxies = compileProxies(cs.opts.TrustedProxies)
+
+	if cs.opts.FingerprintHeader != "" {
+		cs.fingerprint = cs.opts.fingerprint()
+	}
 
-		if cs.opts.CookieName == "" {
-			cs.opts.CookieName = cookieName
+	// Create the codec for the key passed to Protect and any PreviousKeys.
+	if cs.sc == nil {
+		cs.sc = cs.newCodec(append([][]byte{authKey}, cs.prevKeys...)...)
+	}
+	cs.codecs = newCodecCache()
+
+	if cs.st == nil {
+		// Default to the cookieStore
+		st := &cookieStore{
+			name:     cs.opts.CookieName,
+			maxAge:   cs.opts.MaxAge,
+			secure:   cs.opts.Secure,
+			httpOnly: cs.opts.HttpOnly,
+			path:     cs.opts.Path,
+			domain:   cs.opts.Domain,
+			sameSite: cs.opts.SameSite,
+			codecs:   cs.codecFor,
 		}
 
-		if cs.opts.RequestHeader == "" {
-			cs.opts.RequestHeader = headerName
+		// Keep only an ID in the cookie if tokens are kept on the server.
+		cs.st = st
+		if cs.opts.Store != nil {
+			cs.st = &serverStore{ids: st, backend: cs.opts.Store}
 		}
+	}
 
-		// Create an authenticated securecookie instance.
-		if cs.sc == nil {
-			cs.sc = securecookie.New(authKey, nil)
-			// Use JSON serialization (faster than one-off gob encoding)
-			cs.sc.SetSerializer(securecookie.JSONEncoder{})
-			// Set the MaxAge of the underlying securecookie.
-			cs.sc.MaxAge(cs.opts.MaxAge)
-		}
+	if cs.opts.SessionCookie != "" {
+		cs.st = &sessionStore{store: cs.st, name: cs.opts.SessionCookie, key: authKey}
+	}
 
-		if cs.st == nil {
-			// Default to the cookieStore
-			cs.st = &cookieStore{
-				name:     cs.opts.CookieName,
-				maxAge:   cs.opts.MaxAge,
-				secure:   cs.opts.Secure,
-				httpOnly: cs.opts.HttpOnly,
-				path:     cs.opts.Path,
-				domain:   cs.opts.Domain,
-				sc:       cs.sc,
-			}
+	if cs.opts.TokenMaxAge > 0 {
+		cs.stampKeys = stampKeys(append([][]byte{authKey}, cs.prevKeys...))
+		if len(cs.stampKeys) == 0 {
+			log.Printf("%sno key to authenticate token timestamps with: TokenMaxAge needs the key passed to Protect",
+				errorPrefix)
 		}
+	}
+
+	if cs.opts.TokenPool > 0 {
+		cs.pool = newTokenPool(cs.opts.TokenPool, cs.randomSource())
+	}
 
-		return cs
+	if cs.opts.ReplayLimit > 0 {
+		cs.replays = newReplayCache(cs.opts.ReplayLimit, cs.opts.ReplayTTL)
+	}
+
+	cs.grace = &cookieStore{
+		name:     cs.opts.CookieName + graceSuffix,
+		maxAge:   graceAge,
+		secure:   cs.opts.Secure,
+		httpOnly: cs.opts.HttpOnly,
+		path:     cs.opts.Path,
+		domain:   cs.opts.Domain,
+		sameSite: cs.opts.SameSite,
+		codecs:   cs.graceCodecFor,
 	}
 }
 
 // Implements http.Handler for the csrf type.
 func (cs *csrf) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Skip the check if directed to. This should always be a bool.
-	if val, err := contextGet(r, skipCheckKey); err == nil {
-		if skip, ok := val.(bool); ok {
-			if skip {
-				cs.h.ServeHTTP(w, r)
-				return
-			}
+	// Hand the request to the host's handler if it has its own options.
+	if cs.hosts != nil {
+		if hcs, ok := cs.hosts[requestHost(r)]; ok {
+			hcs.ServeHTTP(w, r)
+			return
 		}
 	}
 
-	// Retrieve the token from the session.
-	// An error represents either a cookie that failed HMAC validation
-	// or that doesn't exist.
-	realToken, err := cs.st.Get(r)
-	if err != nil || len(realToken) != tokenLength {
-		// If there was an error retrieving the token, the token doesn't exist
-		// yet, or it's the wrong length, generate a new token.
-		// Note that the new token will (correctly) fail validation downstream
-		// as it will no longer match the request token.
-		realToken, err = generateRandomBytes(tokenLength)
-		if err != nil {
-			r = envError(r, err)
-			cs.opts.ErrorHandler.ServeHTTP(w, r)
+	if cs.fingerprint != "" {
+		w.Header().Set(cs.opts.FingerprintHeader, cs.fingerprint)
+	}
+
+	// Skip the check if directed to, or if the path is exempt.
+	if cs.skip(r) {
+		cs.h.ServeHTTP(w, r)
+		return
+	}
+
+	// Attribute the middleware's own work in CPU profiles.
+	if cs.opts.Name != "" {
+		cs.label(r, "issue")
+		defer cs.unlabel(r)
+	}
+
+	// Normalize the request before any checks run.
+	for _, normalize := range cs.opts.Normalizers {
+		r = normalize(r)
+	}
+
+	// Work out where this request's cookies apply.
+	if cs.opts.DomainFunc != nil || cs.opts.PathFunc != nil ||
+		cs.opts.CookiePrefix == HostPrefix || cs.opts.Scope == IsolatedScope {
+		r = cs.scopeCookies(r)
+	}
+
+	// Give the Classifier (if any) the first look at the request.
+	if cs.opts.Classifier != nil {
+		var ok bool
+		if r, ok = cs.classify(w, r); !ok {
 			return
 		}
+	}
 
-		// Save the new (real) token in the session store.
-		err = cs.st.Save(realToken, w)
-		if err != nil {
-			r = envError(r, err)
-			cs.opts.ErrorHandler.ServeHTTP(w, r)
+	// Relax the Secure flag and the TLS-only checks for local development.
+	dev := cs.development(r)
+	if dev {
+		r = contextSave(r, devKey, true)
+	}
+
+	// Refuse to issue or check tokens over plaintext HTTP if TLS is required.
+	if cs.opts.EnforceTLS && !dev && cs.scheme(r) != "https" {
+		cs.fail(w, r, ErrInsecureRequest)
+		return
+	}
+
+	// Signed requests from machine clients don't need a cookie or token.
+	if cs.opts.SigningWindow > 0 && r.Header.Get(signatureHeader) != "" &&
+		!cs.safe(r) {
+		if err := cs.verifySignature(r); err == ErrBadSignature {
+			cs.fail(w, r, err)
+			return
+		} else if err != nil {
+			cs.internalError(w, r, err)
 			return
 		}
+
+		cs.validationPassed()
+		cs.serveNext(w, r)
+		return
+	}
+
+	// The bootstrap script is the same for every user and publicly cached, so
+	// it is served before the session cookie is set.
+	if cs.opts.StaticSite.Endpoint != "" && r.URL.Path == cs.opts.StaticSite.Endpoint+".js" &&
+		cs.safe(r) {
+		cs.serveBootstrapScript(w, r)
+		return
+	}
+
+	// Retrieve the token from the session, generating a new one if required.
+	// sessionErr is kept so that failures on unsafe methods can report why the
+	// session token was unusable.
+	realToken, sessionErr, err := cs.sessionToken(w, r)
+	if err != nil {
+		cs.internalError(w, r, err)
+		return
+	}
+
+	// Tokens bound to the TLS connection are issued and checked in place of
+	// the session token.
+	realToken, err = cs.bindToken(r, realToken)
+	if err != nil {
+		cs.internalError(w, r, err)
+		return
+	}
+
+	masked, err := cs.mask(realToken)
+	if err != nil {
+		cs.internalError(w, r, err)
+		return
 	}
 
 	// Save the masked token to the request context
-	r = contextSave(r, tokenKey, mask(realToken, r))
+	r = contextSave(r, tokenKey, masked)
+	// Save the real token for helpers that derive values from it
+	r = contextSave(r, baseTokenKey, realToken)
+	// Save the middleware for helpers that issue tokens
+	r = contextSave(r, csrfKey, cs)
 	// Save the field name to the request context
 	r = contextSave(r, formKey, cs.opts.FieldName)
+	// Save the honeypot field name (if any) for TemplateField
+	if cs.opts.HoneypotField != "" {
+		r = contextSave(r, honeypotKey, cs.opts.HoneypotField)
+	}
+
+	// Answer requests for the static site's bootstrap endpoint directly.
+	if cs.opts.StaticSite.Endpoint != "" && r.URL.Path == cs.opts.StaticSite.Endpoint &&
+		cs.safe(r) {
+		cs.serveBootstrap(w, r)
+		return
+	}
+
+	// Answer requests for the deferred token endpoint directly.
+	if cs.opts.DeferredEndpoint != "" && r.URL.Path == cs.opts.DeferredEndpoint &&
+		cs.safe(r) {
+		cs.serveDeferredToken(w, r)
+		return
+	}
+
+	// Answer requests for the renewal endpoint the same way.
+	if cs.opts.RenewEndpoint != "" && r.URL.Path == cs.opts.RenewEndpoint &&
+		cs.safe(r) {
+		cs.serveDeferredToken(w, r)
+		return
+	}
+
+	// WebSocket handshakes are GET requests, but open a connection that a
+	// page on another site could otherwise use with the visitor's cookies.
+	if cs.opts.WebSockets && isWebSocket(r) {
+		if err := cs.checkWebSocket(r, realToken, sessionErr); err != nil {
+			cs.fail(w, r, err)
+			return
+		}
+	}
 
 	// HTTP methods not defined as idempotent ("safe") under RFC7231 require
 	// inspection.
-	if !contains(safeMethods, r.Method) {
-		// Enforce an origin check for HTTPS connections. As per the Django CSRF
-		// implementation (https://goo.gl/vKA7GE) the Referer header is almost
-		// always present for same-domain HTTP requests.
-		if r.URL.Scheme == "https" {
-			// Fetch the Referer value. Call the error handler if it's empty or
-			// otherwise fails to parse.
-			referer, err := url.Parse(r.Referer())
-			if err != nil || referer.String() == "" {
-				r = envError(r, ErrNoReferer)
-				cs.opts.ErrorHandler.ServeHTTP(w, r)
+	if !cs.safe(r) {
+		cs.label(r, "validate")
+
+		var span Span
+		r, span = cs.startSpan(r, validateSpan)
+
+		// Limit how much of the body is read in search of a token.
+		r = contextSave(r, bodyLimitKey, cs.opts.MaxBodyBytes)
+
+		// Browsers mark where the request was sent from, and pages can't
+		// forge the mark.
+		if cs.opts.FetchMetadata != FetchMetadataOff {
+			switch cs.fetchSite(r) {
+			case siteCross:
+				if cs.opts.FetchMetadata == FetchMetadataFlag {
+					r = contextSave(r, crossSiteKey, true)
+					break
+				}
+
+				cs.fail(w, r, ErrCrossSite)
 				return
+			case siteSameOrigin:
+				if cs.opts.FetchMetadata == FetchMetadataStandalone {
+					cs.validationPassed()
+					endSpan(span)
+					cs.serveNext(w, r)
+					return
+				}
 			}
+		}
 
-			if sameOrigin(r.URL, referer) == false {
-				r = envError(r, ErrBadReferer)
-				cs.opts.ErrorHandler.ServeHTTP(w, r)
+		// Check that the request came from an allowed origin.
+		if !dev {
+			if err := cs.checkOrigin(r, cs.origin(r), r.Header.Get("Origin"), r.Referer()); err != nil {
+				cs.fail(w, r, err)
 				return
 			}
 		}
 
-		// If the token returned from the session store is nil for non-idempotent
-		// ("unsafe") methods, call the error handler.
-		if realToken == nil {
-			r = envError(r, ErrNoToken)
-			cs.opts.ErrorHandler.ServeHTTP(w, r)
+		// Reject requests that filled in the honeypot: humans never see it.
+		if cs.opts.HoneypotField != "" && formValue(r, cs.opts.HoneypotField) != "" {
+			if cs.opts.HoneypotAudit != nil {
+				cs.opts.HoneypotAudit(r)
+			}
+
+			cs.fail(w, r, ErrHoneypot)
 			return
 		}
 
-		// Retrieve the combined token (pad + masked) token and unmask it.
-		requestToken := unmask(cs.requestToken(r))
+		// Retrieve the combined token (pad + masked) token from the request.
+		// A request that carries no token at all fails with ErrNoToken, which
+		// is distinct from a token that was sent but doesn't verify.
+		issued, err := cs.requestToken(r)
+		if err == ErrBadToken {
+			cs.failKind(w, r, err, DecodeError)
+			return
+		} else if err != nil {
+			cs.fail(w, r, err)
+			return
+		}
 
-		// Compare the request token against the real token
-		if !compareTokens(requestToken, realToken) {
-			r = envError(r, ErrBadToken)
-			cs.opts.ErrorHandler.ServeHTTP(w, r)
+		// A token issued against an expired session token can never match the
+		// newly generated one: report the expiry rather than a mismatch.
+		if sessionErr == ErrTokenExpired {
+			cs.fail(w, r, ErrTokenExpired)
 			return
 		}
 
-	}
+		// Unmask the request token for comparison.
+		requestToken := unmask(issued)
+
+		// Compare the request token against the real token (or the token
+		// bound to the request's method), falling back to the previous token
+		// (accepted once) if MigrateToken was called, and then to retries of
+		// requests that carried an idempotency key.
+		matched, bound := cs.matchToken(r, realToken, requestToken)
+		if matched || (!bound && cs.acceptGrace(w, r, requestToken)) {
+			// Consume the token if it may only be used once, unless the
+			// request is an identical retry of one that already consumed it.
+			if cs.singleUse(r) &&
+				(cs.replays == nil || !cs.replays.accept(r, requestToken)) {
+				if err := cs.consume(r, issued); err == ErrTokenUsed {
+					cs.fail(w, r, err)
+					return
+				} else if err != nil {
+					cs.internalError(w, r, err)
+					return
+				}
+			}
 
-	// Set the Vary: Cookie header to protect clients from caching the response.
-	w.Header().Add("Vary", "Cookie")
+			if cs.replays != nil {
+				cs.replays.record(r, requestToken)
+			}
+		} else if cs.replays == nil || !cs.replays.accept(r, requestToken) {
+			cs.fail(w, r, mismatchReason(sessionErr))
+			return
+		}
+
+		// Run any additional checks now that the token is known to be valid.
+		for _, validate := range cs.opts.Validators {
+			if err := validate(r); err != nil {
+				cs.fail(w, r, err)
+				return
+			}
+		}
+
+		cs.validationPassed()
+		endSpan(span)
+	}
 
 	// Call the wrapped handler/router on success.
+	cs.serveNext(w, r)
+}
+
+// sessionToken retrieves the real token from the session store. If there was
+// an error retrieving the token, the token doesn't exist yet, or it's the wrong
+// length, a new token is generated and saved, and sessionErr reports why the
+// stored token could not be used. Note that the new token will (correctly) fail
+// validation downstream as it will no longer match the request token.
+//
+// err reports an internal failure, including a panic raised by the store or
+// its codec, and is handled according to the FailurePolicy.
+func (cs *csrf) sessionToken(w http.ResponseWriter, r *http.Request) (realToken []byte, sessionErr error, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("internal error: %v", p)
+		}
+	}()
+
+	realToken, sessionErr = cs.st.Get(r)
+	if sessionErr == nil && len(realToken) == tokenLength {
+		return realToken, nil, nil
+	}
+
+	cs.decodeError(r, sessionErr)
+
+	r, span := cs.startSpan(r, issueSpan)
+	defer endSpan(span)
+
+	realToken, err = cs.randomToken()
+	if err != nil {
+		return nil, sessionErr, err
+	}
+
+	// Save the new (real) token in the session store.
+	if err = cs.st.Save(realToken, w, r); err != nil {
+		return nil, sessionErr, err
+	}
+
+	cs.tokenIssued(r)
+	return realToken, sessionErr, nil
+}
+
+// serveNext calls the wrapped handler for a request that may proceed.
+func (cs *csrf) serveNext(w http.ResponseWriter, r *http.Request) {
+	// The wrapped handler's work isn't the middleware's.
+	cs.unlabel(r)
+
+	// Keep the CSRF cookie out of shared caches.
+	var pw *publicCacheWriter
+	if cs.opts.PublicCache != PublicCacheAllow {
+		pw = &publicCacheWriter{ResponseWriter: w, cs: cs}
+		w = pw
+	}
+
+	// Set the Vary header (by default, Vary: Cookie) to protect clients from
+	// caching the response.
+	for _, name := range cs.opts.Vary {
+		addVary(w.Header(), name)
+	}
+
+	// Keep responses that embed the token out of shared caches.
+	if cs.opts.CacheControl != "" {
+		use := &tokenUse{}
+		r = contextSave(r, tokenUseKey, use)
+		w = &cacheControlWriter{ResponseWriter: w, directive: cs.opts.CacheControl, use: use}
+	}
+
+	if len(cs.opts.ResponseHeaders) > 0 {
+		if token := Token(r); token != "" {
+			for _, name := range cs.opts.ResponseHeaders {
+				w.Header().Set(name, token)
+			}
+		}
+	}
+
+	if cs.opts.ExpiryHeader != "" {
+		if expiry := TokenExpiry(r); !expiry.IsZero() {
+			w.Header().Set(cs.opts.ExpiryHeader, strconv.FormatInt(expiry.Unix(), 10))
+		}
+	}
+
+	if cs.opts.XSRFCookie != "" {
+		cs.setXSRFCookie(w, r)
+	}
+
+	cw, _ := w.(*cacheControlWriter)
+
+	var fw *formWriter
+	if cs.opts.InjectForms {
+		fw = &formWriter{ResponseWriter: w, r: r, scheme: cs.scheme(r)}
+		w = fw
+	}
+
 	cs.h.ServeHTTP(w, r)
-	// Clear the request context after the handler has completed.
-	contextClear(r)
+
+	// HTML responses are only written once the handler has returned.
+	if fw != nil {
+		fw.finish()
+	}
+
+	// The handler may not have written anything, leaving the headers unsent.
+	if cw != nil {
+		cw.setCacheControl()
+	}
+	if pw != nil {
+		pw.check()
+	}
+}
+
+// fail handles a request that failed CSRF validation. The reason is stored in
+// the request context, and the request is then either rejected via the
+// ErrorHandler or, in ReportOnly mode, served as if validation had passed.
+func (cs *csrf) fail(w http.ResponseWriter, r *http.Request, reason error) {
+	cs.failKind(w, r, reason, failureKind(reason))
+}
+
+// failKind is fail for a reason whose FailureKind can't be told from the
+// reason alone.
+func (cs *csrf) failKind(w http.ResponseWriter, r *http.Request, reason error, kind FailureKind) {
+	r = envError(r, reason)
+	r = contextSave(r, failureKey, kind)
+	r = contextSave(r, statusKey, cs.opts.FailureStatus)
+	cs.validationFailed(r, kind, reason)
+	failSpan(r, kind, reason)
+
+	if cs.mode(r) == ReportOnly {
+		cs.serveNext(w, r)
+		return
+	}
+
+	if cs.opts.Reissue {
+		cs.reissue(w, r, kind)
+	}
+
+	cs.errorHandler(r).ServeHTTP(w, cs.label(r, "reject"))
+}
+
+// errorHandler returns the handler for requests that fail validation: the
+// handler for the first ErrorHandlerFor route that matches r, or else the
+// ErrorHandler.
+func (cs *csrf) errorHandler(r *http.Request) http.Handler {
+	for _, route := range cs.opts.ErrorHandlers {
+		if route.match(r) {
+			return route.h
+		}
+	}
+
+	return cs.opts.ErrorHandler
+}
+
+// internalError handles a request the middleware could not process due to
+// its own failure (rather than the request failing validation), according to
+// the configured FailurePolicy.
+func (cs *csrf) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	r = envError(r, err)
+
+	if cs.opts.Alert != nil {
+		cs.opts.Alert(r, err)
+	}
+
+	if cs.opts.FailurePolicy == FailOpen {
+		log.Printf("%sserving request without CSRF protection: %v", errorPrefix, err)
+		cs.serveNext(w, r)
+		return
+	}
+
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable),
+		http.StatusServiceUnavailable)
 }
 
-// unauthorizedhandler sets a HTTP 403 Forbidden status and writes the
-// CSRF failure reason to the response.
+// unauthorizedhandler sets the failure status (HTTP 403 Forbidden by default)
+// and writes the CSRF failure reason to the response.
 func unauthorizedHandler(w http.ResponseWriter, r *http.Request) {
+	status := FailureStatusOf(r)
 	http.Error(w, fmt.Sprintf("%s - %s",
-		http.StatusText(http.StatusForbidden), FailureReason(r)),
-		http.StatusForbidden)
+		statusText(status), FailureReason(r)),
+		status)
 	return
 }
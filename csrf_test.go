@@ -1,10 +1,16 @@
 package csrf
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 var testKey = []byte("keep-it-secret-keep-it-safe-----")
@@ -126,6 +132,37 @@ func TestMethods(t *testing.T) {
 	}
 }
 
+// Test that SafeMethods replaces the set of methods that aren't validated.
+func TestSafeMethods(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+	p := Protect(testKey, SafeMethods("head", "OPTIONS", "REPORT"))(s)
+
+	var methodTests = []struct {
+		method string
+		code   int
+	}{
+		{"HEAD", http.StatusOK},
+		{"REPORT", http.StatusOK},
+		{"GET", http.StatusForbidden},
+		{"POST", http.StatusForbidden},
+	}
+
+	for _, mt := range methodTests {
+		r, err := http.NewRequest(mt.method, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != mt.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", mt.method, rr.Code, mt.code)
+		}
+	}
+}
+
 // Tests for failure if the cookie containing the session does not exist on a
 // POST request.
 func TestNoCookie(t *testing.T) {
@@ -313,3 +350,528 @@ func TestWithReferer(t *testing.T) {
 func setCookie(rr *httptest.ResponseRecorder, r *http.Request) {
 	r.Header.Set("Cookie", rr.Header().Get("Set-Cookie"))
 }
+
+// TestFailureReasons checks that requests with no token, an invalid token and
+// a token issued against an expired session are reported distinctly.
+func TestFailureReasons(t *testing.T) {
+	s := http.NewServeMux()
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	var reason error
+	p := Protect(testKey, MaxAge(defaultAge), ErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reason = FailureReason(r)
+		w.WriteHeader(http.StatusForbidden)
+	})))(s)
+
+	// Obtain a CSRF cookie via a GET request.
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var reasonTests = []struct {
+		name   string
+		cookie string
+		token  string
+		want   error
+	}{
+		{"no token", cookie, "", ErrNoToken},
+		{"malformed token", cookie, "not-base64!", ErrBadToken},
+		{"missing cookie", "", token, ErrNoCookie},
+		{"tampered cookie", cookieName + "=tampered", token, ErrCookieDecode},
+		{"expired session", expiredCookie(t, cookieName), token, ErrTokenExpired},
+	}
+
+	for _, rt := range reasonTests {
+		reason = nil
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rt.cookie != "" {
+			r.Header.Set("Cookie", rt.cookie)
+		}
+		if rt.token != "" {
+			r.Header.Set("X-CSRF-Token", rt.token)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("%s: middleware did not reject the request: got %v want %v",
+				rt.name, rr.Code, http.StatusForbidden)
+		}
+
+		if reason != rt.want {
+			t.Fatalf("%s: wrong failure reason: got %v want %v", rt.name, reason, rt.want)
+		}
+	}
+}
+
+// expiredCookie returns a Cookie header value carrying an authentic session
+// token whose securecookie timestamp has long since passed the default MaxAge.
+func expiredCookie(t *testing.T, name string) string {
+	return datedCookie(t, name, time.Now().Add(-2*time.Duration(defaultAge)*time.Second))
+}
+
+// datedCookie returns a CSRF cookie issued at the given time.
+func datedCookie(t *testing.T, name string, issued time.Time) string {
+	realToken, err := generateRandomBytes(tokenLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mirror securecookie's "name|date|value|mac" encoding.
+	value, err := json.Marshal(realToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := issued.Unix()
+	b := []byte(fmt.Sprintf("%s|%d|%s|", name, date,
+		base64.URLEncoding.EncodeToString(value)))
+
+	mac := hmac.New(sha256.New, testKey)
+	mac.Write(b[:len(b)-1])
+	b = append(b, mac.Sum(nil)...)[len(name)+1:]
+
+	return fmt.Sprintf("%s=%s", name, base64.URLEncoding.EncodeToString(b))
+}
+
+// TestValidators checks that additional validators run after the token check
+// and that their errors are reported as the failure reason.
+func TestValidators(t *testing.T) {
+	errEpoch := fmt.Errorf("token from a previous deployment")
+	var calls int
+	epoch := func(r *http.Request) error {
+		calls++
+		if r.Header.Get("X-Epoch") != "2" {
+			return errEpoch
+		}
+		return nil
+	}
+
+	var token string
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	var reason error
+	p := Protect(testKey, Validators(epoch), ErrorHandler(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			reason = FailureReason(r)
+			w.WriteHeader(http.StatusForbidden)
+		})))(s)
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := httptest.NewRecorder()
+	p.ServeHTTP(get, r)
+
+	if calls != 0 {
+		t.Fatalf("validator ran for a safe method: got %d calls", calls)
+	}
+
+	for _, epochHeader := range []string{"1", "2"} {
+		reason = nil
+		r, err := http.NewRequest("POST", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setCookie(get, r)
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("X-Epoch", epochHeader)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		want, wantReason := http.StatusOK, error(nil)
+		if epochHeader == "1" {
+			want, wantReason = http.StatusForbidden, errEpoch
+		}
+
+		if rr.Code != want || reason != wantReason {
+			t.Fatalf("epoch %s: got %v (%v) want %v (%v)",
+				epochHeader, rr.Code, reason, want, wantReason)
+		}
+	}
+
+	// Requests with an invalid token never reach the validators.
+	calls = 0
+	r, err = http.NewRequest("POST", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ServeHTTP(httptest.NewRecorder(), r)
+
+	if calls != 0 {
+		t.Fatalf("validator ran for a request with an invalid token: got %d calls", calls)
+	}
+}
+
+// TestNormalize checks that normalizers run before validation and that the
+// normalized request reaches the wrapped handler.
+func TestNormalize(t *testing.T) {
+	var token, host string
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		host = r.Host
+	})
+
+	lowerHost := func(r *http.Request) *http.Request {
+		r = r.WithContext(r.Context())
+		r.Host = strings.ToLower(r.Host)
+		return r
+	}
+
+	p := Protect(testKey, Normalize(HeaderAlias("X-Legacy-Token", "X-CSRF-Token"), lowerHost))(s)
+
+	r, err := http.NewRequest("GET", "http://WWW.Gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := httptest.NewRecorder()
+	p.ServeHTTP(get, r)
+
+	if host != "www.gorillatoolkit.org" {
+		t.Fatalf("normalized request not passed on: got host %q", host)
+	}
+
+	// A client sending the token under a legacy header name is accepted.
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setCookie(get, r)
+	r.Header.Set("X-Legacy-Token", token)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("aliased header was not accepted: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+// Tests that failures on matched routes are passed to their own error handler.
+func TestErrorHandlerFor(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	p := Protect(testKey, ErrorHandlerFor(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/api/")
+	}, api))(s)
+
+	var routeTests = []struct {
+		path        string
+		contentType string
+	}{
+		{"/api/items", "application/json"},
+		{"/items", "text/plain; charset=utf-8"},
+	}
+
+	for _, rt := range routeTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org"+rt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("%s: middleware failed to reject a request without a token: got %v want %v",
+				rt.path, rr.Code, http.StatusForbidden)
+		}
+
+		if ct := rr.Header().Get("Content-Type"); ct != rt.contentType {
+			t.Fatalf("%s: wrong error handler used: got content type %q want %q",
+				rt.path, ct, rt.contentType)
+		}
+	}
+}
+
+// Tests that EnforceTLS refuses plaintext requests.
+func TestEnforceTLS(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+	p := Protect(testKey, EnforceTLS(true))(s)
+
+	var tlsTests = []struct {
+		url    string
+		code   int
+		cookie bool
+	}{
+		{"http://www.gorillatoolkit.org/", http.StatusForbidden, false},
+		{"https://www.gorillatoolkit.org/", http.StatusOK, true},
+	}
+
+	for _, tt := range tlsTests {
+		r, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != tt.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", tt.url, rr.Code, tt.code)
+		}
+
+		if got := rr.Header().Get("Set-Cookie") != ""; got != tt.cookie {
+			t.Fatalf("%s: cookie issued: got %v want %v", tt.url, got, tt.cookie)
+		}
+	}
+}
+
+// Tests that the Referer check applies to requests SchemeFunc reports as
+// HTTPS.
+func TestSchemeFunc(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, SchemeFunc(func(r *http.Request) string {
+		return r.Header.Get("X-Scheme")
+	}))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var schemeTests = []struct {
+		scheme  string
+		referer string
+		code    int
+	}{
+		{"", "http://golang.org/", http.StatusOK},
+		{"https", "http://golang.org/", http.StatusForbidden},
+		{"https", "https://www.gorillatoolkit.org/", http.StatusOK},
+	}
+
+	for _, st := range schemeTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("X-Scheme", st.scheme)
+		r.Header.Set("Referer", st.referer)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != st.code {
+			t.Fatalf("%+v: wrong status code: got %v want %v", st, rr.Code, st.code)
+		}
+	}
+}
+
+// TestSharedDomain checks that tokens issued on one subdomain verify on a
+// sibling, and that requests from outside the shared domain are rejected.
+func TestSharedDomain(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, SharedDomain("gorillatoolkit.org"))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "https://login.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	if !strings.Contains(cookie, "Domain=gorillatoolkit.org") {
+		t.Fatalf("cookie not scoped to the shared domain: %q", cookie)
+	}
+
+	var domainTests = []struct {
+		url     string
+		referer string
+		code    int
+	}{
+		{"https://app.gorillatoolkit.org/", "https://login.gorillatoolkit.org/", http.StatusOK},
+		{"https://app.gorillatoolkit.org/", "https://gorillatoolkit.org/", http.StatusOK},
+		{"https://app.gorillatoolkit.org/", "http://login.gorillatoolkit.org/", http.StatusForbidden},
+		{"https://app.gorillatoolkit.org/", "https://evilgorillatoolkit.org/", http.StatusForbidden},
+		{"http://app.gorillatoolkit.org/", "", http.StatusForbidden},
+		{"http://app.gorillatoolkit.org/", "http://login.gorillatoolkit.org/", http.StatusOK},
+	}
+
+	for _, dt := range domainTests {
+		r, err := http.NewRequest("POST", dt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Referer", dt.referer)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != dt.code {
+			t.Fatalf("%+v: wrong status code: got %v want %v", dt, rr.Code, dt.code)
+		}
+	}
+}
+
+// TestTrustedOrigins checks that requests with a Referer from a trusted origin
+// are accepted over HTTPS.
+func TestTrustedOrigins(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, TrustedOrigins([]string{"*.example.com"}))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "https://api.example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var originTests = []struct {
+		referer string
+		code    int
+	}{
+		{"https://app.example.com/form", http.StatusOK},
+		{"https://app.example.org/form", http.StatusForbidden},
+	}
+
+	for _, ot := range originTests {
+		r, err := http.NewRequest("POST", "https://api.example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Referer", ot.referer)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != ot.code {
+			t.Fatalf("%+v: wrong status code: got %v want %v", ot, rr.Code, ot.code)
+		}
+	}
+}
+
+// TestSpecificErrors checks that the more specific sentinel errors unwrap to
+// the errors they refine.
+func TestSpecificErrors(t *testing.T) {
+	var errorTests = []struct {
+		err  error
+		less error
+	}{
+		{ErrNoCookie, ErrBadToken},
+		{ErrCookieDecode, ErrBadToken},
+		{ErrBadOrigin, ErrBadReferer},
+	}
+
+	for _, et := range errorTests {
+		u, ok := et.err.(interface{ Unwrap() error })
+		if !ok || u.Unwrap() != et.less {
+			t.Fatalf("%v does not unwrap to %v", et.err, et.less)
+		}
+	}
+}
+
+// TestOriginHeader checks that the Origin header is checked in preference to
+// the Referer.
+func TestOriginHeader(t *testing.T) {
+	s := http.NewServeMux()
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	var reason error
+	p := Protect(testKey, ErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reason = FailureReason(r)
+		w.WriteHeader(http.StatusForbidden)
+	})))(s)
+
+	r, err := http.NewRequest("GET", "https://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var originTests = []struct {
+		origin  string
+		referer string
+		want    error
+	}{
+		{"https://www.gorillatoolkit.org", "", nil},
+		{"https://golang.org", "https://www.gorillatoolkit.org/", ErrBadOrigin},
+		{"null", "https://golang.org/", ErrBadReferer},
+	}
+
+	for _, ot := range originTests {
+		reason = nil
+		r, err := http.NewRequest("POST", "https://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Origin", ot.origin)
+		r.Header.Set("Referer", ot.referer)
+
+		p.ServeHTTP(httptest.NewRecorder(), r)
+
+		if reason != ot.want {
+			t.Fatalf("%+v: wrong failure reason: got %v want %v", ot, reason, ot.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package csrftest provides utilities for testing handlers and clients of
+// the csrf middleware.
+//
+// Mint adds a valid CSRF cookie and token to a request, so that tests of
+// protected endpoints don't have to fetch a form first:
+//
+//	r := httptest.NewRequest("POST", "https://example.com/signup", body)
+//	if _, err := csrftest.Mint(r, authKey); err != nil {
+//		t.Fatal(err)
+//	}
+//	csrf.Protect(authKey)(router).ServeHTTP(rr, r)
+//
+// WithToken sets a known token on a request for handlers tested without the
+// middleware, and Check and ExpectReason report why a request is rejected.
+package csrftest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/csrf/internal/testhook"
+)
+
+// FieldName is the form field name that WithToken reports to TemplateField:
+// the middleware's default.
+const FieldName = "gorilla.csrf.Token"
+
+// Mint issues a CSRF cookie and token with the middleware configured with
+// authKey and opts, and adds them to r: the cookie (and any other cookie the
+// middleware sets, such as the XSRFCookie) to r's Cookie header, and the
+// token to the request header the middleware reads it from. The token is
+// issued against r's CSRF cookie if it already carries a valid one. It
+// returns the token, for tests that submit it some other way, such as in a
+// form field.
+//
+// So that r passes the origin check, an Origin header for the origin r is
+// made to is also added if r carries neither an Origin nor a Referer header.
+func Mint(r *http.Request, authKey []byte, opts ...csrf.Option) (string, error) {
+	var resp csrf.TokenResponse
+	var err error
+	h := csrf.Protect(authKey, opts...)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rr := httptest.NewRecorder()
+		if err = csrf.WriteTokenJSON(rr, req); err == nil {
+			err = json.Unmarshal(rr.Body.Bytes(), &resp)
+		}
+	}))
+
+	get := httptest.NewRequest("GET", r.URL.String(), nil)
+	get.Host = r.Host
+	get.TLS = r.TLS
+	get.Header["Cookie"] = r.Header["Cookie"]
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, get)
+
+	if err != nil {
+		return "", err
+	}
+	if resp.Token == "" {
+		return "", errors.New("csrftest: the middleware issued no token for " + r.URL.String())
+	}
+
+	// Replace any cookies the middleware has replaced.
+	issued := rr.Result().Cookies()
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if !hasCookie(issued, c.Name) {
+			r.AddCookie(c)
+		}
+	}
+	for _, c := range issued {
+		r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+
+	r.Header.Set(resp.Header, resp.Token)
+
+	if r.Header.Get("Origin") == "" && r.Referer() == "" {
+		scheme := "http"
+		if r.TLS != nil || r.URL.Scheme == "https" {
+			scheme = "https"
+		}
+		r.Header.Set("Origin", scheme+"://"+r.Host)
+	}
+
+	return resp.Token, nil
+}
+
+// hasCookie reports whether cookies include one called name.
+func hasCookie(cookies []*http.Cookie, name string) bool {
+	for _, c := range cookies {
+		if c.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithToken returns a shallow copy of r that carries token as if r had been
+// served by the middleware, for testing handlers without it: csrf.Token
+// returns token, and csrf.TemplateField renders it in the FieldName field.
+func WithToken(r *http.Request, token string) *http.Request {
+	return testhook.WithToken(r, token, FieldName)
+}
+
+// Check serves r with the middleware configured with authKey and opts, and
+// returns the reason it failed validation (see csrf.FailureReason), or nil if
+// it passed. ErrorHandlerFor options that match r keep Check from seeing the
+// reason.
+func Check(r *http.Request, authKey []byte, opts ...csrf.Option) error {
+	var reason error
+	capture := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reason = csrf.FailureReason(r)
+	})
+
+	opts = append(opts[:len(opts):len(opts)], csrf.ErrorHandler(capture))
+	csrf.Protect(authKey, opts...)(capture).ServeHTTP(httptest.NewRecorder(), r)
+
+	return reason
+}
+
+// TB is the subset of testing.TB used by ExpectReason.
+type TB interface {
+	Errorf(format string, args ...interface{})
+}
+
+// ExpectReason reports an error to t unless r, served with the middleware
+// configured with authKey and opts, fails validation with the reason want
+// (e.g. csrf.ErrNoToken), or passes it if want is nil.
+func ExpectReason(t TB, want error, r *http.Request, authKey []byte, opts ...csrf.Option) {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if got := Check(r, authKey, opts...); got != want {
+		t.Errorf("csrftest: %s %s: got failure reason %v, want %v", r.Method, r.URL, got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package csrftest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/csrf"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestMint(t *testing.T) {
+	var mintTests = []struct {
+		name string
+		url  string
+		opts []csrf.Option
+	}{
+		{"defaults", "https://www.gorillatoolkit.org/signup", nil},
+		{"plain http", "http://www.gorillatoolkit.org/signup", nil},
+		{"request header", "https://www.gorillatoolkit.org/signup",
+			[]csrf.Option{csrf.RequestHeader("X-Token"), csrf.CookieName("_csrf")}},
+		{"xsrf cookie", "https://www.gorillatoolkit.org/signup",
+			[]csrf.Option{csrf.XSRFCookie("", "")}},
+	}
+
+	for _, mt := range mintTests {
+		r := httptest.NewRequest("POST", mt.url, nil)
+		r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+		if _, err := Mint(r, testKey, mt.opts...); err != nil {
+			t.Fatalf("%s: %v", mt.name, err)
+		}
+
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			t.Errorf("%s: other cookies were not kept: %v", mt.name, r.Header["Cookie"])
+		}
+
+		ExpectReason(t, nil, r, testKey, mt.opts...)
+	}
+}
+
+// TestMintForm checks that a minted token can be submitted in a form field,
+// and that minting again reuses the request's cookie.
+func TestMintForm(t *testing.T) {
+	r := httptest.NewRequest("POST", "https://www.gorillatoolkit.org/", nil)
+	if _, err := Mint(r, testKey); err != nil {
+		t.Fatal(err)
+	}
+	cookie := r.Header.Get("Cookie")
+
+	token, err := Mint(r, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header.Get("Cookie") != cookie {
+		t.Fatalf("cookie replaced: got %q want %q", r.Header.Get("Cookie"), cookie)
+	}
+
+	body := url.Values{"gorilla.csrf.Token": {token}}.Encode()
+	form := httptest.NewRequest("POST", "https://www.gorillatoolkit.org/", strings.NewReader(body))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form.Header.Set("Cookie", cookie)
+	form.Header.Set("Referer", "https://www.gorillatoolkit.org/")
+
+	ExpectReason(t, nil, form, testKey)
+}
+
+func TestWithToken(t *testing.T) {
+	r := WithToken(httptest.NewRequest("GET", "/", nil), "known-token")
+
+	if token := csrf.Token(r); token != "known-token" {
+		t.Fatalf("wrong token: got %q want %q", token, "known-token")
+	}
+
+	field := string(csrf.TemplateField(r))
+	if !strings.Contains(field, `name="gorilla.csrf.Token" value="known-token"`) {
+		t.Fatalf("wrong template field: %s", field)
+	}
+}
+
+// recorder records the errors reported by ExpectReason.
+type recorder struct {
+	errors []string
+}
+
+func (rec *recorder) Errorf(format string, args ...interface{}) {
+	rec.errors = append(rec.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectReason(t *testing.T) {
+	r := httptest.NewRequest("POST", "https://www.gorillatoolkit.org/", nil)
+	ExpectReason(t, csrf.ErrNoReferer, r, testKey)
+
+	r.Header.Set("Referer", "https://www.gorillatoolkit.org/")
+	ExpectReason(t, csrf.ErrNoToken, r, testKey)
+
+	rec := &recorder{}
+	ExpectReason(rec, csrf.ErrBadToken, r, testKey)
+	if len(rec.errors) != 1 || !strings.Contains(rec.errors[0], "want "+csrf.ErrBadToken.Error()) {
+		t.Fatalf("wrong reason not reported: %q", rec.errors)
+	}
+
+	// Requests served in ReportOnly mode report their failures too.
+	if err := Check(r, testKey, csrf.Mode(csrf.ReportOnly)); err != csrf.ErrNoToken {
+		t.Fatalf("wrong reason in ReportOnly mode: got %v want %v", err, csrf.ErrNoToken)
+	}
+}
@@ -0,0 +1,64 @@
+package csrf
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+// deferredScript fetches the token from the deferred token endpoint and fills
+// in the fields rendered by TemplateField and the tag rendered by TemplateMeta. The token is also made available
+// to other scripts as window.csrfToken.
+const deferredScript = `<script>(function(){` +
+	`var endpoint="%s",header="%s";` +
+	`function load(){fetch(endpoint,{credentials:"same-origin",cache:"no-store"})` +
+	`.then(function(res){var token=res.headers.get(header);if(!token){return}` +
+	`window.csrfToken=token;` +
+	`var fields=document.querySelectorAll("input[data-csrf-token]");` +
+	`for(var i=0;i<fields.length;i++){fields[i].value=token}` +
+	`var meta=document.querySelector('meta[name="csrf-token"]');if(meta){meta.content=token}})}` +
+	`if(document.readyState==="loading"){document.addEventListener("DOMContentLoaded",load)}` +
+	`else{load()}})();</script>`
+
+// deferred returns the middleware that served r if it defers token delivery.
+func deferred(r *http.Request) (*csrf, bool) {
+	val, err := contextGet(r, csrfKey)
+	if err != nil {
+		return nil, false
+	}
+
+	cs, ok := val.(*csrf)
+	return cs, ok && cs.opts.DeferredEndpoint != ""
+}
+
+// TemplateScript is a template helper for html/template that provides the
+// <script> that fills in the fields rendered by TemplateField when the
+// DeferredTokens option is set. It renders nothing otherwise.
+func TemplateScript(r *http.Request) template.HTML {
+	cs, ok := deferred(r)
+	if !ok {
+		return template.HTML("")
+	}
+
+	return template.HTML(fmt.Sprintf(deferredScript,
+		template.JSEscapeString(cs.opts.DeferredEndpoint),
+		template.JSEscapeString(cs.opts.RequestHeader)))
+}
+
+// serveDeferredToken responds to a request for the deferred token or renewal
+// endpoint with the request's token in the RequestHeader header.
+func (cs *csrf) serveDeferredToken(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Set(cs.opts.RequestHeader, Token(r))
+	h.Set("Cache-Control", "no-store")
+	addVary(h, "Cookie")
+
+	if cs.opts.ExpiryHeader != "" {
+		if expiry := TokenExpiry(r); !expiry.IsZero() {
+			h.Set(cs.opts.ExpiryHeader, strconv.FormatInt(expiry.Unix(), 10))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests that deferred pages don't embed the token, and that the token is
+// served from the endpoint and accepted.
+func TestDeferredTokens(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(TemplateField(r) + TemplateScript(r)))
+	})
+	p := Protect(testKey, DeferredTokens("/csrf"), CacheControl("no-store"))(s)
+
+	// The page is the same for every user.
+	var pages []string
+	var cookie string
+	for i := 0; i < 2; i++ {
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if cc := rr.Header().Get("Cache-Control"); cc != "" {
+			t.Fatalf("deferred page marked as uncacheable: %q", cc)
+		}
+
+		pages = append(pages, rr.Body.String())
+		cookie = rr.Header().Get("Set-Cookie")
+	}
+
+	if pages[0] != pages[1] {
+		t.Fatalf("deferred pages differ:\n%s\n%s", pages[0], pages[1])
+	}
+
+	for _, want := range []string{`value="" data-csrf-token`, `<script>`, `"/csrf"`} {
+		if !strings.Contains(pages[0], want) {
+			t.Fatalf("deferred page %q does not contain %q", pages[0], want)
+		}
+	}
+
+	// The endpoint serves the token...
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/csrf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Cookie", cookie)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	token := rr.Header().Get("X-CSRF-Token")
+	if rr.Code != http.StatusNoContent || token == "" {
+		t.Fatalf("endpoint did not serve a token: got %v %q", rr.Code, token)
+	}
+
+	if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Fatalf("endpoint response is cacheable: got %q", cc)
+	}
+
+	// ... which is accepted.
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Cookie", cookie)
+	r.Header.Set("X-CSRF-Token", token)
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("deferred token was rejected: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
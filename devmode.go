@@ -0,0 +1,69 @@
+package csrf
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DevMode controls whether requests are treated as local development
+// requests, for which the Secure flag is left off the CSRF cookie and the
+// Referer and EnforceTLS checks are skipped.
+type DevMode int
+
+const (
+	// DevModeOff never treats requests as development requests. This is the
+	// default.
+	DevModeOff DevMode = iota
+	// DevModeAuto treats plaintext requests as development requests if they
+	// are made to a loopback host (e.g. "localhost:8000") from a loopback
+	// address. Requests forwarded by a proxy on the same machine look the
+	// same, so set TrustForwardedProto if the proxy terminates TLS.
+	DevModeAuto
+	// DevModeOn treats every request as a development request. It must never
+	// be enabled in production.
+	DevModeOn
+)
+
+// development reports whether r should be treated as a development request.
+func (cs *csrf) development(r *http.Request) bool {
+	switch cs.opts.DevMode {
+	case DevModeOn:
+		return true
+	case DevModeAuto:
+		return cs.scheme(r) == "http" && isLoopback(r.Host) && isLoopback(r.RemoteAddr)
+	}
+
+	return false
+}
+
+// isDevelopment reports whether the middleware marked r as a development
+// request.
+func isDevelopment(r *http.Request) bool {
+	if r != nil {
+		if val, err := contextGet(r, devKey); err == nil {
+			if dev, ok := val.(bool); ok {
+				return dev
+			}
+		}
+	}
+
+	return false
+}
+
+// isLoopback reports whether hostport (with or without a port) names the
+// local machine.
+func isLoopback(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
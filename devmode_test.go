@@ -0,0 +1,62 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests that only development requests are served without a Secure cookie.
+func TestDevelopment(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+
+	var devTests = []struct {
+		mode       DevMode
+		trust      bool
+		url        string
+		remoteAddr string
+		proto      string
+		dev        bool
+	}{
+		{DevModeOff, false, "http://localhost:8000/", "127.0.0.1:5000", "", false},
+		{DevModeOn, false, "http://www.gorillatoolkit.org/", "192.0.2.1:5000", "", true},
+		{DevModeAuto, false, "http://localhost:8000/", "127.0.0.1:5000", "", true},
+		{DevModeAuto, false, "http://[::1]:8000/", "[::1]:5000", "", true},
+		{DevModeAuto, false, "http://localhost:8000/", "192.0.2.1:5000", "", false},
+		{DevModeAuto, false, "http://www.gorillatoolkit.org/", "127.0.0.1:5000", "", false},
+		{DevModeAuto, false, "https://localhost:8000/", "127.0.0.1:5000", "", false},
+		{DevModeAuto, false, "http://localhost:8000/", "127.0.0.1:5000", "https", true},
+		{DevModeAuto, true, "http://localhost:8000/", "127.0.0.1:5000", "https", false},
+	}
+
+	for _, dt := range devTests {
+		p := Protect(testKey, EnforceTLS(true), Development(dt.mode),
+			TrustForwardedProto(dt.trust))(s)
+
+		r, err := http.NewRequest("GET", dt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.RemoteAddr = dt.remoteAddr
+		if dt.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", dt.proto)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		cookie := rr.Header().Get("Set-Cookie")
+		if dt.dev {
+			if rr.Code != http.StatusOK || strings.Contains(cookie, "Secure") {
+				t.Errorf("%+v: not treated as a development request: got %v %q",
+					dt, rr.Code, cookie)
+			}
+		} else if rr.Code == http.StatusOK && !strings.Contains(cookie, "Secure") {
+			t.Errorf("%+v: treated as a development request: got %v %q",
+				dt, rr.Code, cookie)
+		}
+	}
+}
@@ -140,6 +140,30 @@ providing a JSON API:
 		w.Write(b)
 	}
 
+Login and registration forms need CSRF protection too: without it, an attacker
+can sign a victim into the attacker's own account ("login CSRF"). The
+middleware establishes a CSRF session for anonymous visitors on their first
+request, so csrf.TemplateField works on a login form exactly as it does
+elsewhere. When login happens via a redirect to an identity provider, carry the
+protection through the redirect with csrf.AuthState and check it on return:
+
+	func StartLogin(w http.ResponseWriter, r *http.Request) {
+		// Use the value as the OAuth 2.0 "state" parameter.
+		http.Redirect(w, r, oauthConfig.AuthCodeURL(csrf.AuthState(r)), http.StatusFound)
+	}
+
+	func LoginCallback(w http.ResponseWriter, r *http.Request) {
+		if !csrf.VerifyAuthState(r, r.FormValue("state")) {
+			http.Error(w, "invalid login state", http.StatusForbidden)
+			return
+		}
+		// Exchange the code and establish the user's session.
+	}
+
+Once the visitor has logged in, call csrf.MigrateToken to replace the token
+that was issued to them while anonymous. Requests already in flight with the
+old token are accepted once, so the migration doesn't cause spurious failures.
+
 If you're writing a client that's supposed to mimic browser behavior, make sure to
 send back the CSRF cookie (the default name is _gorilla_csrf, but this can be changed
 with the CookieName Option) along with either the X-CSRF-Token header or the gorilla.csrf.Token form field.
@@ -0,0 +1,154 @@
+package csrf
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Enforcement describes what happens to requests that fail CSRF validation.
+type Enforcement int
+
+const (
+	// Enforce rejects requests that fail validation by calling the
+	// ErrorHandler. This is the default.
+	Enforce Enforcement = iota
+	// ReportOnly records the failure in the request context (see
+	// FailureReason) but otherwise serves the request as if it had passed
+	// validation.
+	ReportOnly
+)
+
+// String returns the name used for e by the Switch admin handler.
+func (e Enforcement) String() string {
+	switch e {
+	case Enforce:
+		return "enforce"
+	case ReportOnly:
+		return "report-only"
+	}
+
+	return "unknown"
+}
+
+// parseEnforcement is the inverse of Enforcement.String.
+func parseEnforcement(s string) (Enforcement, bool) {
+	for _, e := range []Enforcement{Enforce, ReportOnly} {
+		if e.String() == s {
+			return e, true
+		}
+	}
+
+	return Enforce, false
+}
+
+// Switch holds enforcement modes that can be changed while the application is
+// running. Requests are grouped into route classes by a classifier function,
+// and each class can be independently switched between Enforce and
+// ReportOnly. The empty class ("") sets the mode for classes that have not
+// been configured explicitly.
+//
+// A Switch is safe for concurrent use and is attached to the middleware with
+// the EnforcementSwitch option.
+type Switch struct {
+	classify func(r *http.Request) string
+
+	mu    sync.RWMutex
+	modes map[string]Enforcement
+}
+
+// NewSwitch returns a Switch that uses classify to assign requests to route
+// classes - e.g. by path prefix. A nil classify places every request in the
+// default ("") class.
+func NewSwitch(classify func(r *http.Request) string) *Switch {
+	return &Switch{
+		classify: classify,
+		modes:    make(map[string]Enforcement),
+	}
+}
+
+// Set changes the enforcement mode for a route class.
+func (s *Switch) Set(class string, e Enforcement) {
+	s.mu.Lock()
+	s.modes[class] = e
+	s.mu.Unlock()
+}
+
+// Get returns the enforcement mode for a route class, falling back to the
+// default class and then to Enforce.
+func (s *Switch) Get(class string) Enforcement {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if e, ok := s.modes[class]; ok {
+		return e
+	}
+
+	return s.modes[""]
+}
+
+// mode returns the enforcement mode that applies to r.
+func (s *Switch) mode(r *http.Request) Enforcement {
+	var class string
+	if s.classify != nil {
+		class = s.classify(r)
+	}
+
+	return s.Get(class)
+}
+
+// mode returns the enforcement mode that applies to r: the mode set by the
+// EnforcementSwitch, if any, or else by the Mode option.
+func (cs *csrf) mode(r *http.Request) Enforcement {
+	if cs.opts.Enforcement != nil {
+		return cs.opts.Enforcement.mode(r)
+	}
+
+	return cs.opts.Mode
+}
+
+// Handler returns an administrative http.Handler for the Switch. A GET request
+// returns the configured modes as a JSON object, and a POST request with the
+// "class" and "mode" ("enforce" or "report-only") form values changes the mode
+// for that class.
+//
+// Every request must first be approved by authorize (e.g. by checking an admin
+// session or a shared secret); requests are refused with a 403 Forbidden if
+// authorize is nil or returns false. The handler should not be exposed on a
+// public listener.
+func (s *Switch) Handler(authorize func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case "GET", "HEAD":
+		case "POST":
+			e, ok := parseEnforcement(r.PostFormValue("mode"))
+			if !ok {
+				http.Error(w, "invalid mode", http.StatusBadRequest)
+				return
+			}
+
+			s.Set(r.PostFormValue("class"), e)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.mu.RLock()
+		modes := make(map[string]string, len(s.modes))
+		for class, e := range s.modes {
+			modes[class] = e.String()
+		}
+		s.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(modes)
+	})
+}
@@ -0,0 +1,141 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestEnforcementSwitch checks that a route class switched to ReportOnly
+// serves failing requests while recording the failure reason.
+func TestEnforcementSwitch(t *testing.T) {
+	sw := NewSwitch(func(r *http.Request) string {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			return "api"
+		}
+		return ""
+	})
+
+	var reason error
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		reason = FailureReason(r)
+	})
+	p := Protect(testKey, EnforcementSwitch(sw))(s)
+
+	post := func(path string) int {
+		r, err := http.NewRequest("POST", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	if code := post("/api/users"); code != http.StatusForbidden {
+		t.Fatalf("request was not enforced by default: got %v want %v",
+			code, http.StatusForbidden)
+	}
+
+	sw.Set("api", ReportOnly)
+
+	if code := post("/api/users"); code != http.StatusOK {
+		t.Fatalf("report-only class was enforced: got %v want %v", code, http.StatusOK)
+	}
+
+	if reason != ErrNoToken {
+		t.Fatalf("failure reason not recorded in report-only mode: got %v want %v",
+			reason, ErrNoToken)
+	}
+
+	if code := post("/signup"); code != http.StatusForbidden {
+		t.Fatalf("default class was not enforced: got %v want %v",
+			code, http.StatusForbidden)
+	}
+}
+
+// TestSwitchHandler checks that the admin handler is guarded and updates the
+// enforcement mode of a route class.
+// TestMode checks that ReportOnly mode serves failing requests, recording the
+// failure, and that an EnforcementSwitch takes precedence over it.
+func TestMode(t *testing.T) {
+	var kind FailureKind
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind = FailureKindOf(r)
+	})
+
+	var modeTests = []struct {
+		name string
+		opts []Option
+		code int
+	}{
+		{"default", nil, http.StatusForbidden},
+		{"report-only", []Option{Mode(ReportOnly)}, http.StatusOK},
+		{"switch", []Option{Mode(ReportOnly), EnforcementSwitch(NewSwitch(nil))},
+			http.StatusForbidden},
+	}
+
+	for _, mt := range modeTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, mt.opts...)(h).ServeHTTP(rr, r)
+
+		if rr.Code != mt.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", mt.name, rr.Code, mt.code)
+		}
+	}
+
+	if kind != MissingToken {
+		t.Fatalf("failure not recorded in report-only mode: got %v want %v", kind, MissingToken)
+	}
+}
+
+func TestSwitchHandler(t *testing.T) {
+	sw := NewSwitch(nil)
+	admin := false
+	h := sw.Handler(func(r *http.Request) bool { return admin })
+
+	change := func(mode string) int {
+		form := url.Values{"class": {""}, "mode": {mode}}
+		r, err := http.NewRequest("POST", "/admin/csrf", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	if code := change("report-only"); code != http.StatusForbidden {
+		t.Fatalf("unauthorized request was not refused: got %v want %v",
+			code, http.StatusForbidden)
+	}
+
+	if sw.Get("") != Enforce {
+		t.Fatalf("unauthorized request changed the mode: got %v", sw.Get(""))
+	}
+
+	admin = true
+
+	if code := change("sometimes"); code != http.StatusBadRequest {
+		t.Fatalf("invalid mode was accepted: got %v want %v", code, http.StatusBadRequest)
+	}
+
+	if code := change("report-only"); code != http.StatusOK {
+		t.Fatalf("authorized request failed: got %v want %v", code, http.StatusOK)
+	}
+
+	if sw.Get("any") != ReportOnly {
+		t.Fatalf("default class mode not applied: got %v want %v", sw.Get("any"), ReportOnly)
+	}
+}
@@ -0,0 +1,172 @@
+package csrf
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorFormats holds the handlers for requests that fail CSRF validation in
+// each of the formats that NegotiatedErrorHandler chooses between. Any that
+// are nil use the default for their format.
+type ErrorFormats struct {
+	// HTML renders failures for browsers, which accept text/html. By default
+	// a minimal page with the failure reason is served.
+	HTML http.Handler
+	// JSON renders failures for clients that accept application/json (or
+	// another JSON media type), or that don't say what they accept but sent
+	// a JSON body. By default an ErrorResponse is served.
+	JSON http.Handler
+	// Text renders failures for all other clients. By default the failure
+	// reason is served as plain text.
+	Text http.Handler
+}
+
+// ErrorResponse is the JSON body served for failures by the default JSON
+// handler of NegotiatedErrorHandler.
+type ErrorResponse struct {
+	// Error is the text of the status code, e.g. "Forbidden" (see
+	// FailureStatus).
+	Error string `json:"error"`
+	// Reason is the failure reason (see FailureReason).
+	Reason string `json:"reason"`
+	// Kind is the name of the FailureKind, e.g. "token-mismatch".
+	Kind string `json:"kind"`
+}
+
+// NegotiatedErrorHandler returns an http.Handler for requests that fail CSRF
+// validation, which serves HTML, JSON or plain text according to the
+// request's Accept header. It is the default ErrorHandler, with the default
+// formats; use it with the ErrorHandler option to customise the formats:
+//
+//	csrf.ErrorHandler(csrf.NegotiatedErrorHandler(csrf.ErrorFormats{
+//		HTML: errorPage,
+//	}))
+func NegotiatedErrorHandler(f ErrorFormats) http.Handler {
+	if f.HTML == nil {
+		f.HTML = http.HandlerFunc(htmlErrorHandler)
+	}
+	if f.JSON == nil {
+		f.JSON = http.HandlerFunc(jsonErrorHandler)
+	}
+	if f.Text == nil {
+		f.Text = http.HandlerFunc(unauthorizedHandler)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept")
+
+		switch errorFormat(r) {
+		case "html":
+			f.HTML.ServeHTTP(w, r)
+		case "json":
+			f.JSON.ServeHTTP(w, r)
+		default:
+			f.Text.ServeHTTP(w, r)
+		}
+	})
+}
+
+// errorFormat returns the format of the failure response for r: "html",
+// "json" or "text", whichever r's Accept header prefers.
+func errorFormat(r *http.Request) string {
+	format, best := "", 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		var f string
+		switch {
+		case mt == "text/html" || mt == "application/xhtml+xml":
+			f = "html"
+		case isJSON(mt):
+			f = "json"
+		case mt == "text/plain":
+			f = "text"
+		default:
+			continue
+		}
+
+		// The first of equally preferred formats wins.
+		if q > best {
+			format, best = f, q
+		}
+	}
+
+	if format != "" {
+		return format
+	}
+
+	if r.Header.Get("Accept") == "" || r.Header.Get("Accept") == "*/*" {
+		if isJSON(r.Header.Get("Content-Type")) {
+			return "json"
+		}
+	}
+
+	return "text"
+}
+
+// statusText returns the text for a failure status code. Go has none for 419,
+// which frameworks such as Laravel use for expired CSRF tokens.
+func statusText(status int) string {
+	if text := http.StatusText(status); text != "" {
+		return text
+	}
+
+	if status == 419 {
+		return "Page Expired"
+	}
+
+	return "Request Rejected"
+}
+
+// htmlErrorPage is the page served by htmlErrorHandler.
+const htmlErrorPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>%[1]d %[2]s</title></head>
+<body>
+<h1>%[2]s</h1>
+<p>The form could not be verified (%[3]s). Go back, reload the page and try again.</p>
+</body>
+</html>
+`
+
+// htmlErrorHandler serves a minimal HTML page with the failure reason.
+func htmlErrorHandler(w http.ResponseWriter, r *http.Request) {
+	status := FailureStatusOf(r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, htmlErrorPage, status, statusText(status),
+		template.HTMLEscapeString(fmt.Sprint(FailureReason(r))))
+}
+
+// jsonErrorHandler serves an ErrorResponse.
+func jsonErrorHandler(w http.ResponseWriter, r *http.Request) {
+	status := FailureStatusOf(r)
+	resp := ErrorResponse{
+		Error: statusText(status),
+		Kind:  FailureKindOf(r).String(),
+	}
+	if reason := FailureReason(r); reason != nil {
+		resp.Reason = reason.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
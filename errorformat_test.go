@@ -0,0 +1,119 @@
+package csrf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorFormat(t *testing.T) {
+	var formatTests = []struct {
+		accept      string
+		contentType string
+		format      string
+	}{
+		{"", "", "text"},
+		{"*/*", "", "text"},
+		{"", "application/json", "json"},
+		{"*/*", "application/json; charset=utf-8", "json"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", "html"},
+		{"application/json", "", "json"},
+		{"application/problem+json", "", "json"},
+		{"application/json, text/plain, */*", "", "json"},
+		{"text/html;q=0.5, application/json", "", "json"},
+		{"text/plain, text/html;q=0.5", "", "text"},
+		{"text/html, application/json", "", "html"},
+		{"image/png", "application/json", "text"},
+		{"text/html;q=bad, application/json;q=0.1", "", "json"},
+	}
+
+	for _, ft := range formatTests {
+		r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		r.Header.Set("Accept", ft.accept)
+		r.Header.Set("Content-Type", ft.contentType)
+
+		if got := errorFormat(r); got != ft.format {
+			t.Errorf("Accept %q, Content-Type %q: got %q want %q",
+				ft.accept, ft.contentType, got, ft.format)
+		}
+	}
+}
+
+// TestNegotiatedErrorHandler checks the default response in each format.
+func TestNegotiatedErrorHandler(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var handlerTests = []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"text/html", "text/html; charset=utf-8", "<h1>Forbidden</h1>"},
+		{"application/json", "application/json", `"kind":"bad-referer"`},
+		{"", "text/plain; charset=utf-8", "Forbidden - " + ErrNoReferer.Error()},
+	}
+
+	for _, ht := range handlerTests {
+		r := httptest.NewRequest("POST", "https://www.gorillatoolkit.org/", nil)
+		r.Header.Set("Accept", ht.accept)
+
+		rr := httptest.NewRecorder()
+		Protect(testKey)(handler).ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%q: wrong status code: got %v want %v", ht.accept, rr.Code, http.StatusForbidden)
+		}
+
+		if got := rr.Header().Get("Content-Type"); got != ht.contentType {
+			t.Errorf("%q: wrong Content-Type: got %q want %q", ht.accept, got, ht.contentType)
+		}
+
+		if !strings.Contains(rr.Header().Get("Vary"), "Accept") {
+			t.Errorf("%q: Vary header does not include Accept: %q", ht.accept, rr.Header().Get("Vary"))
+		}
+
+		if !strings.Contains(rr.Body.String(), ht.body) {
+			t.Errorf("%q: body %q does not contain %q", ht.accept, rr.Body.String(), ht.body)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "https://www.gorillatoolkit.org/", nil)
+	r.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	Protect(testKey)(handler).ServeHTTP(rr, r)
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ErrorResponse{"Forbidden", ErrNoReferer.Error(), "bad-referer"}
+	if resp != expected {
+		t.Fatalf("wrong JSON response: got %+v want %+v", resp, expected)
+	}
+}
+
+// TestErrorFormats checks that a custom format replaces only its default.
+func TestErrorFormats(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	page := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "custom page", http.StatusForbidden)
+	})
+	h := Protect(testKey, ErrorHandler(NegotiatedErrorHandler(ErrorFormats{HTML: page})))(handler)
+
+	for accept, body := range map[string]string{
+		"text/html":        "custom page",
+		"application/json": `"error":"Forbidden"`,
+	} {
+		r := httptest.NewRequest("POST", "https://www.gorillatoolkit.org/", nil)
+		r.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+
+		if !strings.Contains(rr.Body.String(), body) {
+			t.Errorf("%q: body %q does not contain %q", accept, rr.Body.String(), body)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package csrf
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+)
+
+// pathMatcher matches request paths against an ExemptPaths (or
+// SingleUseTokens) pattern.
+type pathMatcher struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func (m pathMatcher) match(p string) bool {
+	if m.re != nil {
+		return m.re.MatchString(p)
+	}
+
+	ok, _ := path.Match(m.glob, p)
+	return ok
+}
+
+// compilePaths compiles path patterns for the option named by what. Invalid
+// patterns are logged and ignored, so that they never match anything.
+func compilePaths(what string, patterns []string) []pathMatcher {
+	var matchers []pathMatcher
+	for _, pattern := range patterns {
+		if len(pattern) > 0 && pattern[0] == '^' {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				log.Printf("%signoring invalid %s path %q: %v", errorPrefix, what, pattern, err)
+				continue
+			}
+
+			matchers = append(matchers, pathMatcher{re: re})
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Printf("%signoring invalid %s path %q: %v", errorPrefix, what, pattern, err)
+			continue
+		}
+
+		matchers = append(matchers, pathMatcher{glob: pattern})
+	}
+
+	return matchers
+}
+
+// skip reports whether CSRF protection should be skipped for r.
+func (cs *csrf) skip(r *http.Request) bool {
+	// This should always be a bool.
+	if val, err := contextGet(r, skipCheckKey); err == nil {
+		if skip, ok := val.(bool); ok && skip {
+			return true
+		}
+	}
+
+	for _, m := range cs.exempt {
+		if m.match(r.URL.Path) {
+			return true
+		}
+	}
+
+	return cs.opts.SkipFunc != nil && cs.opts.SkipFunc(r)
+}
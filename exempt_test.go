@@ -0,0 +1,74 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Tests that requests for exempt paths bypass validation, and that others
+// don't.
+func TestExemptPaths(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+	p := Protect(testKey, ExemptPaths("/webhooks/*", "/healthz", `^/api/v[0-9]+/hooks$`, "[invalid"))(s)
+
+	var exemptTests = []struct {
+		path string
+		code int
+	}{
+		{"/webhooks/stripe", http.StatusOK},
+		{"/healthz", http.StatusOK},
+		{"/api/v2/hooks", http.StatusOK},
+		{"/webhooks/stripe/events", http.StatusForbidden},
+		{"/api/v2/hooks/x", http.StatusForbidden},
+		{"/healthz/", http.StatusForbidden},
+		{"/[invalid", http.StatusForbidden},
+	}
+
+	for _, et := range exemptTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org"+et.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != et.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", et.path, rr.Code, et.code)
+		}
+	}
+}
+
+// Tests that requests the SkipFunc selects bypass validation.
+func TestSkipFunc(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+	p := Protect(testKey, SkipFunc(func(r *http.Request) bool {
+		return r.Header.Get("X-API-Key") != ""
+	}))(s)
+
+	var skipTests = []struct {
+		key  string
+		code int
+	}{
+		{"secret", http.StatusOK},
+		{"", http.StatusForbidden},
+	}
+
+	for _, st := range skipTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("X-API-Key", st.key)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != st.code {
+			t.Fatalf("%q: wrong status code: got %v want %v", st.key, rr.Code, st.code)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package csrf
+
+import (
+	"net/http"
+)
+
+// TokenExtractor returns the token carried by a request, or "" if it carries
+// none. See WithExtractors.
+type TokenExtractor func(r *http.Request) string
+
+// FromHeader returns a TokenExtractor that reads the token from the named
+// request header.
+func FromHeader(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// FromAuthorization returns a TokenExtractor that reads the token from the
+// Authorization header, if it uses scheme (see AuthorizationScheme).
+func FromAuthorization(scheme string) TokenExtractor {
+	return func(r *http.Request) string {
+		return authorizationToken(r, scheme)
+	}
+}
+
+// FromForm returns a TokenExtractor that reads the token from the named field
+// of a URL-encoded or multipart form body. The body is buffered and restored,
+// so that the handler can still read it.
+func FromForm(field string) TokenExtractor {
+	return func(r *http.Request) string {
+		return formValue(r, field)
+	}
+}
+
+// FromJSON returns a TokenExtractor that reads the token from the named
+// top-level field of a JSON body (see JSONField).
+func FromJSON(field string) TokenExtractor {
+	return func(r *http.Request) string {
+		return jsonToken(r, field)
+	}
+}
+
+// FromQuery returns a TokenExtractor that reads the token from the named query
+// parameter. Tokens in URLs can leak via logs and the Referer header, so only
+// use this where there is no alternative.
+func FromQuery(param string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(param)
+	}
+}
+
+// extractors returns the TokenExtractors to try, in order: those set with
+// WithExtractors or, by default, the request header, the Authorization header
+// and XSRF header (if configured), the JSON body (if configured) and the form.
+func (cs *csrf) extractors() []TokenExtractor {
+	if len(cs.opts.Extractors) > 0 {
+		return cs.opts.Extractors
+	}
+
+	chain := []TokenExtractor{FromHeader(cs.opts.RequestHeader)}
+	if cs.opts.AuthScheme != "" {
+		chain = append(chain, FromAuthorization(cs.opts.AuthScheme))
+	}
+
+	if cs.opts.XSRFHeader != "" {
+		chain = append(chain, FromHeader(cs.opts.XSRFHeader))
+	}
+
+	if cs.opts.JSONField != "" {
+		chain = append(chain, FromJSON(cs.opts.JSONField))
+	}
+
+	return append(chain, FromForm(cs.opts.FieldName))
+}
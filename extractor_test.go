@@ -0,0 +1,66 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWithExtractors(t *testing.T) {
+	var token string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	p := Protect(testKey, WithExtractors(
+		FromHeader("X-API-CSRF"),
+		FromQuery("csrf"),
+		func(r *http.Request) string { return r.Header.Get("X-Custom") },
+	))(h)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var extractorTests = []struct {
+		name   string
+		header string
+		query  string
+		form   string
+		code   int
+	}{
+		{"header", "X-API-CSRF", "", "", http.StatusOK},
+		{"query", "", "?csrf=" + url.QueryEscape(token), "", http.StatusOK},
+		{"custom", "X-Custom", "", "", http.StatusOK},
+		{"default header", "X-CSRF-Token", "", "", http.StatusForbidden},
+		{"form", "", "", fieldName + "=" + url.QueryEscape(token), http.StatusForbidden},
+	}
+
+	for _, et := range extractorTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/"+et.query,
+			strings.NewReader(et.form))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if et.header != "" {
+			r.Header.Set(et.header, token)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != et.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", et.name, rr.Code, et.code)
+		}
+	}
+}
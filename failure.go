@@ -0,0 +1,123 @@
+package csrf
+
+import (
+	"net/http"
+)
+
+// FailureKind classifies why a request failed CSRF validation, so that error
+// handlers can respond differently to, say, an expired session and a token
+// mismatch. See FailureKindOf.
+type FailureKind int
+
+const (
+	// NoFailure is reported for requests that haven't failed validation.
+	NoFailure FailureKind = iota
+	// MissingCookie is reported when the request carried a token but no CSRF
+	// cookie (ErrNoCookie).
+	MissingCookie
+	// MissingToken is reported when the request carried no token
+	// (ErrNoToken).
+	MissingToken
+	// TokenMismatch is reported when the request's token was not issued
+	// against its CSRF cookie (ErrBadToken).
+	TokenMismatch
+	// BadReferer is reported when the request's Origin or Referer was
+	// missing or from another origin (ErrNoReferer, ErrBadReferer,
+	// ErrBadOrigin, ErrCrossSite).
+	BadReferer
+	// DecodeError is reported when the request's token or CSRF cookie
+	// (ErrCookieDecode) could not be decoded or authenticated - e.g. because
+	// it was tampered with or the authentication key changed.
+	DecodeError
+	// ExpiredToken is reported when the request's token was issued against a
+	// session token that has since expired, or has outlived the TokenMaxAge
+	// (ErrTokenExpired).
+	ExpiredToken
+	// OtherFailure is reported for any other failure, such as a failed
+	// Validator. FailureReason returns the error.
+	OtherFailure
+)
+
+// String returns a name for k, suitable for logs and metrics.
+func (k FailureKind) String() string {
+	switch k {
+	case NoFailure:
+		return "none"
+	case MissingCookie:
+		return "missing-cookie"
+	case MissingToken:
+		return "missing-token"
+	case TokenMismatch:
+		return "token-mismatch"
+	case BadReferer:
+		return "bad-referer"
+	case DecodeError:
+		return "decode-error"
+	case ExpiredToken:
+		return "expired-token"
+	}
+
+	return "other"
+}
+
+// FailureKindOf returns the kind of CSRF failure for a request that failed
+// validation, for use within an ErrorHandler (or, in ReportOnly mode, the
+// wrapped handler). It returns NoFailure if the request didn't fail.
+func FailureKindOf(r *http.Request) FailureKind {
+	if val, err := contextGet(r, failureKey); err == nil {
+		if kind, ok := val.(FailureKind); ok {
+			return kind
+		}
+	}
+
+	return NoFailure
+}
+
+// FailureStatusOf returns the status code that requests failing validation
+// should be rejected with, as set by the FailureStatus option, for use within
+// an ErrorHandler. It returns 403 Forbidden if the request didn't fail.
+func FailureStatusOf(r *http.Request) int {
+	if val, err := contextGet(r, statusKey); err == nil {
+		if status, ok := val.(int); ok && status != 0 {
+			return status
+		}
+	}
+
+	return http.StatusForbidden
+}
+
+// failureKind returns the kind of failure reported by reason.
+func failureKind(reason error) FailureKind {
+	switch reason {
+	case ErrNoToken:
+		return MissingToken
+	case ErrBadToken, ErrTokenUsed:
+		return TokenMismatch
+	case ErrNoCookie:
+		return MissingCookie
+	case ErrCookieDecode:
+		return DecodeError
+	case ErrNoReferer, ErrBadReferer, ErrBadOrigin, ErrCrossSite:
+		return BadReferer
+	case ErrTokenExpired:
+		return ExpiredToken
+	}
+
+	return OtherFailure
+}
+
+// mismatchReason returns the reason a token that didn't match the session
+// token failed, given the error (if any) the store returned for the session
+// token the request arrived with.
+func mismatchReason(sessionErr error) error {
+	switch sessionErr {
+	case nil, errSessionChanged:
+		return ErrBadToken
+	case http.ErrNoCookie:
+		return ErrNoCookie
+	case ErrTokenNotFound:
+		return ErrTokenExpired
+	}
+
+	return ErrCookieDecode
+}
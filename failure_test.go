@@ -0,0 +1,119 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests that the error handler can tell the kinds of failure apart.
+func TestFailureKindOf(t *testing.T) {
+	var kind FailureKind
+	s := http.NewServeMux()
+	p := Protect(testKey, ErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind = FailureKindOf(r)
+		w.WriteHeader(http.StatusForbidden)
+	})))(s)
+
+	var token string
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	// issue returns a new CSRF cookie and a token issued against it.
+	issue := func() (string, string) {
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		c := rr.Result().Cookies()[0]
+		return c.Name + "=" + c.Value, token
+	}
+
+	cookie, token := issue()
+	_, otherToken := issue()
+
+	var kindTests = []struct {
+		url     string
+		cookie  string
+		token   string
+		referer string
+		kind    FailureKind
+	}{
+		{"http://www.gorillatoolkit.org/", "", token, "", MissingCookie},
+		{"http://www.gorillatoolkit.org/", cookie, "", "", MissingToken},
+		{"http://www.gorillatoolkit.org/", cookie, otherToken, "", TokenMismatch},
+		{"http://www.gorillatoolkit.org/", cookie, "not-base64!", "", DecodeError},
+		{"http://www.gorillatoolkit.org/", cookie + "x", token, "", DecodeError},
+		{"https://www.gorillatoolkit.org/", cookie, token, "https://golang.org/", BadReferer},
+	}
+
+	for _, kt := range kindTests {
+		r, err := http.NewRequest("POST", kt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", kt.cookie)
+		r.Header.Set("X-CSRF-Token", kt.token)
+		r.Header.Set("Referer", kt.referer)
+
+		kind = NoFailure
+		p.ServeHTTP(httptest.NewRecorder(), r)
+
+		if kind != kt.kind {
+			t.Fatalf("%+v: wrong failure kind: got %v want %v", kt, kind, kt.kind)
+		}
+	}
+}
+
+// TestFailureStatus checks that the default error handler rejects requests
+// with the status set by the FailureStatus option, in each format, and that
+// invalid statuses are ignored.
+func TestFailureStatus(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var statusTests = []struct {
+		status   int
+		accept   string
+		expected int
+	}{
+		{0, "", http.StatusForbidden},
+		{419, "", 419},
+		{http.StatusUnprocessableEntity, "text/html", http.StatusUnprocessableEntity},
+		{http.StatusBadRequest, "application/json", http.StatusBadRequest},
+		{http.StatusOK, "", http.StatusForbidden},
+		{http.StatusInternalServerError, "", http.StatusForbidden},
+	}
+
+	for _, st := range statusTests {
+		r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		r.Header.Set("Accept", st.accept)
+
+		var opts []Option
+		if st.status != 0 {
+			opts = append(opts, FailureStatus(st.status))
+		}
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, opts...)(handler).ServeHTTP(rr, r)
+
+		if rr.Code != st.expected {
+			t.Errorf("%d, %q: wrong status code: got %v want %v", st.status, st.accept, rr.Code, st.expected)
+		}
+
+		if st.status == 419 && !strings.HasPrefix(rr.Body.String(), "Page Expired - ") {
+			t.Errorf("%d: wrong body: %q", st.status, rr.Body.String())
+		}
+	}
+
+	r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if status := FailureStatusOf(r); status != http.StatusForbidden {
+		t.Fatalf("wrong status without the middleware: got %v want %v", status, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,91 @@
+package csrf
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// FetchMetadataMode sets how the middleware uses the Sec-Fetch-Site header
+// (part of Fetch Metadata) on requests with unsafe methods. Browsers set the
+// header on every request, and pages can't override it. Requests without it,
+// from older browsers and from clients other than browsers, are validated as
+// usual in every mode.
+//
+// In each mode, requests that the browser marks "cross-site" or "same-site"
+// are treated as cross-site, unless their Origin header names one of the
+// TrustedOrigins; these still require a valid token.
+type FetchMetadataMode int
+
+const (
+	// FetchMetadataOff ignores the Sec-Fetch-Site header. This is the
+	// default.
+	FetchMetadataOff FetchMetadataMode = iota
+	// FetchMetadataReject rejects cross-site requests with ErrCrossSite, as
+	// defense in depth: all other requests must still carry a valid token.
+	FetchMetadataReject
+	// FetchMetadataFlag marks cross-site requests, which handlers can check
+	// with CrossSite, but otherwise validates them as usual. Use it to find
+	// out what a switch to FetchMetadataReject would reject.
+	FetchMetadataFlag
+	// FetchMetadataStandalone rejects cross-site requests, and accepts
+	// requests that the browser marks "same-origin" (or "none", for requests
+	// the user initiated) without a token. This protects forms and API calls
+	// that can't carry a token, but only from browsers that send the header:
+	// keep issuing tokens for the others.
+	FetchMetadataStandalone
+)
+
+// String returns the name of m.
+func (m FetchMetadataMode) String() string {
+	switch m {
+	case FetchMetadataOff:
+		return "off"
+	case FetchMetadataReject:
+		return "reject"
+	case FetchMetadataFlag:
+		return "flag"
+	case FetchMetadataStandalone:
+		return "standalone"
+	}
+
+	return "unknown"
+}
+
+// fetchSite classifies requests by their Sec-Fetch-Site header.
+type fetchSite int
+
+const (
+	// siteUnknown is a request without a (recognised) header, or from a
+	// trusted origin.
+	siteUnknown fetchSite = iota
+	siteSameOrigin
+	siteCross
+)
+
+// fetchSite returns where the browser says r came from.
+func (cs *csrf) fetchSite(r *http.Request) fetchSite {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return siteSameOrigin
+	case "same-site", "cross-site":
+		if u, err := url.Parse(r.Header.Get("Origin")); err == nil && cs.trustedOrigin(u) {
+			return siteUnknown
+		}
+
+		return siteCross
+	}
+
+	return siteUnknown
+}
+
+// CrossSite reports whether the request was marked as cross-site under
+// FetchMetadataFlag.
+func CrossSite(r *http.Request) bool {
+	if val, err := contextGet(r, crossSiteKey); err == nil {
+		if crossSite, ok := val.(bool); ok {
+			return crossSite
+		}
+	}
+
+	return false
+}
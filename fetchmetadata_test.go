@@ -0,0 +1,76 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestFetchMetadata checks each FetchMetadataMode against the values of the
+// Sec-Fetch-Site header.
+func TestFetchMetadata(t *testing.T) {
+	var token string
+	var crossSite bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		crossSite = CrossSite(r)
+	})
+
+	s := httptest.NewRecorder()
+	Protect(testKey)(handler).ServeHTTP(s, httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil))
+	cookie := s.Header().Get("Set-Cookie")
+	valid := token
+
+	var fetchTests = []struct {
+		mode      FetchMetadataMode
+		site      string
+		origin    string
+		token     string
+		expected  int
+		crossSite bool
+	}{
+		{FetchMetadataOff, "cross-site", "", valid, http.StatusOK, false},
+		{FetchMetadataReject, "cross-site", "", valid, http.StatusForbidden, false},
+		{FetchMetadataReject, "same-site", "", valid, http.StatusForbidden, false},
+		{FetchMetadataReject, "cross-site", "http://app.example.com", valid, http.StatusOK, false},
+		{FetchMetadataReject, "same-origin", "", "", http.StatusForbidden, false},
+		{FetchMetadataReject, "same-origin", "", valid, http.StatusOK, false},
+		{FetchMetadataFlag, "cross-site", "", valid, http.StatusOK, true},
+		{FetchMetadataFlag, "cross-site", "", "", http.StatusForbidden, false},
+		{FetchMetadataStandalone, "same-origin", "", "", http.StatusOK, false},
+		{FetchMetadataStandalone, "none", "", "", http.StatusOK, false},
+		{FetchMetadataStandalone, "cross-site", "", valid, http.StatusForbidden, false},
+		{FetchMetadataStandalone, "", "", "", http.StatusForbidden, false},
+		{FetchMetadataStandalone, "", "", valid, http.StatusOK, false},
+	}
+
+	for _, ft := range fetchTests {
+		r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		r.Header.Set("Cookie", cookie)
+		if ft.site != "" {
+			r.Header.Set("Sec-Fetch-Site", ft.site)
+		}
+		if ft.origin != "" {
+			r.Header.Set("Origin", ft.origin)
+		}
+		if ft.token != "" {
+			r.Header.Set("X-CSRF-Token", ft.token)
+		}
+
+		var reason error
+		p := Protect(testKey, FetchMetadata(ft.mode), TrustedOrigins([]string{"app.example.com"}),
+			ErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reason = FailureReason(r)
+				http.Error(w, "", http.StatusForbidden)
+			})))(handler)
+
+		crossSite = false
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != ft.expected || crossSite != ft.crossSite {
+			t.Errorf("%v, %q, %q: got %v (cross-site %v, %v) want %v (cross-site %v)",
+				ft.mode, ft.site, ft.origin, rr.Code, crossSite, reason, ft.expected, ft.crossSite)
+		}
+	}
+}
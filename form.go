@@ -0,0 +1,150 @@
+package csrf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+// maxFormBytes is the most of a URL-encoded form body that is read in search
+// of a token: net/http doesn't parse larger forms.
+const maxFormBytes = 10 << 20
+
+// defaultMaxBodyBytes is the default MaxBodyBytes limit.
+const defaultMaxBodyBytes = 10 << 20
+
+// bodyLimit returns the MaxBodyBytes limit that applies to r.
+func bodyLimit(r *http.Request) int64 {
+	if val, err := contextGet(r, bodyLimitKey); err == nil && val.(int64) > 0 {
+		return val.(int64)
+	}
+
+	return defaultMaxBodyBytes
+}
+
+// limitBody returns a reader of at most limit bytes of body, or body itself if
+// limit is 0.
+func limitBody(body io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return body
+	}
+
+	return io.LimitReader(body, limit)
+}
+
+// peekBody reads r's body, if it is no larger than limit (when non-zero), and
+// replaces it so that it can be read again. ok is false if the body is
+// missing, too large or can't be read; what was read of it is still restored.
+func peekBody(r *http.Request, limit int64) (body []byte, ok bool) {
+	if r.Body == nil || (limit > 0 && r.ContentLength > limit) {
+		return nil, false
+	}
+
+	// Read a byte past the limit to tell when the body is larger, and put
+	// what was read back in front of the rest of the body.
+	read := limit
+	if limit > 0 {
+		read++
+	}
+	head, err := ioutil.ReadAll(limitBody(r.Body, read))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+
+	return head, err == nil && (limit <= 0 || int64(len(head)) <= limit)
+}
+
+// formValue returns the named field of r's URL-encoded or multipart form body.
+// Unlike r.PostFormValue, it leaves r's body unread: the body is buffered,
+// parsed from a copy and then restored, so that the handler can still stream
+// it. A form that the handler (or earlier middleware) has already parsed is
+// used as-is.
+func formValue(r *http.Request, field string) string {
+	if r.PostForm != nil || r.MultipartForm != nil {
+		if val := r.PostFormValue(field); val != "" {
+			return val
+		}
+
+		if r.MultipartForm != nil {
+			if vals := r.MultipartForm.Value[field]; len(vals) > 0 {
+				return vals[0]
+			}
+		}
+
+		return ""
+	}
+
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mt != "application/x-www-form-urlencoded" && mt != "multipart/form-data") {
+		return ""
+	}
+
+	if mt == "multipart/form-data" {
+		return multipartValue(r, field)
+	}
+
+	limit := bodyLimit(r)
+	if limit > maxFormBytes {
+		limit = maxFormBytes
+	}
+
+	body, ok := peekBody(r, limit)
+	if !ok {
+		return ""
+	}
+
+	// Parse a copy of the request, so that r's form stays unparsed and its
+	// body unread.
+	parsed := new(http.Request)
+	*parsed = *r
+	parsed.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return parsed.PostFormValue(field)
+}
+
+// multipartValue returns the named (non-file) field of r's multipart form
+// body. The body is read only as far as the field, and no further than the
+// first file or the MaxBodyBytes limit, so that a token sent ahead of a large
+// file upload is found without buffering the upload - and a form without one
+// isn't buffered either. What was read is restored as with peekBody.
+func multipartValue(r *http.Request, field string) string {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" || r.Body == nil {
+		return ""
+	}
+
+	var head bytes.Buffer
+	body := r.Body
+	defer func() {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head.Bytes()), body), body}
+	}()
+
+	mr := multipart.NewReader(io.TeeReader(limitBody(body, bodyLimit(r)), &head), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return ""
+		}
+
+		// The token must precede any files.
+		if part.FileName() != "" {
+			return ""
+		}
+
+		if part.FormName() == field {
+			val, err := ioutil.ReadAll(part)
+			if err != nil {
+				return ""
+			}
+
+			return string(val)
+		}
+	}
+}
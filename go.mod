@@ -1,7 +1,6 @@
 module github.com/gorilla/csrf
 
 require (
-	github.com/gorilla/context v1.1.1
 	github.com/gorilla/securecookie v1.1.1
 	github.com/pkg/errors v0.8.0
 )
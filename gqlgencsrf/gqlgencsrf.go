@@ -0,0 +1,143 @@
+// Package gqlgencsrf provides CSRF protection for GraphQL servers built with
+// gqlgen. As every GraphQL operation is sent with the same method to the same
+// endpoint, the CSRF middleware can't tell a query from a mutation; instead,
+// Protect records the outcome of validation, and the Extension rejects the
+// operations that need a token once they have been parsed:
+//
+//	srv := handler.New(generated.NewExecutableSchema(cfg))
+//	srv.AddTransport(transport.POST{})
+//	srv.Use(gqlgencsrf.Extension{})
+//
+//	http.Handle("/graphql", gqlgencsrf.Protect([]byte("32-byte-long-auth-key"))(srv))
+//
+// Queries, including introspection queries from GraphiQL and other tools, are
+// served without a token, while mutations require one. The masked token is
+// added to each response's extensions, so clients such as Apollo Client can
+// read it from any query and send it with mutations in the X-CSRF-Token
+// header.
+package gqlgencsrf
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gorilla/csrf"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// TokenExtension is the key the masked token is added under in response
+// extensions.
+const TokenExtension = "csrfToken"
+
+// ErrorCode is the "code" extension of the error returned for operations that
+// fail validation.
+const ErrorCode = "CSRF_FAILED"
+
+// Protect returns CSRF middleware for the GraphQL endpoint, configured with
+// authKey and opts as csrf.Protect. Failed requests are served in ReportOnly
+// mode, leaving the Extension to reject them; it must not be used for other
+// handlers. Requests that fail validation are still reported to any Metrics
+// or Logger.
+func Protect(authKey []byte, opts ...csrf.Option) func(http.Handler) http.Handler {
+	return csrf.Protect(authKey, append(opts[:len(opts):len(opts)], csrf.Mode(csrf.ReportOnly))...)
+}
+
+// Extension is a gqlgen handler extension that rejects operations that failed
+// CSRF validation in Protect, and adds the token to response extensions. By
+// default only mutations are rejected.
+type Extension struct {
+	// Queries also requires a valid token for queries, other than
+	// introspection queries.
+	Queries bool
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.ResponseInterceptor
+} = Extension{}
+
+// ExtensionName returns the name of the extension.
+func (Extension) ExtensionName() string {
+	return "CSRF"
+}
+
+// Validate implements graphql.HandlerExtension.
+func (Extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptOperation rejects operations that require a token if the request
+// failed validation.
+func (e Extension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	reason := csrf.FailureReason(request(ctx))
+	if reason == nil || !e.protected(graphql.GetOperationContext(ctx).Operation) {
+		return next(ctx)
+	}
+
+	resp := graphql.ErrorResponse(ctx, "CSRF validation failed: %v", reason)
+	resp.Errors[0].Extensions = map[string]interface{}{"code": ErrorCode}
+	addToken(ctx, resp)
+	return graphql.OneShot(resp)
+}
+
+// InterceptResponse adds the token to the response extensions.
+func (Extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	if resp != nil {
+		addToken(ctx, resp)
+	}
+
+	return resp
+}
+
+// protected reports whether op requires a valid token.
+func (e Extension) protected(op *ast.OperationDefinition) bool {
+	if op == nil {
+		return false
+	}
+
+	switch op.Operation {
+	case ast.Mutation:
+		return true
+	case ast.Query:
+		return e.Queries && !introspection(op)
+	}
+
+	return false
+}
+
+// introspection reports whether op only selects introspection fields.
+func introspection(op *ast.OperationDefinition) bool {
+	for _, sel := range op.SelectionSet {
+		field, ok := sel.(*ast.Field)
+		if !ok || !strings.HasPrefix(field.Name, "__") {
+			return false
+		}
+	}
+
+	return len(op.SelectionSet) > 0
+}
+
+// addToken adds the masked token (if any) to the extensions of resp.
+func addToken(ctx context.Context, resp *graphql.Response) {
+	token := csrf.Token(request(ctx))
+	if token == "" {
+		return
+	}
+
+	if resp.Extensions == nil {
+		resp.Extensions = make(map[string]interface{})
+	}
+
+	resp.Extensions[TokenExtension] = token
+}
+
+// request returns a request carrying ctx, for the csrf package's helpers,
+// which only read the request context. gqlgen's HTTP transports execute
+// operations with the request context.
+func request(ctx context.Context) *http.Request {
+	return (&http.Request{}).WithContext(ctx)
+}
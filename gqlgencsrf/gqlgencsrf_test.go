@@ -0,0 +1,113 @@
+package gqlgencsrf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler/testserver"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+type response struct {
+	Errors []struct {
+		Message    string
+		Extensions map[string]interface{}
+	}
+	Extensions map[string]interface{}
+}
+
+// post sends query to h with the given cookie and token, returning the decoded
+// response and any cookie set.
+func post(t *testing.T, h http.Handler, query, cookie, token string) (response, string) {
+	body, _ := json.Marshal(map[string]string{"query": query})
+	r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/graphql", strings.NewReader(string(body)))
+	r.Header.Set("Content-Type", "application/json")
+	if cookie != "" {
+		r.Header.Set("Cookie", cookie)
+	}
+	if token != "" {
+		r.Header.Set("X-CSRF-Token", token)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	var resp response
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response %q: %v", rr.Body.String(), err)
+	}
+
+	return resp, rr.Header().Get("Set-Cookie")
+}
+
+// rejected reports whether resp was rejected for failing CSRF validation.
+func rejected(resp response) bool {
+	return len(resp.Errors) > 0 && resp.Errors[0].Extensions["code"] == ErrorCode
+}
+
+func TestExtension(t *testing.T) {
+	srv := testserver.New()
+	srv.AddTransport(transport.POST{})
+	srv.Use(Extension{})
+	h := Protect(testKey)(srv)
+
+	// Queries are served without a token, and deliver one.
+	resp, cookie := post(t, h, "{ name }", "", "")
+	if len(resp.Errors) > 0 {
+		t.Fatalf("query rejected: %v", resp.Errors[0].Message)
+	}
+
+	token, _ := resp.Extensions[TokenExtension].(string)
+	if token == "" || cookie == "" {
+		t.Fatalf("no token delivered: got %q, %q", token, cookie)
+	}
+
+	var mutationTests = []struct {
+		name     string
+		token    string
+		rejected bool
+	}{
+		{"no token", "", true},
+		{"bad token", "dGVzdA==", true},
+		{"valid token", token, false},
+	}
+
+	for _, mt := range mutationTests {
+		resp, _ := post(t, h, "mutation { name }", cookie, mt.token)
+		if rejected(resp) != mt.rejected {
+			t.Errorf("%s: got rejected %v want %v (%v)", mt.name, rejected(resp), mt.rejected, resp.Errors)
+		}
+
+		if resp.Extensions[TokenExtension] == nil {
+			t.Errorf("%s: no token delivered", mt.name)
+		}
+	}
+}
+
+func TestExtensionQueries(t *testing.T) {
+	srv := testserver.New()
+	srv.AddTransport(transport.POST{})
+	srv.Use(Extension{Queries: true})
+	h := Protect(testKey)(srv)
+
+	var queryTests = []struct {
+		query    string
+		rejected bool
+	}{
+		{"{ name }", true},
+		{"{ __schema { queryType { name } } }", false},
+		{"{ __typename }", false},
+	}
+
+	for _, qt := range queryTests {
+		resp, _ := post(t, h, qt.query, "", "")
+		if rejected(resp) != qt.rejected {
+			t.Errorf("%s: got rejected %v want %v", qt.query, rejected(resp), qt.rejected)
+		}
+	}
+}
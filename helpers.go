@@ -1,21 +1,33 @@
 package csrf
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
 	"html/template"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Token returns a masked CSRF token ready for passing into HTML template or
 // a JSON response body. An empty token will be returned if the middleware
 // has not been applied (which will fail subsequent validation).
+//
+// The token is masked once per request, so repeated calls - and the fields
+// rendered by TemplateField for each form on a page - share the same token.
 func Token(r *http.Request) string {
 	if val, err := contextGet(r, tokenKey); err == nil {
 		if maskedToken, ok := val.(string); ok {
+			markTokenUsed(r)
 			return maskedToken
 		}
 	}
@@ -23,9 +35,66 @@ func Token(r *http.Request) string {
 	return ""
 }
 
+// TokenExpiry returns the time at which the token returned by Token(r) stops
+// being accepted, so that clients can fetch a fresh token before it expires
+// rather than reacting to a failed request: when the CSRF cookie expires, or
+// the token outlives the TokenMaxAge, whichever is sooner. The zero time is
+// returned if the token doesn't expire (MaxAge and TokenMaxAge are 0) or the
+// request wasn't served by the CSRF middleware.
+func TokenExpiry(r *http.Request) time.Time {
+	val, err := contextGet(r, csrfKey)
+	if err != nil {
+		return time.Time{}
+	}
+	cs := val.(*csrf)
+
+	expiry := cookieExpiry(r, cs)
+
+	// The token was issued while serving this request.
+	if cs.opts.TokenMaxAge > 0 {
+		if stamped := time.Now().Add(cs.opts.TokenMaxAge); expiry.IsZero() || stamped.Before(expiry) {
+			return stamped
+		}
+	}
+
+	return expiry
+}
+
+// cookieExpiry returns the time at which the request's session token expires,
+// or the zero time if it doesn't.
+func cookieExpiry(r *http.Request, cs *csrf) time.Time {
+	if cs.opts.MaxAge <= 0 {
+		return time.Time{}
+	}
+
+	maxAge := time.Duration(cs.opts.MaxAge) * time.Second
+
+	// A token issued by MigrateToken.
+	if val, err := contextGet(r, issuedKey); err == nil {
+		if issued, ok := val.(time.Time); ok {
+			return issued.Add(maxAge)
+		}
+	}
+
+	// A token from the request's cookie.
+	if st, ok := cs.st.(*cookieStore); ok {
+		if issued, ok := st.issued(r); ok {
+			return issued.Add(maxAge)
+		}
+	}
+
+	// Otherwise the token was issued while serving this request.
+	return time.Now().Add(maxAge)
+}
+
 // FailureReason makes CSRF validation errors available in the request context.
 // This is useful when you want to log the cause of the error or report it to
 // client.
+//
+// The returned error can be compared against the package's sentinel errors to
+// tell a request that carried no token (ErrNoToken) apart from one whose token
+// didn't verify (ErrBadToken) or was issued against an expired session
+// (ErrTokenExpired). FailureKindOf classifies the failure in more detail.
 func FailureReason(r *http.Request) error {
 	if val, err := contextGet(r, errorKey); err == nil {
 		if err, ok := val.(error); ok {
@@ -57,15 +126,209 @@ func UnsafeSkipCheck(r *http.Request) *http.Request {
 //      // ... becomes:
 //      <input type="hidden" name="gorilla.csrf.Token" value="<token>">
 //
+// If the Honeypot option is set, a hidden decoy field is appended to the
+// <input> field. If the DeferredTokens option is set, the field is left empty
+// for TemplateScript to fill in.
 func TemplateField(r *http.Request) template.HTML {
+	return template.HTML(TemplateFieldString(r))
+}
+
+// TemplateFieldString returns the markup of TemplateField as a plain string,
+// for template engines other than html/template - see the templatecsrf
+// packages for helpers that return the safe-HTML types of popular engines. The
+// markup must be output without escaping.
+func TemplateFieldString(r *http.Request) string {
+	return templateField(r, FieldAttrs{})
+}
+
+// FieldAttrs are extra attributes for the <input> field rendered by
+// TemplateFieldWithAttrs.
+type FieldAttrs struct {
+	// ID is the field's id attribute, e.g. for scripts to find and refresh the
+	// token after navigating with fetch.
+	ID string
+	// Data holds data-* attributes, keyed by their names without the "data-"
+	// prefix. Keys other than lower-case letters, digits, '-', '_' and '.'
+	// are ignored.
+	Data map[string]string
+	// OmitName leaves out the name attribute, so that the field is not
+	// submitted with its form. Scripts can still read the token from it.
+	OmitName bool
+}
+
+// TemplateFieldWithAttrs is TemplateField with the extra attributes in attrs.
+//
+// Example:
+//
+//	csrf.TemplateFieldWithAttrs(r, csrf.FieldAttrs{ID: "csrf-token"})
+//
+//	// ... becomes:
+//	<input type="hidden" name="gorilla.csrf.Token" value="<token>" id="csrf-token">
+func TemplateFieldWithAttrs(r *http.Request, attrs FieldAttrs) template.HTML {
+	return template.HTML(templateField(r, attrs))
+}
+
+// templateField returns the markup for TemplateField with the extra
+// attributes in attrs.
+func templateField(r *http.Request, attrs FieldAttrs) string {
 	if name, err := contextGet(r, formKey); err == nil {
-		fragment := fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
-			name, Token(r))
+		var extra string
+		if attrs.ID != "" {
+			extra += fmt.Sprintf(` id="%s"`, template.HTMLEscapeString(attrs.ID))
+		}
+
+		keys := make([]string, 0, len(attrs.Data))
+		for key := range attrs.Data {
+			if validDataKey(key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			extra += fmt.Sprintf(` data-%s="%s"`, key, template.HTMLEscapeString(attrs.Data[key]))
+		}
+
+		nameAttr := fmt.Sprintf(` name="%s"`, name)
+		if attrs.OmitName {
+			nameAttr = ""
+		}
+
+		var fragment string
+		if _, ok := deferred(r); ok {
+			fragment = fmt.Sprintf(`<input type="hidden"%s value="" data-csrf-token%s>`,
+				nameAttr, extra)
+		} else {
+			fragment = fmt.Sprintf(`<input type="hidden"%s value="%s"%s>`,
+				nameAttr, Token(r), extra)
+		}
+
+		if honeypot, err := contextGet(r, honeypotKey); err == nil {
+			fragment += fmt.Sprintf(`<input type="text" name="%s" value="" `+
+				`tabindex="-1" autocomplete="off" aria-hidden="true" style="display:none">`,
+				honeypot)
+		}
+
+		return fragment
+	}
+
+	return ""
+}
+
+// validDataKey reports whether key can be used as the name of a data-*
+// attribute.
+func validDataKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for _, c := range key {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// TemplateMeta is a template helper for html/template that provides a <meta>
+// tag populated with a CSRF token, for scripts on the page to read and send
+// back in the X-CSRF-Token request header (or the header set with the
+// RequestHeader option). The tag follows the Rails convention, which many
+// JavaScript libraries already understand:
+//
+//	<meta name="csrf-token" content="<token>">
+//
+//	fetch("/api/items", {
+//		method: "POST",
+//		headers: {"X-CSRF-Token": document.querySelector('meta[name="csrf-token"]').content},
+//		body: ...
+//	})
+//
+// If the DeferredTokens option is set, the tag is left empty for TemplateScript
+// to fill in. An empty string is returned if the middleware has not been
+// applied.
+func TemplateMeta(r *http.Request) template.HTML {
+	if _, err := contextGet(r, tokenKey); err != nil {
+		return template.HTML("")
+	}
+
+	var token string
+	if _, ok := deferred(r); !ok {
+		token = Token(r)
+	}
+
+	return template.HTML(fmt.Sprintf(`<meta name="csrf-token" content="%s">`, token))
+}
+
+// AuthState returns a value bound to the visitor's CSRF session, for carrying
+// CSRF protection through an authentication redirect - e.g. as the OAuth 2.0
+// or OpenID Connect "state" parameter, or alongside a return-to URL. It works
+// for anonymous visitors, as the CSRF session is established before login.
+//
+// On return from the identity provider, check the value with VerifyAuthState
+// before completing the login, to prevent login CSRF. Unlike Token, the value
+// is not a CSRF token and can't be used to forge other requests if it leaks
+// via logs or the Referer header. An empty string will be returned if the
+// middleware has not been applied.
+func AuthState(r *http.Request) string {
+	realToken := baseToken(r)
+	if realToken == nil {
+		return ""
+	}
+
+	nonce, err := generateRandomBytes(authStateLength)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(
+		append(nonce, authStateMAC(realToken, nonce)...))
+}
+
+// VerifyAuthState reports whether state was returned by AuthState for the
+// same visitor's CSRF session.
+func VerifyAuthState(r *http.Request, state string) bool {
+	realToken := baseToken(r)
+	if realToken == nil {
+		return false
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(state)
+	if err != nil || len(decoded) <= authStateLength {
+		return false
+	}
+
+	nonce, mac := decoded[:authStateLength], decoded[authStateLength:]
+	return hmac.Equal(mac, authStateMAC(realToken, nonce))
+}
 
-		return template.HTML(fragment)
+// authStateLength is the length in bytes of the nonce in an AuthState value.
+const authStateLength = 16
+
+// authStateMAC binds an AuthState nonce to the real token.
+func authStateMAC(realToken, nonce []byte) []byte {
+	return deriveToken(realToken, append([]byte("auth-state|"), nonce...))
+}
+
+// deriveToken returns a value derived from the real token for a specific
+// purpose, identified by label. Derived values can't be used to recover the
+// real token.
+func deriveToken(realToken, label []byte) []byte {
+	h := hmac.New(sha256.New, realToken)
+	h.Write(label)
+	return h.Sum(nil)
+}
+
+// baseToken returns the real (unmasked) token from the request context, or
+// nil if the middleware has not been applied.
+func baseToken(r *http.Request) []byte {
+	if val, err := contextGet(r, baseTokenKey); err == nil {
+		if realToken, ok := val.([]byte); ok {
+			return realToken
+		}
 	}
 
-	return template.HTML("")
+	return nil
 }
 
 // mask returns a unique-per-request token to mitigate the BREACH attack
@@ -75,18 +338,42 @@ func TemplateField(r *http.Request) template.HTML {
 // token and returning them together as a 64-byte slice. This effectively
 // randomises the token on a per-request basis without breaking multiple browser
 // tabs/windows.
-func mask(realToken []byte, r *http.Request) string {
-	otp, err := generateRandomBytes(tokenLength)
+//
+// The pad, masked token, timestamp and their encoding are built in fixed-size
+// buffers on the stack, so that the returned string is the only allocation.
+func (cs *csrf) mask(realToken []byte) (string, error) {
+	var buf [maxIssuedLength]byte
+	otp := buf[:tokenLength]
+
+	// Reads from the random source go through an interface, which would move
+	// buf to the heap: read into a pooled buffer instead.
+	pad := padBuffers.Get().(*[tokenLength]byte)
+	err := cs.fillRandom(pad[:])
+	copy(otp, pad[:])
+	padBuffers.Put(pad)
 	if err != nil {
-		return ""
+		return "", err
 	}
 
-	// XOR the OTP with the real token to generate a masked token. Append the
-	// OTP to the front of the masked token to allow unmasking in the subsequent
-	// request.
-	return base64.StdEncoding.EncodeToString(append(otp, xorToken(otp, realToken)...))
+	// XOR the OTP with the real token to generate a masked token, following
+	// the OTP to allow unmasking in the subsequent request.
+	n := xorBytes(buf[tokenLength:tokenLength*2], otp, realToken)
+	issued := cs.stamp(buf[:tokenLength+n])
+
+	var encoded [(maxIssuedLength + 2) / 3 * 4]byte
+	base64.StdEncoding.Encode(encoded[:], issued)
+	return string(encoded[:base64.StdEncoding.EncodedLen(len(issued))]), nil
+}
+
+// padBuffers holds the buffers that mask reads one-time pads into.
+var padBuffers = sync.Pool{
+	New: func() interface{} { return new([tokenLength]byte) },
 }
 
+// maxIssuedLength is the length of the longest issued token: a pad, a masked
+// token and a timestamp.
+const maxIssuedLength = tokenLength*2 + stampLength
+
 // unmask splits the issued token (one-time-pad + masked token) and returns the
 // unmasked request token for comparison.
 func unmask(issued []byte) []byte {
@@ -104,48 +391,238 @@ func unmask(issued []byte) []byte {
 }
 
 // requestToken returns the issued token (pad + masked token) from the HTTP POST
-// body or HTTP header. It will return nil if the token fails to decode.
-func (cs *csrf) requestToken(r *http.Request) []byte {
-	// 1. Check the HTTP header first.
-	issued := r.Header.Get(cs.opts.RequestHeader)
-
-	// 2. Fall back to the POST (form) value.
-	if issued == "" {
-		issued = r.PostFormValue(cs.opts.FieldName)
+// body or HTTP header. It returns ErrNoToken if the request does not carry a
+// token, ErrBadToken if the token fails to decode, and ErrTokenExpired if it
+// has outlived the TokenMaxAge.
+func (cs *csrf) requestToken(r *http.Request) ([]byte, error) {
+	var issued string
+	for _, extract := range cs.extract {
+		if issued = extract(r); issued != "" {
+			break
+		}
 	}
 
-	// 3. Finally, fall back to the multipart form (if set).
-	if issued == "" && r.MultipartForm != nil {
-		vals := r.MultipartForm.Value[cs.opts.FieldName]
-
-		if len(vals) > 0 {
-			issued = vals[0]
-		}
+	if issued == "" {
+		return nil, ErrNoToken
 	}
 
-	// Decode the "issued" (pad + masked) token sent in the request. Return a
-	// nil byte slice on a decoding error (this will fail upstream).
+	// Decode the "issued" (pad + masked) token sent in the request.
 	decoded, err := base64.StdEncoding.DecodeString(issued)
 	if err != nil {
-		return nil
+		return nil, ErrBadToken
+	}
+
+	return cs.checkStamp(decoded)
+}
+
+// authorizationToken returns the credentials of r's Authorization header if it
+// uses scheme, which is matched case-insensitively.
+func authorizationToken(r *http.Request, scheme string) string {
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(auth) <= len(scheme) || !strings.EqualFold(auth[:len(scheme)], scheme) ||
+		auth[len(scheme)] != ' ' {
+		return ""
 	}
 
-	return decoded
+	return strings.TrimSpace(auth[len(scheme):])
 }
 
 // generateRandomBytes returns securely generated random bytes.
 // It will return an error if the system's secure random number generator
 // fails to function correctly.
 func generateRandomBytes(n int) ([]byte, error) {
+	return readRandom(rand.Reader, n)
+}
+
+// readRandom returns n bytes read from random, the middleware's source of
+// random bytes (crypto/rand unless replaced by tests).
+func readRandom(random io.Reader, n int) ([]byte, error) {
 	b := make([]byte, n)
-	_, err := rand.Read(b)
-	// err == nil only if len(b) == n
-	if err != nil {
+	if err := readRandomFrom(random, b); err != nil {
 		return nil, err
 	}
 
 	return b, nil
+}
+
+// readRandomBytes fills b with securely generated random bytes.
+func readRandomBytes(b []byte) error {
+	return readRandomFrom(rand.Reader, b)
+}
+
+// readRandomFrom fills b with bytes read from random.
+func readRandomFrom(random io.Reader, b []byte) error {
+	// Read via io.ReadFull rather than rand.Read, which aborts the process on
+	// failure and would leave the FailurePolicy with nothing to act on.
+	_, err := io.ReadFull(random, b)
+	// err == nil only if all of b was read
+	return err
+}
+
+// requestHost returns the lower-cased host of the request, without any port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(host)
+}
+
+// scheme returns the scheme ("http" or "https") the request was made with.
+func (cs *csrf) scheme(r *http.Request) string {
+	if cs.opts.SchemeFunc != nil {
+		if scheme := strings.ToLower(cs.opts.SchemeFunc(r)); scheme != "" {
+			return scheme
+		}
+	}
+
+	if r.TLS != nil || r.URL.Scheme == "https" {
+		return "https"
+	}
+
+	// Only believe X-Forwarded-Proto if a trusted proxy is known to set it.
+	if cs.opts.TrustForwarded || cs.trustedProxy(r) {
+		if proto, _ := forwarded(r); proto == "https" {
+			return "https"
+		}
+	}
+
+	return "http"
+}
+
+// origin returns the origin the request was made to.
+func (cs *csrf) origin(r *http.Request) *url.URL {
+	host := r.URL.Host
+	if host == "" {
+		host = r.Host
+	}
+
+	// A trusted proxy reports the host the client asked for.
+	if cs.trustedProxy(r) {
+		if _, fwdHost := forwarded(r); fwdHost != "" {
+			host = fwdHost
+		}
+	}
+
+	return &url.URL{Scheme: cs.scheme(r), Host: host}
+}
 
+// addVary adds name to the Vary header in h, unless it is already listed.
+func addVary(h http.Header, name string) {
+	for _, v := range h["Vary"] {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", name)
+}
+
+// trustedOrigin reports whether the origin of u matches one of the
+// TrustedOrigins.
+func (cs *csrf) trustedOrigin(u *url.URL) bool {
+	for _, trusted := range cs.opts.TrustedOrigins {
+		if matchOrigin(trusted, u) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchOrigin reports whether the origin of u matches pattern: an origin
+// ("https://app.example.com") or a host ("app.example.com"), either of which
+// may start with a "*." wildcard that matches any subdomain.
+func matchOrigin(pattern string, u *url.URL) bool {
+	pattern = strings.ToLower(pattern)
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		if pattern[:i] != strings.ToLower(u.Scheme) {
+			return false
+		}
+		pattern = pattern[i+3:]
+	}
+
+	host := strings.ToLower(u.Host)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+
+	return host == pattern
+}
+
+// checkOrigin checks the Origin header, and the Referer header, of a request r
+// made to the origin self according to the OriginMode. It returns
+// ErrBadOrigin, ErrNoReferer or ErrBadReferer if the request may have been
+// forged. r is nil for checks made by Tokens.
+func (cs *csrf) checkOrigin(r *http.Request, self *url.URL, origin, referer string) error {
+	// Enforce an origin check for HTTPS connections. As per the Django CSRF
+	// implementation (https://goo.gl/vKA7GE) the Referer header is almost
+	// always present for same-domain HTTP requests. A cookie shared with
+	// sibling subdomains is exposed to each of them, so the check applies to
+	// plain HTTP too in that case.
+	strict := self.Scheme == "https" || cs.opts.SharedDomain != ""
+	mode := cs.opts.OriginMode
+
+	// Prefer the Origin header where the browser sent one, as it isn't
+	// subject to the Referrer-Policy.
+	hasOrigin := origin != "" && origin != "null"
+	if hasOrigin && (strict || mode == OriginOnly) {
+		u, err := url.Parse(origin)
+		if err != nil || !cs.allowedOrigin(r, self, u) {
+			return ErrBadOrigin
+		}
+	}
+
+	if !strict || mode == OriginOnly ||
+		(hasOrigin && (mode == OriginOrReferer || referer == "")) {
+		return nil
+	}
+
+	// Fetch the Referer value. Fail if it's empty or otherwise fails to
+	// parse.
+	u, err := url.Parse(referer)
+	if err != nil || u.String() == "" {
+		return ErrNoReferer
+	}
+
+	if !cs.allowedOrigin(r, self, u) {
+		return ErrBadReferer
+	}
+
+	return nil
+}
+
+// allowedOrigin reports whether requests with unsafe methods from the origin
+// of u are allowed: it is the origin self that r was made to, a trusted
+// origin, a sibling origin under SharedDomain or an origin allowed by the
+// WithOriginCheck function.
+func (cs *csrf) allowedOrigin(r *http.Request, self, u *url.URL) bool {
+	return sameOrigin(self, u) || cs.trustedOrigin(u) || cs.siblingOrigin(self, u) ||
+		(cs.opts.OriginFunc != nil && cs.opts.OriginFunc(r, u))
+}
+
+// siblingOrigin reports whether u is an origin on a subdomain of the
+// SharedDomain, reached with the same scheme as self.
+func (cs *csrf) siblingOrigin(self, u *url.URL) bool {
+	if cs.opts.SharedDomain == "" || u.Scheme != self.Scheme {
+		return false
+	}
+
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return inDomain(strings.ToLower(host), cs.opts.SharedDomain)
+}
+
+// inDomain reports whether host is domain or one of its subdomains.
+func inDomain(host, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
 }
 
 // sameOrigin returns true if URLs a and b share the same origin. The same
@@ -185,6 +662,24 @@ func xorToken(a, b []byte) []byte {
 	return res
 }
 
+// xorBytes sets dst[i] to a[i] ^ b[i] for as many bytes as all three slices
+// hold, and returns that number.
+func xorBytes(dst, a, b []byte) int {
+	n := len(dst)
+	if len(a) < n {
+		n = len(a)
+	}
+	if len(b) < n {
+		n = len(b)
+	}
+
+	for i := 0; i < n; i++ {
+		dst[i] = a[i] ^ b[i]
+	}
+
+	return n
+}
+
 // contains is a helper function to check if a string exists in a slice - e.g.
 // whether a HTTP method exists in a list of safe methods.
 func contains(vals []string, s string) bool {
@@ -197,6 +692,12 @@ func contains(vals []string, s string) bool {
 	return false
 }
 
+// safe reports whether r's method is one of the SafeMethods, which are not
+// validated.
+func (cs *csrf) safe(r *http.Request) bool {
+	return contains(cs.opts.SafeMethods, r.Method)
+}
+
 // envError stores a CSRF error in the request context.
 func envError(r *http.Request, err error) *http.Request {
 	return contextSave(r, errorKey, err)
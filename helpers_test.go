@@ -2,17 +2,19 @@ package csrf
 
 import (
 	"bytes"
-	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 	"text/template"
+	"time"
 )
 
 var testTemplate = `
@@ -120,6 +122,282 @@ func TestMultipartFormToken(t *testing.T) {
 	}
 }
 
+// Test that looking for a form token leaves the body unread for the handler.
+func TestFormTokenBodyPreserved(t *testing.T) {
+	var token, body string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		if r.Body != nil {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+		}
+	})
+	p := Protect(testKey)(h)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	var b bytes.Buffer
+	mp := multipart.NewWriter(&b)
+	mp.WriteField(fieldName, token)
+	mp.WriteField("upload", "streamed data")
+	mp.Close()
+	sent := b.String()
+
+	var formTests = []struct {
+		contentType string
+		body        string
+	}{
+		{"application/x-www-form-urlencoded", fieldName + "=" + url.QueryEscape(token) + "&a=b"},
+		{mp.FormDataContentType(), sent},
+	}
+
+	for _, ft := range formTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", strings.NewReader(ft.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Content-Type", ft.contentType)
+		setCookie(rr, r)
+
+		rr := httptest.NewRecorder()
+		body = ""
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: middleware failed to pass to the next handler: got %v want %v",
+				ft.contentType, rr.Code, http.StatusOK)
+		}
+
+		if body != ft.body {
+			t.Fatalf("%s: body not preserved: got %q want %q", ft.contentType, body, ft.body)
+		}
+	}
+}
+
+// Test that bodies over the MaxBodyBytes limit aren't searched for a token.
+func TestMaxBodyBytes(t *testing.T) {
+	var token, body string
+	var reason error
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		reason = FailureReason(r)
+		if r.Body != nil {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+		}
+	})
+	p := Protect(testKey, MaxBodyBytes(128), ErrorHandler(h))(h)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	form := fieldName + "=" + url.QueryEscape(token)
+	var limitTests = []struct {
+		body   string
+		length int64
+		reason error
+	}{
+		{form, int64(len(form)), nil},
+		{form + "&pad=" + strings.Repeat("x", 128), int64(len(form)) + 133, ErrNoToken},
+		// A body that is longer than it claims is still cut off.
+		{form + "&pad=" + strings.Repeat("x", 128), -1, ErrNoToken},
+	}
+
+	for _, lt := range limitTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", strings.NewReader(lt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ContentLength = lt.length
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Cookie", cookie)
+
+		body = ""
+		p.ServeHTTP(httptest.NewRecorder(), r)
+
+		if reason != lt.reason {
+			t.Fatalf("%d byte body: wrong failure reason: got %v want %v", len(lt.body), reason, lt.reason)
+		}
+
+		if body != lt.body {
+			t.Fatalf("%d byte body: body not preserved", len(lt.body))
+		}
+	}
+}
+
+// Test that bodies over the default MaxBodyBytes limit aren't searched.
+func TestDefaultMaxBodyBytes(t *testing.T) {
+	var token string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+	p := Protect(testKey, JSONField("csrf_token"))(h)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	body := `{"upload": "` + strings.Repeat("x", defaultMaxBodyBytes) + `", "csrf_token": "` + token + `"}`
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Cookie", cookie)
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("large body searched: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// Test that a multipart upload without a token ahead of its files isn't
+// buffered in search of one.
+func TestMultipartUploadNotBuffered(t *testing.T) {
+	p := Protect(testKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var head, tail bytes.Buffer
+	mp := multipart.NewWriter(&head)
+	mp.WriteField("name", "upload")
+	if _, err := mp.CreateFormFile("upload", "upload.bin"); err != nil {
+		t.Fatal(err)
+	}
+	boundary := mp.Boundary()
+	mp = multipart.NewWriter(&tail)
+	mp.SetBoundary(boundary)
+	mp.Close()
+
+	const uploadSize = 64 << 20
+	body := &countingReader{r: io.MultiReader(&head,
+		io.LimitReader(zeroReader{}, uploadSize), &tail)}
+
+	r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", mp.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("tokenless upload was accepted: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	if body.n > 1<<20 {
+		t.Fatalf("upload was buffered: read %d bytes", body.n)
+	}
+}
+
+// zeroReader reads an endless stream of zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// Test that a multipart body is read only as far as the token, so that a
+// token sent ahead of an upload over the MaxBodyBytes limit is found.
+func TestMultipartTokenBeforeUpload(t *testing.T) {
+	var token, body string
+	var reason error
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		reason = FailureReason(r)
+		if r.Body != nil {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+		}
+	})
+	p := Protect(testKey, MaxBodyBytes(512), ErrorHandler(h))(h)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+	issued := token
+
+	upload := strings.Repeat("x", 1024)
+	var uploadTests = []struct {
+		name   string
+		fields [][2]string
+		reason error
+	}{
+		{"token first", [][2]string{{fieldName, issued}, {"upload", upload}}, nil},
+		{"token last", [][2]string{{"upload", upload}, {fieldName, issued}}, ErrNoToken},
+	}
+
+	for _, ut := range uploadTests {
+		var b bytes.Buffer
+		mp := multipart.NewWriter(&b)
+		for _, f := range ut.fields {
+			mp.WriteField(f[0], f[1])
+		}
+		mp.Close()
+		sent := b.String()
+
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", strings.NewReader(sent))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Content-Type", mp.FormDataContentType())
+		r.Header.Set("Cookie", cookie)
+
+		body = ""
+		p.ServeHTTP(httptest.NewRecorder(), r)
+
+		if reason != ut.reason {
+			t.Fatalf("%s: wrong failure reason: got %v want %v", ut.name, reason, ut.reason)
+		}
+
+		if body != sent {
+			t.Fatalf("%s: body not preserved", ut.name)
+		}
+	}
+}
+
 // TestMaskUnmaskTokens tests that a token traversing the mask -> unmask process
 // is correctly unmasked to the original 'real' token.
 func TestMaskUnmaskTokens(t *testing.T) {
@@ -128,7 +406,11 @@ func TestMaskUnmaskTokens(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	issued := mask(realToken, nil)
+	issued, err := (&csrf{}).mask(realToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	decoded, err := base64.StdEncoding.DecodeString(issued)
 	if err != nil {
 		t.Fatal(err)
@@ -140,6 +422,64 @@ func TestMaskUnmaskTokens(t *testing.T) {
 	}
 }
 
+// Tests that every form on a page gets the same token.
+func TestTokenPerRequest(t *testing.T) {
+	var tokens []string
+	var fields []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			tokens = append(tokens, Token(r))
+			fields = append(fields, string(TemplateField(r)))
+		}
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	Protect(testKey)(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	for i := range tokens {
+		if tokens[i] != tokens[0] || fields[i] != fields[0] {
+			t.Fatalf("token changed within a request: got %q, %q want %q, %q",
+				tokens[i], fields[i], tokens[0], fields[0])
+		}
+	}
+
+	if !strings.Contains(fields[0], tokens[0]) {
+		t.Fatalf("field %q does not contain token %q", fields[0], tokens[0])
+	}
+}
+
+// Tests that masking a token allocates nothing but the returned string.
+func TestMaskAllocs(t *testing.T) {
+	realToken, err := generateRandomBytes(tokenLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := &csrf{}
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := cs.mask(realToken); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if allocs > 1 {
+		t.Fatalf("mask allocated too much: got %v allocations want 1", allocs)
+	}
+}
+
+func BenchmarkMask(b *testing.B) {
+	realToken, err := generateRandomBytes(tokenLength)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	cs := &csrf{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cs.mask(realToken)
+	}
+}
+
 // Tests domains that should (or should not) return true for a
 // same-origin check.
 func TestSameOrigin(t *testing.T) {
@@ -204,13 +544,7 @@ func (sr shortReader) Read(p []byte) (int, error) {
 // not return the expected number of bytes.
 func TestGenerateRandomBytes(t *testing.T) {
 	// Pioneered from https://github.com/justinas/nosurf
-	original := rand.Reader
-	rand.Reader = shortReader{}
-	defer func() {
-		rand.Reader = original
-	}()
-
-	b, err := generateRandomBytes(tokenLength)
+	b, err := readRandom(shortReader{}, tokenLength)
 	if err == nil {
 		t.Fatalf("generateRandomBytes did not report a short read: only read %d bytes", len(b))
 	}
@@ -221,10 +555,11 @@ func TestTemplateField(t *testing.T) {
 
 	// Make the token & template field available outside of the handler.
 	var token string
-	var templateField string
+	var templateField, fieldString string
 	s.HandleFunc("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token = Token(r)
 		templateField = string(TemplateField(r))
+		fieldString = TemplateFieldString(r)
 		t := template.Must((template.New("base").Parse(testTemplate)))
 		t.Execute(w, map[string]interface{}{
 			TemplateTag: TemplateField(r),
@@ -253,6 +588,69 @@ func TestTemplateField(t *testing.T) {
 		t.Fatalf("custom FieldName was not set correctly: got %v want %v",
 			templateField, expectedField)
 	}
+
+	if fieldString != expectedField {
+		t.Fatalf("TemplateFieldString does not match TemplateField: got %v want %v",
+			fieldString, expectedField)
+	}
+}
+
+func TestTemplateFieldWithAttrs(t *testing.T) {
+	var token string
+	var fields []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		fields = []string{
+			string(TemplateFieldWithAttrs(r, FieldAttrs{ID: "csrf"})),
+			string(TemplateFieldWithAttrs(r, FieldAttrs{
+				Data: map[string]string{"refresh": "/csrf", "kind": `"x"`, "Bad Key": "y"},
+			})),
+			string(TemplateFieldWithAttrs(r, FieldAttrs{ID: "csrf", OmitName: true})),
+		}
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	Protect(testKey)(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	expected := []string{
+		fmt.Sprintf(`<input type="hidden" name="gorilla.csrf.Token" value="%s" id="csrf">`, token),
+		fmt.Sprintf(`<input type="hidden" name="gorilla.csrf.Token" value="%s" `+
+			`data-kind="&#34;x&#34;" data-refresh="/csrf">`, token),
+		fmt.Sprintf(`<input type="hidden" value="%s" id="csrf">`, token),
+	}
+
+	for i, field := range fields {
+		if field != expected[i] {
+			t.Errorf("field not rendered correctly: got %v want %v", field, expected[i])
+		}
+	}
+}
+
+func TestTemplateMeta(t *testing.T) {
+	var token string
+	var meta string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		meta = string(TemplateMeta(r))
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	Protect(testKey)(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	expected := fmt.Sprintf(`<meta name="csrf-token" content="%s">`, token)
+	if meta != expected {
+		t.Fatalf("meta tag not set correctly: got %v want %v", meta, expected)
+	}
+
+	// Deferred pages don't embed the token.
+	Protect(testKey, DeferredTokens("/csrf"))(handler).ServeHTTP(httptest.NewRecorder(), r)
+	if meta != `<meta name="csrf-token" content="">` {
+		t.Fatalf("deferred meta tag embeds the token: %v", meta)
+	}
+
+	if meta := TemplateMeta(r); meta != "" {
+		t.Fatalf("meta tag rendered without the middleware: %v", meta)
+	}
 }
 
 func TestCompareTokens(t *testing.T) {
@@ -300,3 +698,333 @@ func TestUnsafeSkipCSRFCheck(t *testing.T) {
 			status, teapot)
 	}
 }
+
+// TestAuthState checks that an AuthState value only verifies for the visitor
+// it was issued to.
+func TestAuthState(t *testing.T) {
+	var state string
+	var verified bool
+	s := http.NewServeMux()
+	s.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		state = AuthState(r)
+	})
+	s.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		verified = VerifyAuthState(r, r.FormValue("state"))
+	})
+	p := Protect(testKey)(s)
+
+	// An anonymous visitor starts the login flow.
+	r, err := http.NewRequest("GET", "/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := httptest.NewRecorder()
+	p.ServeHTTP(login, r)
+
+	if state == "" {
+		t.Fatal("AuthState returned an empty value")
+	}
+
+	// Flip a bit in the MAC to simulate a forged state.
+	decoded, err := base64.RawURLEncoding.DecodeString(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded[len(decoded)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(decoded)
+
+	var stateTests = []struct {
+		name   string
+		cookie bool
+		state  string
+		want   bool
+	}{
+		{"same visitor", true, state, true},
+		{"different visitor", false, state, false},
+		{"tampered state", true, tampered, false},
+		{"missing state", true, "", false},
+	}
+
+	for _, st := range stateTests {
+		verified = !st.want
+		r, err := http.NewRequest("GET", "/callback?state="+url.QueryEscape(st.state), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if st.cookie {
+			setCookie(login, r)
+		}
+
+		p.ServeHTTP(httptest.NewRecorder(), r)
+
+		if verified != st.want {
+			t.Fatalf("%s: VerifyAuthState returned %v want %v", st.name, verified, st.want)
+		}
+	}
+}
+
+// TestHoneypot checks that TemplateField emits the decoy field and that
+// requests which fill it in are rejected and audited.
+func TestHoneypot(t *testing.T) {
+	var token, field string
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		field = string(TemplateField(r))
+	})
+
+	var audited int
+	p := Protect(testKey, Honeypot("website", func(r *http.Request) {
+		audited++
+	}))(s)
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := httptest.NewRecorder()
+	p.ServeHTTP(get, r)
+
+	if !strings.Contains(field, `name="website" value=""`) {
+		t.Fatalf("honeypot field not rendered: got %v", field)
+	}
+
+	for _, website := range []string{"", "http://spam.example.com"} {
+		form := url.Values{fieldName: {token}, "website": {website}}
+		r, err := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		setCookie(get, r)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		want := http.StatusOK
+		if website != "" {
+			want = http.StatusForbidden
+		}
+
+		if rr.Code != want {
+			t.Fatalf("honeypot value %q: got %v want %v", website, rr.Code, want)
+		}
+	}
+
+	if audited != 1 {
+		t.Fatalf("honeypot audit called %d times, want 1", audited)
+	}
+}
+
+// Tests that TokenExpiry reports when the session token expires, both for new
+// tokens and for tokens carried by the request's cookie.
+func TestTokenExpiry(t *testing.T) {
+	s := http.NewServeMux()
+
+	var expiry time.Time
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		expiry = TokenExpiry(r)
+	})
+
+	p := Protect(testKey, MaxAge(defaultAge), ExpiryHeader("X-CSRF-Token-Expires"))(s)
+	maxAge := time.Duration(defaultAge) * time.Second
+	issued := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	var expiryTests = []struct {
+		cookie string
+		want   time.Time
+	}{
+		{"", time.Now().Add(maxAge)},
+		{datedCookie(t, cookieName, issued), issued.Add(maxAge)},
+	}
+
+	for _, et := range expiryTests {
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if et.cookie != "" {
+			r.Header.Set("Cookie", et.cookie)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if d := expiry.Sub(et.want); d < -time.Second || d > time.Second {
+			t.Fatalf("wrong token expiry: got %v want %v", expiry, et.want)
+		}
+
+		header := rr.Header().Get("X-CSRF-Token-Expires")
+		if header != strconv.FormatInt(expiry.Unix(), 10) {
+			t.Fatalf("wrong expiry header: got %q want %v", header, expiry.Unix())
+		}
+	}
+
+	// Tokens without a MaxAge don't expire.
+	p = Protect(testKey)(s)
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !expiry.IsZero() {
+		t.Fatalf("token without a MaxAge expires: got %v", expiry)
+	}
+
+	// Tokens with a TokenMaxAge expire before the cookie does, and the
+	// header has a default name.
+	p = Protect(testKey, MaxAge(defaultAge), TokenMaxAge(30*time.Minute), ExpiryHeader(""))(s)
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	want := time.Now().Add(30 * time.Minute)
+	if d := expiry.Sub(want); d < -time.Second || d > time.Second {
+		t.Fatalf("wrong token expiry with a TokenMaxAge: got %v want %v", expiry, want)
+	}
+
+	if header := rr.Header().Get("X-CSRF-Token-Expires"); header != strconv.FormatInt(expiry.Unix(), 10) {
+		t.Fatalf("wrong expiry header: got %q want %v", header, expiry.Unix())
+	}
+}
+
+// Test that the token is accepted in an Authorization header with the
+// configured scheme, and only that scheme.
+func TestAuthorizationScheme(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, AuthorizationScheme("CSRF"))(s)
+
+	var token string
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var authTests = []struct {
+		header string
+		code   int
+	}{
+		{"CSRF " + token, http.StatusOK},
+		{"csrf  " + token, http.StatusOK},
+		{"Bearer " + token, http.StatusForbidden},
+		{"CSRF" + token, http.StatusForbidden},
+		{"CSRF", http.StatusForbidden},
+	}
+
+	for _, at := range authTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("Authorization", at.header)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != at.code {
+			t.Fatalf("%q: wrong status code: got %v want %v", at.header, rr.Code, at.code)
+		}
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	var token, body string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		if r.Body != nil {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+		}
+	})
+	p := Protect(testKey, JSONField("csrf_token"))(h)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var jsonTests = []struct {
+		contentType string
+		body        string
+		code        int
+	}{
+		{"application/json", `{"name":"gopher","csrf_token":"` + token + `"}`, http.StatusOK},
+		{"application/vnd.api+json; charset=utf-8", `{"csrf_token":"` + token + `"}`, http.StatusOK},
+		{"text/plain", `{"csrf_token":"` + token + `"}`, http.StatusForbidden},
+		{"application/json", `{"csrf_token":42}`, http.StatusForbidden},
+		{"application/json", `not json`, http.StatusForbidden},
+	}
+
+	for _, jt := range jsonTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", strings.NewReader(jt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("Content-Type", jt.contentType)
+
+		rr := httptest.NewRecorder()
+		body = ""
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != jt.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", jt.body, rr.Code, jt.code)
+		}
+
+		// The handler must still see the whole body.
+		if jt.code == http.StatusOK && body != jt.body {
+			t.Fatalf("body not preserved: got %q want %q", body, jt.body)
+		}
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	var originTests = []struct {
+		pattern  string
+		origin   string
+		expected bool
+	}{
+		{"https://app.example.com", "https://app.example.com/form", true},
+		{"https://app.example.com", "http://app.example.com/form", false},
+		{"HTTPS://App.Example.com", "https://app.example.com", true},
+		{"app.example.com", "http://app.example.com", true},
+		{"*.example.com", "https://app.example.com", true},
+		{"*.example.com", "https://a.b.example.com", true},
+		{"*.example.com", "https://example.com", false},
+		{"*.example.com", "https://evilexample.com", false},
+		{"*.example.com", "https://app.example.com:8443", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com:8443", "https://app.example.com:8443", true},
+	}
+
+	for _, ot := range originTests {
+		u, err := url.Parse(ot.origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if matchOrigin(ot.pattern, u) != ot.expected {
+			t.Fatalf("matchOrigin(%q, %q) != %v", ot.pattern, ot.origin, ot.expected)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package csrf
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// IsHTMX reports whether r was made by htmx, which marks its requests with an
+// "HX-Request: true" header.
+func IsHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// HTMXAttribute is a template helper for html/template that provides an
+// hx-headers attribute carrying the CSRF token in the X-CSRF-Token header (or
+// the header set with the RequestHeader option). htmx sends the headers with
+// every request made by the element and its descendants, so placing it on the
+// <body> covers hx-post, hx-put, hx-patch and hx-delete throughout the page,
+// including on elements outside of forms:
+//
+//	<body {{ .csrfHTMX }}>
+//
+//	// ... becomes:
+//	<body hx-headers='{"X-CSRF-Token":"<token>"}'>
+//
+// An empty attribute is returned if the middleware has not been applied.
+func HTMXAttribute(r *http.Request) template.HTMLAttr {
+	val, err := contextGet(r, csrfKey)
+	if err != nil {
+		return template.HTMLAttr("")
+	}
+	cs := val.(*csrf)
+
+	headers, err := json.Marshal(map[string]string{cs.opts.RequestHeader: Token(r)})
+	if err != nil {
+		return template.HTMLAttr("")
+	}
+
+	return template.HTMLAttr(`hx-headers='` +
+		strings.Replace(string(headers), "'", "&#39;", -1) + `'`)
+}
+
+// HTMXError configures the responses to htmx requests that fail CSRF
+// validation (see HTMXErrors).
+type HTMXError struct {
+	// Status is the status code of the response. The default is 422
+	// Unprocessable Entity.
+	Status int
+	// Retarget, if set, is sent as the HX-Retarget header: a CSS selector for
+	// the element that htmx should swap the response into, such as an error
+	// banner, in place of the request's own target.
+	Retarget string
+	// Reswap, if set, is sent as the HX-Reswap header, e.g. "innerHTML".
+	Reswap string
+	// Trigger, if set, is sent as the HX-Trigger header, naming a client-side
+	// event for scripts on the page to handle - e.g. by reloading the page to
+	// fetch a fresh token.
+	Trigger string
+	// Handler renders the body of the response, with the status code set to
+	// Status. By default the failure reason is written as plain text.
+	Handler http.Handler
+}
+
+// HTMXErrorHandler returns an http.Handler for htmx requests that fail CSRF
+// validation, configured by e. Use it with ErrorHandlerFor and IsHTMX, or
+// through the HTMXErrors option.
+func HTMXErrorHandler(e HTMXError) http.Handler {
+	if e.Status == 0 {
+		e.Status = http.StatusUnprocessableEntity
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		if e.Retarget != "" {
+			h.Set("HX-Retarget", e.Retarget)
+		}
+		if e.Reswap != "" {
+			h.Set("HX-Reswap", e.Reswap)
+		}
+		if e.Trigger != "" {
+			h.Set("HX-Trigger", e.Trigger)
+		}
+
+		if e.Handler == nil {
+			http.Error(w, fmt.Sprintf("%s - %s",
+				http.StatusText(e.Status), FailureReason(r)), e.Status)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: e.Status}
+		e.Handler.ServeHTTP(sw, r)
+		sw.WriteHeader(e.Status)
+	})
+}
+
+// statusWriter is a http.ResponseWriter that responds with a fixed status
+// code, whichever its handler sets.
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if !sw.written {
+		sw.written = true
+		sw.ResponseWriter.WriteHeader(sw.status)
+	}
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.WriteHeader(sw.status)
+	return sw.ResponseWriter.Write(b)
+}
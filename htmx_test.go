@@ -0,0 +1,78 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTMXAttribute(t *testing.T) {
+	var token string
+	var attr string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		attr = string(HTMXAttribute(r))
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	Protect(testKey, RequestHeader("X-Token"))(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	expected := `hx-headers='{"X-Token":"` + token + `"}'`
+	if attr != expected {
+		t.Fatalf("hx-headers attribute not set correctly: got %v want %v", attr, expected)
+	}
+
+	if attr := HTMXAttribute(r); attr != "" {
+		t.Fatalf("attribute rendered without the middleware: %v", attr)
+	}
+}
+
+// TestHTMXErrors checks that failed htmx requests get the configured response,
+// and that other requests still reach the ErrorHandler.
+func TestHTMXErrors(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	fragment := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<div class="error">Please reload the page.</div>`))
+	})
+
+	var htmxTests = []struct {
+		htmx    bool
+		e       HTMXError
+		status  int
+		headers map[string]string
+		body    string
+	}{
+		{false, HTMXError{}, http.StatusForbidden, nil, "Forbidden"},
+		{true, HTMXError{}, http.StatusUnprocessableEntity, nil, ErrNoReferer.Error()},
+		{true, HTMXError{Status: http.StatusOK, Retarget: "#errors", Reswap: "innerHTML",
+			Trigger: "csrfError", Handler: fragment}, http.StatusOK,
+			map[string]string{"HX-Retarget": "#errors", "HX-Reswap": "innerHTML",
+				"HX-Trigger": "csrfError"}, "Please reload"},
+	}
+
+	for _, ht := range htmxTests {
+		r := httptest.NewRequest("POST", "https://www.gorillatoolkit.org/", nil)
+		if ht.htmx {
+			r.Header.Set("HX-Request", "true")
+		}
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, HTMXErrors(ht.e))(handler).ServeHTTP(rr, r)
+
+		if rr.Code != ht.status {
+			t.Errorf("%+v: wrong status code: got %v want %v", ht.e, rr.Code, ht.status)
+		}
+
+		for name, want := range ht.headers {
+			if got := rr.Header().Get(name); got != want {
+				t.Errorf("%+v: wrong %s header: got %q want %q", ht.e, name, got, want)
+			}
+		}
+
+		if !strings.Contains(rr.Body.String(), ht.body) {
+			t.Errorf("%+v: body %q does not contain %q", ht.e, rr.Body.String(), ht.body)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package csrf
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyHeader is the request header that carries a client's
+// idempotency key.
+const idempotencyHeader = "Idempotency-Key"
+
+// replayCacheSize is the most requests a replayCache holds: once it is full,
+// the oldest are forgotten to make room.
+const replayCacheSize = 10000
+
+// replayCache records requests that carried an idempotency key, so that a
+// bounded number of identical retries can be accepted even after the token
+// they carry has been consumed.
+type replayCache struct {
+	max  int
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List // of *replayEntry, oldest (and so first to expire) first
+}
+
+// replayEntry is a request recorded by a replayCache.
+type replayEntry struct {
+	id        [sha256.Size]byte
+	request   [sha256.Size]byte
+	expires   time.Time
+	remaining int
+}
+
+func newReplayCache(max int, ttl time.Duration) *replayCache {
+	return &replayCache{
+		max:     max,
+		ttl:     ttl,
+		size:    replayCacheSize,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// replayKey binds an idempotency key to the token it was sent with, so that
+// keys chosen by one client can't collide with another's.
+func replayKey(token []byte, key string) [sha256.Size]byte {
+	return sha256.Sum256(append(append([]byte(nil), token...), key...))
+}
+
+// requestDigest returns a hash of the parts of r that must be identical for a
+// retry to be accepted.
+// Requests with bodies over the MaxBodyBytes limit have no digest, and so
+// are never replayed.
+func requestDigest(r *http.Request) ([sha256.Size]byte, bool) {
+	var body []byte
+	if r.Body != nil {
+		var ok bool
+		if body, ok = peekBody(r, bodyLimit(r)); !ok {
+			return [sha256.Size]byte{}, false
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	return digest, true
+}
+
+// record notes that r, carrying token, was accepted. Only the first request
+// for an idempotency key is recorded; later ones are retries.
+func (rc *replayCache) record(r *http.Request, token []byte) {
+	key := r.Header.Get(idempotencyHeader)
+	if key == "" {
+		return
+	}
+
+	digest, ok := requestDigest(r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	id := replayKey(token, key)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if _, ok := rc.entries[id]; ok {
+		return
+	}
+
+	// Entries expire in the order they were recorded, so expired ones (and,
+	// if the cache is full, the oldest) are at the front.
+	for el := rc.order.Front(); el != nil; el = rc.order.Front() {
+		e := el.Value.(*replayEntry)
+		if !now.After(e.expires) && rc.order.Len() < rc.size {
+			break
+		}
+
+		rc.order.Remove(el)
+		delete(rc.entries, e.id)
+	}
+
+	rc.entries[id] = rc.order.PushBack(&replayEntry{
+		id:        id,
+		request:   digest,
+		expires:   now.Add(rc.ttl),
+		remaining: rc.max,
+	})
+}
+
+// accept reports whether r, carrying token, is an identical retry of a
+// recorded request that may still be replayed. Each accepted retry counts
+// against the limit.
+func (rc *replayCache) accept(r *http.Request, token []byte) bool {
+	key := r.Header.Get(idempotencyHeader)
+	if key == "" {
+		return false
+	}
+
+	digest, ok := requestDigest(r)
+	if !ok {
+		return false
+	}
+
+	id := replayKey(token, key)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	el, ok := rc.entries[id]
+	if !ok {
+		return false
+	}
+
+	e := el.Value.(*replayEntry)
+	if time.Now().After(e.expires) || e.request != digest || e.remaining <= 0 {
+		return false
+	}
+
+	e.remaining--
+	return true
+}
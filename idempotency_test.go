@@ -0,0 +1,126 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIdempotentReplays checks that an identical retry of a request carrying
+// an Idempotency-Key is accepted after its token has been consumed, up to the
+// configured limit.
+func TestIdempotentReplays(t *testing.T) {
+	var token string
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+	s.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		r, err := MigrateToken(w, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token = Token(r)
+	})
+	p := Protect(testKey, IdempotentReplays(1, time.Minute))(s)
+
+	jar := make(map[string]*http.Cookie)
+	do := func(method, path, tok, key, body string) int {
+		r, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range jar {
+			r.AddCookie(c)
+		}
+		r.Header.Set("X-CSRF-Token", tok)
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		for _, c := range rr.Result().Cookies() {
+			if c.MaxAge < 0 {
+				delete(jar, c.Name)
+				continue
+			}
+			jar[c.Name] = c
+		}
+
+		return rr.Code
+	}
+
+	do("GET", "/", "", "", "")
+	anonToken := token
+
+	if code := do("POST", "/login", anonToken, "", ""); code != http.StatusOK {
+		t.Fatalf("login request was rejected: got %v want %v", code, http.StatusOK)
+	}
+
+	// The previous token is consumed by the first request...
+	if code := do("POST", "/", anonToken, "k1", "order=1"); code != http.StatusOK {
+		t.Fatalf("previous token was not accepted: got %v want %v", code, http.StatusOK)
+	}
+
+	var replayTests = []struct {
+		name string
+		key  string
+		body string
+		code int
+	}{
+		{"different body", "k1", "order=2", http.StatusForbidden},
+		{"different key", "k2", "order=1", http.StatusForbidden},
+		{"no key", "", "order=1", http.StatusForbidden},
+		// ... but an identical retry is accepted once.
+		{"retry", "k1", "order=1", http.StatusOK},
+		{"second retry", "k1", "order=1", http.StatusForbidden},
+	}
+
+	for _, rt := range replayTests {
+		if code := do("POST", "/", anonToken, rt.key, rt.body); code != rt.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", rt.name, code, rt.code)
+		}
+	}
+}
+
+// TestReplayCacheSize checks that a full replayCache forgets the oldest
+// requests first.
+func TestReplayCacheSize(t *testing.T) {
+	rc := newReplayCache(1, time.Minute)
+	rc.size = 2
+	token := []byte("token")
+
+	request := func(key string) *http.Request {
+		r := httptest.NewRequest("POST", "/orders", strings.NewReader("order=1"))
+		r.Header.Set(idempotencyHeader, key)
+		return r
+	}
+
+	for _, key := range []string{"k1", "k2", "k3"} {
+		rc.record(request(key), token)
+	}
+
+	if n := len(rc.entries); n != 2 {
+		t.Fatalf("wrong number of entries: got %v want %v", n, 2)
+	}
+
+	var sizeTests = []struct {
+		key    string
+		accept bool
+	}{
+		{"k1", false},
+		{"k2", true},
+		{"k3", true},
+	}
+
+	for _, st := range sizeTests {
+		if got := rc.accept(request(st.key), token); got != st.accept {
+			t.Fatalf("%s: wrong result: got %v want %v", st.key, got, st.accept)
+		}
+	}
+}
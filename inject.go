@@ -0,0 +1,373 @@
+package csrf
+
+import (
+	"bufio"
+	"bytes"
+	"html"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The states of a formWriter's response.
+const (
+	injectUndecided = iota
+	injectBuffering
+	injectPassthrough
+)
+
+// formWriter is a http.ResponseWriter that buffers text/html responses and
+// injects the request's token field into their POST forms (see InjectForms).
+// Other responses are passed through as they are written.
+type formWriter struct {
+	http.ResponseWriter
+	r      *http.Request
+	scheme string
+	code   int
+	state  int
+	buf    bytes.Buffer
+}
+
+// decide chooses whether to buffer the response, given the first chunk of its
+// body (which may be nil), and passes on the status code if it doesn't.
+func (fw *formWriter) decide(b []byte) {
+	if fw.state != injectUndecided {
+		return
+	}
+
+	h := fw.ResponseWriter.Header()
+	ct := h.Get("Content-Type")
+	if ct == "" && len(b) > 0 {
+		ct = http.DetectContentType(b)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(ct)
+	if mediaType == "text/html" && h.Get("Content-Encoding") == "" && fw.r.Method != "HEAD" {
+		fw.state = injectBuffering
+		return
+	}
+
+	fw.state = injectPassthrough
+	if fw.code != 0 {
+		fw.ResponseWriter.WriteHeader(fw.code)
+	}
+}
+
+func (fw *formWriter) WriteHeader(code int) {
+	switch {
+	case code >= 100 && code < 200:
+		// Informational responses don't end the headers.
+		fw.ResponseWriter.WriteHeader(code)
+	case fw.state == injectPassthrough:
+		fw.ResponseWriter.WriteHeader(code)
+	case fw.code == 0:
+		fw.code = code
+		if fw.ResponseWriter.Header().Get("Content-Type") != "" {
+			fw.decide(nil)
+		}
+	}
+}
+
+func (fw *formWriter) Write(b []byte) (int, error) {
+	fw.decide(b)
+	if fw.state == injectBuffering {
+		return fw.buf.Write(b)
+	}
+
+	return fw.ResponseWriter.Write(b)
+}
+
+// finish writes out a buffered response, with the token field injected, once
+// the handler has returned.
+func (fw *formWriter) finish() {
+	switch fw.state {
+	case injectUndecided:
+		if fw.code != 0 {
+			fw.ResponseWriter.WriteHeader(fw.code)
+		}
+	case injectBuffering:
+		body := injectForms(fw.buf.Bytes(), fw.r, fw.scheme)
+
+		h := fw.ResponseWriter.Header()
+		if h.Get("Content-Length") != "" {
+			h.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		if fw.code != 0 {
+			fw.ResponseWriter.WriteHeader(fw.code)
+		}
+		fw.ResponseWriter.Write(body)
+	}
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter does. HTML
+// responses are buffered until the handler returns, so flushing them has no
+// effect.
+func (fw *formWriter) Flush() {
+	if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+		fw.decide(nil)
+		if fw.state == injectPassthrough {
+			f.Flush()
+		}
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying ResponseWriter does.
+func (fw *formWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := fw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New(errorPrefix + "ResponseWriter does not implement http.Hijacker")
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (fw *formWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
+
+// rawTextTags are the elements whose content isn't markup, and so can't
+// contain forms.
+var rawTextTags = []string{"script", "style", "textarea", "title"}
+
+// injectForms inserts r's token field at the start of each POST form in page
+// that submits to r's own origin (r's host, reached with scheme) and doesn't
+// already include the field.
+func injectForms(page []byte, r *http.Request, scheme string) []byte {
+	name, err := contextGet(r, formKey)
+	if err != nil {
+		return page
+	}
+	have := []byte(`name="` + strings.ToLower(name.(string)) + `"`)
+
+	// Tag and attribute names are case-insensitive.
+	lower := asciiLower(page)
+
+	var out bytes.Buffer
+	var field string
+	i := 0
+	for {
+		j := bytes.IndexByte(lower[i:], '<')
+		if j < 0 {
+			break
+		}
+		j += i
+
+		if bytes.HasPrefix(lower[j:], []byte("<!--")) {
+			end := bytes.Index(lower[j+4:], []byte("-->"))
+			if end < 0 {
+				break
+			}
+			out.Write(page[i : j+4+end+3])
+			i = j + 4 + end + 3
+			continue
+		}
+
+		// Skip end tags, and '<' characters in text.
+		if j+1 == len(lower) || lower[j+1] < 'a' || lower[j+1] > 'z' {
+			out.Write(page[i : j+1])
+			i = j + 1
+			continue
+		}
+
+		tag, attrs, end := parseTag(page, j)
+		if end < 0 {
+			break
+		}
+		out.Write(page[i:end])
+		i = end
+
+		if contains(rawTextTags, tag) {
+			closing := bytes.Index(lower[i:], []byte("</"+tag))
+			if closing < 0 {
+				break
+			}
+			out.Write(page[i : i+closing])
+			i += closing
+			continue
+		}
+
+		if tag != "form" || !injectable(attrs, r, scheme) {
+			continue
+		}
+
+		// Leave forms that already carry the field alone.
+		formEnd := bytes.Index(lower[i:], []byte("</form"))
+		if formEnd < 0 {
+			formEnd = len(lower) - i
+		}
+		if bytes.Contains(lower[i:i+formEnd], have) ||
+			foreignFormAction(page[i:i+formEnd], r, scheme) {
+			continue
+		}
+
+		if field == "" {
+			field = TemplateFieldString(r)
+		}
+		out.WriteString(field)
+	}
+
+	out.Write(page[i:])
+	return out.Bytes()
+}
+
+// injectable reports whether a form with attrs should be given the token
+// field: it must use the POST method, and must not submit to another origin,
+// which would leak the token.
+func injectable(attrs map[string]string, r *http.Request, scheme string) bool {
+	if strings.ToLower(strings.TrimSpace(attrs["method"])) != "post" {
+		return false
+	}
+
+	return ownAction(attrs["action"], r, scheme)
+}
+
+// foreignFormAction reports whether the body of a form has a button or input
+// whose formaction submits the form to another origin than r's.
+func foreignFormAction(body []byte, r *http.Request, scheme string) bool {
+	lower := asciiLower(body)
+	i := 0
+	for {
+		j := bytes.IndexByte(lower[i:], '<')
+		if j < 0 {
+			return false
+		}
+		i += j + 1
+
+		// Skip end tags, comments and '<' characters in text.
+		if i == len(lower) || lower[i] < 'a' || lower[i] > 'z' {
+			continue
+		}
+
+		tag, attrs, end := parseTag(body, i-1)
+		if end < 0 {
+			return false
+		}
+		i = end
+
+		if tag != "button" && tag != "input" {
+			continue
+		}
+		if action, ok := attrs["formaction"]; ok && !ownAction(action, r, scheme) {
+			return true
+		}
+	}
+}
+
+// ownAction reports whether a form action (or formaction) submits to r's
+// host, reached with scheme.
+func ownAction(action string, r *http.Request, scheme string) bool {
+	// Browsers ignore tabs and newlines in URLs, and treat backslashes as
+	// slashes.
+	action = strings.Map(func(c rune) rune {
+		if c == '\t' || c == '\n' || c == '\r' {
+			return -1
+		}
+		return c
+	}, strings.TrimSpace(action))
+	action = strings.Replace(action, `\`, "/", -1)
+
+	u, err := url.Parse(action)
+	if err != nil || u.Scheme != "" && (u.Host == "" || strings.ToLower(u.Scheme) != scheme) {
+		return false
+	}
+
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return host == "" || strings.ToLower(host) == requestHost(r)
+}
+
+// parseTag parses the tag that starts at page[start] (a '<'), returning its
+// lower-cased name, its attributes (with lower-cased names) and the index just
+// past its end. As in browsers, only the first of duplicate attributes is
+// kept. end is -1 if the tag is unterminated.
+func parseTag(page []byte, start int) (name string, attrs map[string]string, end int) {
+	i := start + 1
+	for i < len(page) && !isSpace(page[i]) && page[i] != '>' && page[i] != '/' {
+		i++
+	}
+	name = string(asciiLower(page[start+1 : i]))
+
+	// Only forms and the controls that can submit them need their
+	// attributes.
+	if name == "form" || name == "button" || name == "input" {
+		attrs = make(map[string]string)
+	}
+
+	for i < len(page) {
+		switch c := page[i]; {
+		case c == '>':
+			return name, attrs, i + 1
+		case isSpace(c) || c == '/':
+			i++
+			continue
+		}
+
+		n := i
+		for i < len(page) && !isSpace(page[i]) && page[i] != '=' && page[i] != '>' && page[i] != '/' {
+			i++
+		}
+		attr := string(asciiLower(page[n:i]))
+
+		for i < len(page) && isSpace(page[i]) {
+			i++
+		}
+		if i == len(page) || page[i] != '=' {
+			if _, ok := attrs[attr]; attrs != nil && !ok {
+				attrs[attr] = ""
+			}
+			continue
+		}
+		i++
+		for i < len(page) && isSpace(page[i]) {
+			i++
+		}
+
+		var value string
+		if i < len(page) && (page[i] == '"' || page[i] == '\'') {
+			q := bytes.IndexByte(page[i+1:], page[i])
+			if q < 0 {
+				return name, attrs, -1
+			}
+			value = string(page[i+1 : i+1+q])
+			i += q + 2
+		} else {
+			v := i
+			for i < len(page) && !isSpace(page[i]) && page[i] != '>' {
+				i++
+			}
+			value = string(page[v:i])
+		}
+
+		if _, ok := attrs[attr]; attrs != nil && !ok {
+			attrs[attr] = html.UnescapeString(value)
+		}
+	}
+
+	return name, attrs, -1
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// asciiLower returns a copy of b with ASCII letters lower-cased, so that
+// indexes into it are indexes into b.
+func asciiLower(b []byte) []byte {
+	lower := make([]byte, len(b))
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+
+	return lower
+}
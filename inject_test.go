@@ -0,0 +1,111 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestInjectForms checks which forms the token field is injected into.
+func TestInjectForms(t *testing.T) {
+	var page, contentType string
+	var token string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Write([]byte(page))
+	})
+
+	var injectTests = []struct {
+		contentType string
+		page        string
+		injected    int
+	}{
+		{"", `<html><form method="post" action="/signup"><input name="email"></form></html>`, 1},
+		{"text/html; charset=utf-8", `<FORM Method=POST>`, 1},
+		{"", `<html><form method="get"></form><form></form></html>`, 0},
+		{"text/plain", `<form method="post"></form>`, 0},
+		{"", `<html><form method="post" action="https://evil.example.com/"></form></html>`, 0},
+		{"", `<html><form method="post" action="//evil.example.com/"></form></html>`, 0},
+		{"", `<html><form method="post" action="&#x2f;&#x2f;evil.example.com/"></form></html>`, 0},
+		{"", `<html><form method="post" action="http://www.gorillatoolkit.org/x"></form></html>`, 1},
+		{"", `<html><form method="post" action="https://www.gorillatoolkit.org/x"></form></html>`, 0},
+		{"", `<html><form method="post" action="https://evil.example.com/" action="/x"></form></html>`, 0},
+		{"", `<html><form method="post" action="/x" action="https://evil.example.com/"></form></html>`, 1},
+		{"", `<html><form method="get" method="post"></form></html>`, 0},
+		{"", `<html><form method="post"><button formaction="//evil.example.com/">Go</button></form></html>`, 0},
+		{"", `<html><form method="post"><input type="submit" formaction="/other"></form></html>`, 1},
+		{"", `<html><!-- <form method="post"> --><script>"<form method=post>"</script></html>`, 0},
+		{"", `<html><p>1 < 2</p><form data-x="a>b" method="post"></form><form method="post"></form></html>`, 2},
+		{"", `<html><form method="post"><input type="hidden" name="gorilla.csrf.Token" value=""></form></html>`, 0},
+	}
+
+	for _, it := range injectTests {
+		page, contentType = it.page, it.contentType
+
+		r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		rr := httptest.NewRecorder()
+		Protect(testKey, InjectForms(true))(handler).ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: middleware failed to pass to the next handler: got %v", it.page, rr.Code)
+		}
+
+		field := `<input type="hidden" name="gorilla.csrf.Token" value="` + token + `">`
+		if n := strings.Count(rr.Body.String(), field); n != it.injected {
+			t.Errorf("%s: got %d fields want %d:\n%s", it.page, n, it.injected, rr.Body.String())
+		}
+
+		if got, want := strings.Replace(rr.Body.String(), field, "", -1), it.page; got != want {
+			t.Errorf("%s: page changed other than by the field: got %s", it.page, got)
+		}
+	}
+}
+
+// TestInjectFormsHeaders checks that the status code and Content-Length of
+// rewritten responses are preserved, and that other responses pass through.
+func TestInjectFormsHeaders(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/form", func(w http.ResponseWriter, r *http.Request) {
+		page := `<form method="post"></form>`
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", "27")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(page))
+	})
+	s.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"form":"<form method=\"post\">"}`))
+	})
+	p := Protect(testKey, InjectForms(true), CacheControl("no-store"))(s)
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/form", nil)
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status code not preserved: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	if cl := rr.Header().Get("Content-Length"); cl != "" && cl != strconv.Itoa(rr.Body.Len()) {
+		t.Fatalf("stale Content-Length: got %v for %d bytes", cl, rr.Body.Len())
+	}
+
+	// The injected token marks the page as uncacheable.
+	if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Fatalf("page with an injected token is cacheable: got %q", cc)
+	}
+
+	r = httptest.NewRequest("GET", "http://www.gorillatoolkit.org/json", nil)
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusAccepted || strings.Contains(rr.Body.String(), "<input") {
+		t.Fatalf("JSON response was rewritten: got %v %s", rr.Code, rr.Body.String())
+	}
+}
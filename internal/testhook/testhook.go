@@ -0,0 +1,13 @@
+// Package testhook gives the csrftest package access to the request context
+// values of the csrf package, whose keys are unexported. The csrf package sets
+// the hooks when it is initialized.
+package testhook
+
+import (
+	"net/http"
+)
+
+// WithToken returns a shallow copy of r whose context carries token as the
+// masked CSRF token, and field as the name of the form field it is submitted
+// in, as if r had been served by the middleware.
+var WithToken func(r *http.Request, token, field string) *http.Request
@@ -0,0 +1,45 @@
+package csrf
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// jsonToken returns the string value of the named top-level field of r's body,
+// if r has a JSON content type. The body is replaced so that the handler can
+// still read it in full.
+func jsonToken(r *http.Request, field string) string {
+	if !isJSON(r.Header.Get("Content-Type")) {
+		return ""
+	}
+
+	body, ok := peekBody(r, bodyLimit(r))
+	if !ok {
+		return ""
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+
+	var token string
+	if err := json.Unmarshal(fields[field], &token); err != nil {
+		return ""
+	}
+
+	return token
+}
+
+// isJSON reports whether contentType is application/json or another JSON
+// media type, such as application/vnd.api+json.
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
@@ -0,0 +1,36 @@
+package csrf
+
+import (
+	"net/http"
+)
+
+// eventLogger writes log records for the middleware's activity. It is set by
+// WithLogger, which requires Go 1.21 or later; the interface keeps log/slog
+// out of builds for earlier versions.
+type eventLogger interface {
+	// tokenIssued logs the issuance of a new base token for r.
+	tokenIssued(r *http.Request, name string)
+	// validationFailed logs a request that failed validation.
+	validationFailed(r *http.Request, name string, kind FailureKind, reason error)
+	// decodeError logs a CSRF cookie that couldn't be decoded.
+	decodeError(r *http.Request, name string, err error)
+}
+
+// decodeFailed reports whether sessionErr, an error from the session store,
+// means that the CSRF cookie was present but could not be decoded.
+func decodeFailed(sessionErr error) bool {
+	switch sessionErr {
+	case nil, errSessionChanged, http.ErrNoCookie, ErrTokenNotFound, ErrTokenExpired:
+		return false
+	}
+
+	return true
+}
+
+// decodeError logs a CSRF cookie that couldn't be decoded to the Logger, if
+// any.
+func (cs *csrf) decodeError(r *http.Request, sessionErr error) {
+	if cs.opts.Logger != nil && decodeFailed(sessionErr) {
+		cs.opts.Logger.decodeError(r, cs.opts.Name, sessionErr)
+	}
+}
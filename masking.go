@@ -0,0 +1,47 @@
+package csrf
+
+import (
+	"encoding/base64"
+)
+
+// GenerateToken masks baseToken with a one-time pad, as the middleware masks
+// the session token for Token, and returns the result: a token that differs
+// on every call, so that pages embedding it don't reveal baseToken to
+// compression side-channel attacks (BREACH). It is for frameworks that store
+// base tokens themselves; VerifyToken checks the tokens it returns.
+//
+// baseToken must be 32 random bytes, such as from crypto/rand, and be kept
+// secret from other users. An empty string is returned if it has the wrong
+// length, or if the pad could not be read from crypto/rand.
+//
+// The tokens carry no timestamp, so are not accepted by middleware that sets
+// TokenMaxAge.
+func GenerateToken(baseToken []byte) string {
+	if len(baseToken) != tokenLength {
+		return ""
+	}
+
+	var issued [tokenLength * 2]byte
+	if err := readRandomBytes(issued[:tokenLength]); err != nil {
+		return ""
+	}
+
+	xorBytes(issued[tokenLength:], issued[:tokenLength], baseToken)
+	return base64.StdEncoding.EncodeToString(issued[:])
+}
+
+// VerifyToken reports whether masked is a token returned by GenerateToken (or
+// by Token, without TokenMaxAge) for baseToken. The comparison runs in
+// constant time.
+func VerifyToken(masked string, baseToken []byte) bool {
+	if len(baseToken) != tokenLength {
+		return false
+	}
+
+	issued, err := base64.StdEncoding.DecodeString(masked)
+	if err != nil {
+		return false
+	}
+
+	return compareTokens(unmask(issued), baseToken)
+}
@@ -0,0 +1,76 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGenerateToken(t *testing.T) {
+	base, err := generateRandomBytes(tokenLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := generateRandomBytes(tokenLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := GenerateToken(base)
+	if token == "" || token == GenerateToken(base) {
+		t.Fatalf("tokens are not masked per call: %q", token)
+	}
+
+	var verifyTests = []struct {
+		masked string
+		base   []byte
+		valid  bool
+	}{
+		{token, base, true},
+		{GenerateToken(base), base, true},
+		{token, other, false},
+		{GenerateToken(other), base, false},
+		{"", base, false},
+		{"not-base64!", base, false},
+		{token, base[:16], false},
+	}
+
+	for i, vt := range verifyTests {
+		if valid := VerifyToken(vt.masked, vt.base); valid != vt.valid {
+			t.Errorf("%d: VerifyToken(%q) got %v want %v", i, vt.masked, valid, vt.valid)
+		}
+	}
+
+	if token := GenerateToken(base[:16]); token != "" {
+		t.Fatalf("token generated for a short base token: %q", token)
+	}
+}
+
+// TestGenerateTokenInterop checks that the middleware's tokens and those from
+// GenerateToken are interchangeable.
+func TestGenerateTokenInterop(t *testing.T) {
+	var token string
+	var base []byte
+	h := Protect(testKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		base = baseToken(r)
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil))
+
+	if !VerifyToken(token, base) {
+		t.Fatalf("token from Token not verified")
+	}
+
+	r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	r.Header.Set("Cookie", rr.Header().Get("Set-Cookie"))
+	r.Header.Set("X-CSRF-Token", GenerateToken(base))
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("token from GenerateToken rejected by the middleware: got %v", rr.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package csrf
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// memoryShards is the number of independently locked shards in a
+// MemoryStore.
+const memoryShards = 32
+
+// MemoryStore is a bounded, in-memory TokenStore for single-node
+// applications that keep tokens on the server rather than in the CSRF cookie
+// (see WithStore). Tokens expire after a fixed TTL, and once the store is full
+// the least recently used tokens are evicted to make room.
+//
+// A MemoryStore is safe for concurrent use. Its entries are spread across
+// independently locked shards, so that concurrent requests rarely contend.
+type MemoryStore struct {
+	ttl    time.Duration
+	shards [memoryShards]memoryShard
+}
+
+// memoryShard is a least-recently-used list of tokens, keyed by ID.
+type memoryShard struct {
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *memoryEntry, most recently used first
+}
+
+// memoryEntry is a token held by a MemoryStore.
+type memoryEntry struct {
+	id      string
+	token   []byte
+	expires time.Time
+}
+
+// NewMemoryStore returns a MemoryStore that holds up to (approximately)
+// maxEntries tokens, each for ttl after it was saved.
+func NewMemoryStore(maxEntries int, ttl time.Duration) *MemoryStore {
+	perShard := (maxEntries + memoryShards - 1) / memoryShards
+	if perShard < 1 {
+		perShard = 1
+	}
+
+	ms := &MemoryStore{ttl: ttl}
+	for i := range ms.shards {
+		ms.shards[i] = memoryShard{
+			max:     perShard,
+			entries: make(map[string]*list.Element),
+			lru:     list.New(),
+		}
+	}
+
+	return ms
+}
+
+// shard returns the shard that holds id.
+func (ms *MemoryStore) shard(id string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &ms.shards[h.Sum32()%memoryShards]
+}
+
+// Get returns the token saved under id, or ErrTokenNotFound if there is none
+// or it has expired.
+func (ms *MemoryStore) Get(ctx context.Context, id string) ([]byte, error) {
+	s := ms.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[id]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	e := el.Value.(*memoryEntry)
+	if time.Now().After(e.expires) {
+		s.remove(el)
+		return nil, ErrTokenNotFound
+	}
+
+	s.lru.MoveToFront(el)
+	return e.token, nil
+}
+
+// Save saves token under id, replacing any token already saved under it.
+func (ms *MemoryStore) Save(ctx context.Context, id string, token []byte) error {
+	now := time.Now()
+
+	s := ms.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[id]; ok {
+		e := el.Value.(*memoryEntry)
+		e.token = token
+		e.expires = now.Add(ms.ttl)
+		s.lru.MoveToFront(el)
+		return nil
+	}
+
+	s.entries[id] = s.lru.PushFront(&memoryEntry{
+		id:      id,
+		token:   token,
+		expires: now.Add(ms.ttl),
+	})
+
+	// Drop expired tokens from the back of the list, and then the least
+	// recently used ones if the shard is still over its bound.
+	for el := s.lru.Back(); el != nil; el = s.lru.Back() {
+		if len(s.entries) <= s.max && !now.After(el.Value.(*memoryEntry).expires) {
+			break
+		}
+		s.remove(el)
+	}
+
+	return nil
+}
+
+// Delete removes the token saved under id, if any.
+func (ms *MemoryStore) Delete(ctx context.Context, id string) error {
+	s := ms.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[id]; ok {
+		s.remove(el)
+	}
+
+	return nil
+}
+
+// Take returns and removes the token saved under id, or returns
+// ErrTokenNotFound if there is none or it has expired.
+func (ms *MemoryStore) Take(ctx context.Context, id string) ([]byte, error) {
+	s := ms.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[id]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	s.remove(el)
+	e := el.Value.(*memoryEntry)
+	if time.Now().After(e.expires) {
+		return nil, ErrTokenNotFound
+	}
+
+	return e.token, nil
+}
+
+// Len returns the number of tokens held by the store, including any that have
+// expired but not yet been evicted.
+func (ms *MemoryStore) Len() int {
+	n := 0
+	for i := range ms.shards {
+		s := &ms.shards[i]
+		s.mu.Lock()
+		n += len(s.entries)
+		s.mu.Unlock()
+	}
+
+	return n
+}
+
+// remove removes el from the shard. s.mu must be held.
+func (s *memoryShard) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.entries, el.Value.(*memoryEntry).id)
+}
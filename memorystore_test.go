@@ -0,0 +1,174 @@
+package csrf
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemoryStore(10, time.Hour)
+
+	if _, err := ms.Get(ctx, "missing"); err != ErrTokenNotFound {
+		t.Fatalf("wrong error for a missing ID: got %v want %v", err, ErrTokenNotFound)
+	}
+
+	if err := ms.Save(ctx, "id", []byte("token")); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := ms.Get(ctx, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(token) != "token" {
+		t.Fatalf("wrong token: got %q want %q", token, "token")
+	}
+
+	if err := ms.Delete(ctx, "id"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ms.Get(ctx, "id"); err != ErrTokenNotFound {
+		t.Fatalf("token not deleted: got %v want %v", err, ErrTokenNotFound)
+	}
+}
+
+// Tests that tokens expire after the TTL.
+func TestMemoryStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemoryStore(10, time.Millisecond)
+
+	if err := ms.Save(ctx, "id", []byte("token")); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := ms.Get(ctx, "id"); err != ErrTokenNotFound {
+		t.Fatalf("token did not expire: got %v want %v", err, ErrTokenNotFound)
+	}
+
+	if ms.Len() != 0 {
+		t.Fatalf("expired token not evicted: got %d entries", ms.Len())
+	}
+}
+
+// Tests that the store stays within its bound, evicting the least recently
+// used tokens.
+func TestMemoryStoreBound(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemoryStore(memoryShards, time.Hour)
+
+	for i := 0; i < 10*memoryShards; i++ {
+		if err := ms.Save(ctx, fmt.Sprint(i), []byte("token")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ms.Len() > memoryShards {
+		t.Fatalf("store exceeded its bound: got %d entries want <= %d", ms.Len(), memoryShards)
+	}
+
+	// The most recently saved token must have survived.
+	if _, err := ms.Get(ctx, fmt.Sprint(10*memoryShards-1)); err != nil {
+		t.Fatalf("most recent token evicted: %v", err)
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemoryStore(100, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				id := fmt.Sprint(i, "-", j%200)
+				ms.Save(ctx, id, []byte(id))
+				if token, err := ms.Get(ctx, id); err == nil && string(token) != id {
+					t.Errorf("wrong token for %s: got %q", id, token)
+				}
+				if j%3 == 0 {
+					ms.Delete(ctx, id)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Tests that the middleware keeps tokens in the store, and only an ID in the
+// cookie.
+func TestWithStore(t *testing.T) {
+	ms := NewMemoryStore(10, time.Hour)
+
+	s := http.NewServeMux()
+	p := Protect(testKey, WithStore(ms))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if ms.Len() != 1 {
+		t.Fatalf("token not saved in the store: got %d entries want 1", ms.Len())
+	}
+
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setCookie(rr, r)
+	r.Header.Set("X-CSRF-Token", token)
+
+	rr2 := httptest.NewRecorder()
+	p.ServeHTTP(rr2, r)
+
+	if rr2.Code != http.StatusOK {
+		t.Fatalf("middleware failed to pass a stored token: got %v want %v",
+			rr2.Code, http.StatusOK)
+	}
+
+	// Deleting the token from the store invalidates it.
+	for i := range ms.shards {
+		for id := range ms.shards[i].entries {
+			ms.Delete(context.Background(), id)
+		}
+	}
+
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setCookie(rr, r)
+	r.Header.Set("X-CSRF-Token", token)
+
+	rr3 := httptest.NewRecorder()
+	p.ServeHTTP(rr3, r)
+
+	if rr3.Code != http.StatusForbidden {
+		t.Fatalf("middleware accepted a deleted token: got %v want %v",
+			rr3.Code, http.StatusForbidden)
+	}
+}
+
+var _ TokenStore = (*MemoryStore)(nil)
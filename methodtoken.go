@@ -0,0 +1,70 @@
+package csrf
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MethodToken returns a masked CSRF token that is only valid for requests with
+// the given HTTP method, for use with the MethodBoundTokens option - e.g. in
+// the form that confirms a DELETE. An empty string will be returned if the
+// middleware has not been applied.
+func MethodToken(r *http.Request, method string) string {
+	val, err := contextGet(r, csrfKey)
+	if err != nil {
+		return ""
+	}
+
+	cs, ok := val.(*csrf)
+	realToken := baseToken(r)
+	if !ok || realToken == nil {
+		return ""
+	}
+
+	// Bound tokens are derived with the first key of the ring.
+	keys, err := cs.keyRing(r)
+	if err != nil || len(keys) == 0 || len(keys[0]) == 0 {
+		return ""
+	}
+
+	masked, err := cs.mask(methodBound(keys[0], realToken, method))
+	if err != nil {
+		return ""
+	}
+
+	return masked
+}
+
+// methodLabel identifies the keys that method-bound tokens are derived with.
+var methodLabel = []byte("method-token")
+
+// methodBound derives the token that is valid for method from the real token.
+// It is keyed with a key derived from the authentication key, so that clients
+// can't derive bound tokens from the tokens they hold.
+func methodBound(key, realToken []byte, method string) []byte {
+	msg := append([]byte(strings.ToUpper(method)+"|"), realToken...)
+	return deriveToken(deriveToken(key, methodLabel), msg)
+}
+
+// matchToken reports whether token is the one r must carry: the token bound to
+// its method under any key of the ring if the method is one of the
+// BoundMethods, and the real token otherwise. bound reports whether the method
+// is bound.
+func (cs *csrf) matchToken(r *http.Request, realToken, token []byte) (ok, bound bool) {
+	if !contains(cs.opts.BoundMethods, r.Method) {
+		return compareTokens(token, realToken), false
+	}
+
+	keys, err := cs.keyRing(r)
+	if err != nil {
+		return false, true
+	}
+
+	for _, key := range keys {
+		if len(key) > 0 && compareTokens(token, methodBound(key, realToken, r.Method)) {
+			return true, true
+		}
+	}
+
+	return false, true
+}
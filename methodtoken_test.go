@@ -0,0 +1,73 @@
+package csrf
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Tests that method-bound tokens are only accepted for their own method, and
+// that plain tokens are rejected for bound methods.
+func TestMethodBoundTokens(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, MethodBoundTokens("delete"))(s)
+
+	var token, deleteToken string
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		deleteToken = MethodToken(r, "DELETE")
+	})
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	if deleteToken == "" || deleteToken == token {
+		t.Fatalf("no distinct method token issued: got %q", deleteToken)
+	}
+
+	// A client can't bind its own token to a method without the key.
+	issued, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := make([]byte, tokenLength, tokenLength*2)
+	forged = append(forged, deriveToken(unmask(issued), []byte("method|DELETE"))...)
+	forgedToken := base64.StdEncoding.EncodeToString(forged)
+
+	var methodTests = []struct {
+		method string
+		token  string
+		code   int
+	}{
+		{"DELETE", deleteToken, http.StatusOK},
+		{"DELETE", token, http.StatusForbidden},
+		{"DELETE", forgedToken, http.StatusForbidden},
+		{"POST", deleteToken, http.StatusForbidden},
+		{"POST", token, http.StatusOK},
+	}
+
+	for _, mt := range methodTests {
+		r, err := http.NewRequest(mt.method, "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", mt.token)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != mt.code {
+			t.Fatalf("%s with token %q: wrong status code: got %v want %v",
+				mt.method, mt.token, rr.Code, mt.code)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package csrf
+
+import (
+	"net/http"
+)
+
+// Metrics receives counts of the middleware's activity, for export to a
+// monitoring system such as Prometheus or StatsD. Each method is passed the
+// middleware's Name (which is empty if none was set), for use as a handler
+// label. See WithMetrics.
+//
+// Methods are called synchronously while the request is served, so they
+// should only update counters. Implementations must be safe for concurrent
+// use.
+type Metrics interface {
+	// TokenIssued is called when a new base token is issued to a client,
+	// i.e. when its CSRF cookie is first set or is replaced.
+	TokenIssued(name string)
+	// ValidationPassed is called when a request with an unsafe method passes
+	// validation.
+	ValidationPassed(name string)
+	// ValidationFailed is called when a request fails validation, whether or
+	// not it is then rejected (see ReportOnly).
+	ValidationFailed(name string, kind FailureKind)
+}
+
+// tokenIssued reports a token newly issued for r to the Metrics and Logger, if
+// any.
+func (cs *csrf) tokenIssued(r *http.Request) {
+	if cs.opts.Metrics != nil {
+		cs.opts.Metrics.TokenIssued(cs.opts.Name)
+	}
+
+	if cs.opts.Logger != nil {
+		cs.opts.Logger.tokenIssued(r, cs.opts.Name)
+	}
+}
+
+// validationPassed reports a request that passed validation to the Metrics,
+// if any.
+func (cs *csrf) validationPassed() {
+	if cs.opts.Metrics != nil {
+		cs.opts.Metrics.ValidationPassed(cs.opts.Name)
+	}
+}
+
+// validationFailed reports a request that failed validation to the Metrics
+// and Logger, if any.
+func (cs *csrf) validationFailed(r *http.Request, kind FailureKind, reason error) {
+	if cs.opts.Metrics != nil {
+		cs.opts.Metrics.ValidationFailed(cs.opts.Name, kind)
+	}
+
+	if cs.opts.Logger != nil {
+		cs.opts.Logger.validationFailed(r, cs.opts.Name, kind, reason)
+	}
+}
@@ -0,0 +1,74 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// countMetrics is a Metrics that counts events by name.
+type countMetrics struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (m *countMetrics) add(key string) {
+	m.mu.Lock()
+	m.counts[key]++
+	m.mu.Unlock()
+}
+
+func (m *countMetrics) TokenIssued(name string) { m.add(name + "/issued") }
+
+func (m *countMetrics) ValidationPassed(name string) { m.add(name + "/passed") }
+
+func (m *countMetrics) ValidationFailed(name string, kind FailureKind) {
+	m.add(name + "/failed/" + kind.String())
+}
+
+func TestWithMetrics(t *testing.T) {
+	m := &countMetrics{counts: make(map[string]int)}
+
+	var token string
+	p := Protect(testKey, Name("login"), WithMetrics(m))(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			token = Token(r)
+		}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	for _, tok := range []string{token, ""} {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("X-CSRF-Token", tok)
+		r.Header.Set("Cookie", cookie)
+		p.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := map[string]int{
+		"login/issued":               1,
+		"login/passed":               1,
+		"login/failed/missing-token": 1,
+	}
+
+	if len(m.counts) != len(want) {
+		t.Fatalf("wrong counts: got %v want %v", m.counts, want)
+	}
+
+	for key, n := range want {
+		if m.counts[key] != n {
+			t.Fatalf("wrong count for %s: got %d want %d", key, m.counts[key], n)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package csrf
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Config configures a Middleware created with New. It is an alternative to the
+// functional options accepted by Protect: the zero value of each field keeps
+// the same default as the corresponding option.
+type Config struct {
+	// AuthKey is the key used to authenticate the CSRF cookie. It should be
+	// 32 bytes long and persist across application restarts. Required.
+	AuthKey []byte
+	// MaxAge sets the maximum age (in seconds) of the CSRF cookie. See MaxAge.
+	MaxAge int
+	// Domain sets the Domain of the CSRF cookie. See Domain.
+	Domain string
+	// Path sets the Path of the CSRF cookie. See Path.
+	Path string
+	// Insecure clears the Secure flag on the CSRF cookie. See Secure.
+	Insecure bool
+	// ScriptAccess clears the HttpOnly flag on the CSRF cookie. See HttpOnly.
+	ScriptAccess bool
+	// CookieName sets the name of the CSRF cookie. See CookieName.
+	CookieName string
+	// RequestHeader sets the header the token is read from. See RequestHeader.
+	RequestHeader string
+	// FieldName sets the form field the token is read from. See FieldName.
+	FieldName string
+	// ErrorHandler sets the handler for requests that fail validation. See
+	// ErrorHandler.
+	ErrorHandler http.Handler
+	// Options are applied after the fields above, and configure anything
+	// that has no corresponding field.
+	Options []Option
+}
+
+// options returns the functional options equivalent to c.
+func (c Config) options() []Option {
+	var opts []Option
+	if c.MaxAge != 0 {
+		opts = append(opts, MaxAge(c.MaxAge))
+	}
+
+	if c.Domain != "" {
+		opts = append(opts, Domain(c.Domain))
+	}
+
+	if c.Path != "" {
+		opts = append(opts, Path(c.Path))
+	}
+
+	if c.Insecure {
+		opts = append(opts, Secure(false))
+	}
+
+	if c.ScriptAccess {
+		opts = append(opts, HttpOnly(false))
+	}
+
+	if c.CookieName != "" {
+		opts = append(opts, CookieName(c.CookieName))
+	}
+
+	if c.RequestHeader != "" {
+		opts = append(opts, RequestHeader(c.RequestHeader))
+	}
+
+	if c.FieldName != "" {
+		opts = append(opts, FieldName(c.FieldName))
+	}
+
+	if c.ErrorHandler != nil {
+		opts = append(opts, ErrorHandler(c.ErrorHandler))
+	}
+
+	return append(opts, c.Options...)
+}
+
+// validate reports whether c can be used to create a Middleware.
+func (c Config) validate() error {
+	if len(c.AuthKey) == 0 {
+		return errors.New(errorPrefix + "Config.AuthKey must be set")
+	}
+
+	if c.MaxAge < 0 {
+		return errors.New(errorPrefix + "Config.MaxAge must not be negative")
+	}
+
+	return nil
+}
+
+// Middleware is CSRF protection middleware created from a Config. Unlike the
+// function returned by Protect, it is a concrete type that can be stored,
+// inspected and reconfigured while the application is running.
+//
+// A Middleware is safe for concurrent use.
+type Middleware struct {
+	config atomic.Value // *Config
+}
+
+// New returns a Middleware configured by c, or an error if c is invalid.
+func New(c Config) (*Middleware, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	m := &Middleware{}
+	m.config.Store(&c)
+
+	return m, nil
+}
+
+// Config returns the current configuration of m.
+func (m *Middleware) Config() Config {
+	return *m.config.Load().(*Config)
+}
+
+// Reconfigure replaces the configuration of m. Handlers returned by Handler
+// apply the new configuration to the requests they serve after Reconfigure
+// returns. If c is invalid an error is returned and the configuration is left
+// unchanged.
+func (m *Middleware) Reconfigure(c Config) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	m.config.Store(&c)
+
+	return nil
+}
+
+// Handler returns h wrapped with CSRF protection.
+func (m *Middleware) Handler(h http.Handler) http.Handler {
+	return &middlewareHandler{m: m, h: h}
+}
+
+// Wrap is the same as Handler. The method value m.Wrap has the same type as
+// the function returned by Protect, so it can be passed wherever that is
+// expected - e.g. to a router's Use method.
+func (m *Middleware) Wrap(h http.Handler) http.Handler {
+	return m.Handler(h)
+}
+
+// Token returns a masked CSRF token for a request served by one of m's
+// handlers. See Token.
+func (m *Middleware) Token(r *http.Request) string {
+	return Token(r)
+}
+
+// RotateToken replaces the visitor's real (base) CSRF token with a new one,
+// for a request served by one of m's handlers. Unlike MigrateToken, tokens
+// issued against the previous token are rejected immediately: use it when the
+// previous token may have been compromised.
+//
+// The returned request carries a token issued against the new real token.
+func (m *Middleware) RotateToken(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	return RotateToken(w, r)
+}
+
+// middlewareHandler is the http.Handler returned by Middleware.Handler. It
+// rebuilds its csrf handler whenever the Middleware is reconfigured.
+type middlewareHandler struct {
+	m *Middleware
+	h http.Handler
+
+	current atomic.Value // *configuredCSRF
+	// mu is held while the handler is rebuilt, so that it is built once per
+	// Config: each build has its own token pool, replay cache and so on.
+	mu sync.Mutex
+}
+
+// configuredCSRF is a csrf handler along with the Config it was built from.
+type configuredCSRF struct {
+	config *Config
+	cs     *csrf
+}
+
+func (mh *middlewareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := mh.m.config.Load().(*Config)
+
+	cur, _ := mh.current.Load().(*configuredCSRF)
+	if cur == nil || cur.config != c {
+		cur = mh.rebuild()
+	}
+
+	cur.cs.ServeHTTP(w, r)
+}
+
+// rebuild returns the csrf handler for the Middleware's current Config,
+// building it unless a concurrent request already has.
+func (mh *middlewareHandler) rebuild() *configuredCSRF {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	c := mh.m.config.Load().(*Config)
+	if cur, _ := mh.current.Load().(*configuredCSRF); cur != nil && cur.config == c {
+		return cur
+	}
+
+	cur := &configuredCSRF{
+		config: c,
+		cs:     newCSRF(c.AuthKey, mh.h, c.options()...),
+	}
+	mh.current.Store(cur)
+
+	return cur
+}
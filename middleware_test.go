@@ -0,0 +1,181 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNewInvalidConfig(t *testing.T) {
+	var configTests = []Config{
+		{},
+		{AuthKey: testKey, MaxAge: -1},
+	}
+
+	for _, c := range configTests {
+		if _, err := New(c); err == nil {
+			t.Fatalf("New accepted an invalid config: %+v", c)
+		}
+	}
+}
+
+// Tests that a Middleware protects its handlers and that Reconfigure applies
+// to handlers that have already been created.
+func TestMiddlewareReconfigure(t *testing.T) {
+	m, err := New(Config{AuthKey: testKey, CookieName: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var token string
+	p := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = m.Token(r)
+	}))
+
+	get := func(cookie string) {
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if token == "" {
+			t.Fatal("Middleware.Token returned an empty token")
+		}
+
+		if got := rr.Header().Get("Set-Cookie"); !strings.HasPrefix(got, cookie+"=") {
+			t.Fatalf("cookie does not respect the config: got %q want name %q", got, cookie)
+		}
+	}
+
+	get("first")
+
+	if err := m.Reconfigure(Config{}); err == nil {
+		t.Fatal("Reconfigure accepted an invalid config")
+	}
+
+	get("first")
+
+	c := m.Config()
+	c.CookieName = "second"
+	if err := m.Reconfigure(c); err != nil {
+		t.Fatal(err)
+	}
+
+	get("second")
+
+	// Unsafe requests without a token are still rejected.
+	r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("middleware failed to reject a request without a token: got %v want %v",
+			rr.Code, http.StatusForbidden)
+	}
+}
+
+// Tests that RotateToken rejects tokens issued before the rotation, and that
+// the returned request carries a token that is accepted.
+// Tests that concurrent requests build the handler once per Config.
+func TestMiddlewareBuildOnce(t *testing.T) {
+	var builds int32
+	count := func(cs *csrf) { atomic.AddInt32(&builds, 1) }
+
+	m, err := New(Config{AuthKey: testKey, Options: []Option{count}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, want := range []int32{1, 2} {
+		if i > 0 {
+			if err := m.Reconfigure(m.Config()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var wg sync.WaitGroup
+		for j := 0; j < 16; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			}()
+		}
+		wg.Wait()
+
+		if got := atomic.LoadInt32(&builds); got != want {
+			t.Fatalf("handler built %d times, want %d", got, want)
+		}
+	}
+}
+
+func TestMiddlewareRotateToken(t *testing.T) {
+	m, err := New(Config{AuthKey: testKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wrap func(http.Handler) http.Handler = m.Wrap
+
+	var oldToken, newToken string
+	p := wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rotate" {
+			return
+		}
+
+		oldToken = m.Token(r)
+		r, err := m.RotateToken(w, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newToken = m.Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/rotate", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	// The rotation's cookie is the last one set.
+	cookies := rr.Header()["Set-Cookie"]
+	cookie := cookies[len(cookies)-1]
+
+	var rotateTests = []struct {
+		token string
+		code  int
+	}{
+		{oldToken, http.StatusForbidden},
+		{newToken, http.StatusOK},
+	}
+
+	for _, rt := range rotateTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", rt.token)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != rt.code {
+			t.Fatalf("wrong status code: got %v want %v", rr.Code, rt.code)
+		}
+	}
+}
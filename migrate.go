@@ -0,0 +1,100 @@
+package csrf
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// graceSuffix is appended to the cookie name to form the name of the
+	// cookie holding the previous real token after a MigrateToken call.
+	graceSuffix = "_prev"
+	// graceAge is the MaxAge (in seconds) of the previous-token cookie.
+	graceAge = 300
+)
+
+// MigrateToken replaces the visitor's real (base) CSRF token with a new one in
+// a single response. Call it when an anonymous session is upgraded to an
+// authenticated one - typically from the handler that performs the login - so
+// that the token used before authentication doesn't outlive it.
+//
+// Requests already in flight with a token issued against the previous token
+// (e.g. a form submitted twice, or another open tab) are accepted once within
+// a short grace period, so the migration itself doesn't cause spurious
+// failures.
+//
+// The returned request carries a token (see Token and TemplateField) issued
+// against the new real token, for use when rendering the remainder of the
+// response.
+func MigrateToken(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	val, err := contextGet(r, csrfKey)
+	if err != nil {
+		return r, errors.New(errorPrefix + "MigrateToken called without the CSRF middleware")
+	}
+
+	return val.(*csrf).rotate(w, r, true)
+}
+
+// RotateToken replaces the visitor's real (base) CSRF token with a new one and
+// re-issues the CSRF cookie. Call it when the visitor's privileges change - at
+// login and at logout - so that a token obtained before the change can't be
+// used after it. Unlike MigrateToken, tokens issued against the previous token
+// are rejected immediately, including those in other open tabs.
+//
+// The returned request carries a token (see Token and TemplateField) issued
+// against the new real token, for use when rendering the remainder of the
+// response.
+func RotateToken(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	val, err := contextGet(r, csrfKey)
+	if err != nil {
+		return r, errors.New(errorPrefix + "RotateToken called without the CSRF middleware")
+	}
+
+	return val.(*csrf).rotate(w, r, false)
+}
+
+// rotate replaces the real token for r with a new one, keeping the previous
+// token for acceptGrace if keepPrevious is set.
+func (cs *csrf) rotate(w http.ResponseWriter, r *http.Request, keepPrevious bool) (*http.Request, error) {
+	newToken, err := cs.randomToken()
+	if err != nil {
+		return r, err
+	}
+
+	if err := cs.st.Save(newToken, w, r); err != nil {
+		return r, err
+	}
+	cs.tokenIssued(r)
+
+	// Keep the previous token around so that it can be accepted once.
+	if old := baseToken(r); old != nil && keepPrevious {
+		if err := cs.grace.Save(old, w, r); err != nil {
+			return r, err
+		}
+	}
+
+	masked, err := cs.mask(newToken)
+	if err != nil {
+		return r, err
+	}
+
+	r = contextSave(r, tokenKey, masked)
+	r = contextSave(r, baseTokenKey, newToken)
+	r = contextSave(r, issuedKey, time.Now())
+	return r, nil
+}
+
+// acceptGrace reports whether requestToken matches the previous real token
+// retained by MigrateToken. A match consumes the previous token, so that it is
+// accepted at most once.
+func (cs *csrf) acceptGrace(w http.ResponseWriter, r *http.Request, requestToken []byte) bool {
+	prevToken, err := cs.grace.Get(r)
+	if err != nil || !compareTokens(requestToken, prevToken) {
+		return false
+	}
+
+	cs.grace.clear(w, r)
+	return true
+}
@@ -0,0 +1,236 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestMigrateToken checks that MigrateToken issues a new real token, and that
+// a token issued against the previous one is accepted exactly once.
+func TestMigrateToken(t *testing.T) {
+	var token string
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+	s.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		r, err := MigrateToken(w, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token = Token(r)
+	})
+	p := Protect(testKey)(s)
+
+	jar := make(map[string]*http.Cookie)
+	do := func(method, path, tok string) int {
+		r, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range jar {
+			r.AddCookie(c)
+		}
+		r.Header.Set("X-CSRF-Token", tok)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		for _, c := range rr.Result().Cookies() {
+			if c.MaxAge < 0 {
+				delete(jar, c.Name)
+				continue
+			}
+			jar[c.Name] = c
+		}
+
+		return rr.Code
+	}
+
+	do("GET", "/", "")
+	anonToken := token
+
+	if code := do("POST", "/login", anonToken); code != http.StatusOK {
+		t.Fatalf("login request was rejected: got %v want %v", code, http.StatusOK)
+	}
+	authToken := token
+
+	if authToken == anonToken {
+		t.Fatal("MigrateToken did not issue a new token")
+	}
+
+	if _, ok := jar[cookieName+graceSuffix]; !ok {
+		t.Fatal("MigrateToken did not retain the previous token")
+	}
+
+	// The pre-login token is accepted once...
+	if code := do("POST", "/", anonToken); code != http.StatusOK {
+		t.Fatalf("previous token was not accepted: got %v want %v", code, http.StatusOK)
+	}
+
+	// ... but not twice.
+	if code := do("POST", "/", anonToken); code != http.StatusForbidden {
+		t.Fatalf("previous token was accepted twice: got %v want %v",
+			code, http.StatusForbidden)
+	}
+
+	if code := do("POST", "/", authToken); code != http.StatusOK {
+		t.Fatalf("migrated token was not accepted: got %v want %v", code, http.StatusOK)
+	}
+}
+
+// TestMigrateTokenGraceExpiry checks that the previous token's cookie is
+// rejected once it is older than graceAge, even if the client keeps sending it.
+func TestMigrateTokenGraceExpiry(t *testing.T) {
+	var token string
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+	s.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		r, err := MigrateToken(w, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token = Token(r)
+	})
+	p := Protect(testKey)(s)
+
+	do := func(method, path, tok string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		r.Header.Set("X-CSRF-Token", tok)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		return rr
+	}
+
+	rr := do("GET", "/", "", nil)
+	anonToken := token
+	anonCookies := rr.Result().Cookies()
+
+	rr = do("POST", "/login", anonToken, anonCookies)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login request was rejected: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var session, prev *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		switch c.Name {
+		case cookieName:
+			session = c
+		case cookieName + graceSuffix:
+			prev = c
+		}
+	}
+	if session == nil || prev == nil {
+		t.Fatal("MigrateToken did not set the session and previous token cookies")
+	}
+
+	hc := newHMACCodec(graceAge, testKey)
+	old, err := hc.Decode(prev.Name, prev.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var graceTests = []struct {
+		age  time.Duration
+		code int
+	}{
+		{(graceAge + 60) * time.Second, http.StatusForbidden},
+		{0, http.StatusOK},
+	}
+
+	for _, gt := range graceTests {
+		value, err := hc.encodeAt(prev.Name, old, time.Now().Add(-gt.age))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale := &http.Cookie{Name: prev.Name, Value: value}
+
+		rr := do("POST", "/", anonToken, []*http.Cookie{session, stale})
+		if rr.Code != gt.code {
+			t.Fatalf("previous token cookie aged %v: got %v want %v",
+				gt.age, rr.Code, gt.code)
+		}
+	}
+}
+
+// TestRotateToken checks that tokens issued before a rotation are rejected,
+// while the token on the returned request is accepted.
+func TestRotateToken(t *testing.T) {
+	var oldToken, newToken string
+	p := Protect(testKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oldToken = Token(r)
+		r, err := RotateToken(w, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newToken = Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	// The rotation's cookie is the last one set.
+	cookies := rr.Header()["Set-Cookie"]
+	cookie := cookies[len(cookies)-1]
+
+	var rotateTests = []struct {
+		token string
+		code  int
+	}{
+		{oldToken, http.StatusForbidden},
+		{newToken, http.StatusOK},
+	}
+
+	for _, rt := range rotateTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", rt.token)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != rt.code {
+			t.Fatalf("wrong status code: got %v want %v", rr.Code, rt.code)
+		}
+	}
+
+	if _, err := RotateToken(httptest.NewRecorder(), r); err == nil {
+		t.Fatal("RotateToken did not report a missing middleware")
+	}
+}
+
+// TestMigrateTokenWithoutMiddleware checks that MigrateToken reports an error
+// when the middleware has not been applied.
+func TestMigrateTokenWithoutMiddleware(t *testing.T) {
+	r, err := http.NewRequest("POST", "/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MigrateToken(httptest.NewRecorder(), r); err == nil {
+		t.Fatal("MigrateToken did not report a missing middleware")
+	}
+}
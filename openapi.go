@@ -0,0 +1,134 @@
+package csrf
+
+import "fmt"
+
+// OpenAPI component names used by OpenAPIComponents.
+const (
+	// OpenAPIHeaderScheme names the security scheme describing the request
+	// header that carries the masked CSRF token.
+	OpenAPIHeaderScheme = "csrfToken"
+	// OpenAPIXSRFHeaderScheme names the security scheme describing the header
+	// set from the XSRFCookie, if configured.
+	OpenAPIXSRFHeaderScheme = "csrfXSRFToken"
+	// OpenAPIAuthorizationScheme names the security scheme describing the
+	// Authorization header scheme that carries the token, if configured with
+	// AuthorizationScheme.
+	OpenAPIAuthorizationScheme = "csrfAuthorization"
+	// OpenAPICookieScheme names the security scheme describing the CSRF
+	// cookie that must accompany the token.
+	OpenAPICookieScheme = "csrfCookie"
+	// OpenAPIFailureResponse names the response returned when a request fails
+	// CSRF validation.
+	OpenAPIFailureResponse = "CSRFFailure"
+	// OpenAPIErrorSchema names the schema of the JSON body of the failure
+	// response (see ErrorResponse).
+	OpenAPIErrorSchema = "CSRFError"
+)
+
+// OpenAPIComponents returns an OpenAPI 3 "components" object describing the CSRF
+// protection configured by opts. It contains an apiKey security scheme for each
+// header the middleware accepts the token in - the RequestHeader, and the
+// XSRFCookie header and AuthorizationScheme if set - one for the CSRF cookie
+// that must accompany it, and a reusable response (with the ErrorResponse
+// schema) for requests that fail validation.
+//
+// Pass the same options that are given to Protect so that the API description
+// stays in sync with runtime behavior. The result can be marshalled to JSON
+// (or YAML) and merged into an existing specification:
+//
+//	opts := []csrf.Option{csrf.RequestHeader("X-XSRF-Token")}
+//	spec["components"] = csrf.OpenAPIComponents(opts...)
+//	http.ListenAndServe(":8000", csrf.Protect(key, opts...)(r))
+//
+// Operations that mutate state should then require the cookie and one of the
+// token schemes, and reference the failure response under the FailureStatus
+// (403 by default):
+//
+//	security:
+//	  - csrfToken: []
+//	    csrfCookie: []
+//	responses:
+//	  "403":
+//	    $ref: "#/components/responses/CSRFFailure"
+func OpenAPIComponents(opts ...Option) map[string]interface{} {
+	cs := parseOptions(nil, opts...)
+	cs.opts.setDefaults()
+	cs.applyPrefix()
+
+	schemes := map[string]interface{}{
+		OpenAPIHeaderScheme: map[string]interface{}{
+			"type":        "apiKey",
+			"in":          "header",
+			"name":        cs.opts.RequestHeader,
+			"description": "Masked CSRF token as returned by csrf.Token.",
+		},
+		OpenAPICookieScheme: map[string]interface{}{
+			"type":        "apiKey",
+			"in":          "cookie",
+			"name":        cs.opts.CookieName,
+			"description": "Authenticated CSRF cookie issued by the server.",
+		},
+	}
+
+	if cs.opts.XSRFHeader != "" {
+		schemes[OpenAPIXSRFHeaderScheme] = map[string]interface{}{
+			"type":        "apiKey",
+			"in":          "header",
+			"name":        cs.opts.XSRFHeader,
+			"description": "Masked CSRF token as read from the " + cs.opts.XSRFCookie + " cookie.",
+		}
+	}
+
+	if cs.opts.AuthScheme != "" {
+		schemes[OpenAPIAuthorizationScheme] = map[string]interface{}{
+			"type":        "http",
+			"scheme":      cs.opts.AuthScheme,
+			"description": "Masked CSRF token as returned by csrf.Token.",
+		}
+	}
+
+	status := cs.opts.FailureStatus
+
+	return map[string]interface{}{
+		"securitySchemes": schemes,
+		"schemas": map[string]interface{}{
+			OpenAPIErrorSchema: map[string]interface{}{
+				"type":     "object",
+				"required": []string{"error", "reason", "kind"},
+				"properties": map[string]interface{}{
+					"error": map[string]interface{}{
+						"type":    "string",
+						"example": statusText(status),
+					},
+					"reason": map[string]interface{}{
+						"type":    "string",
+						"example": ErrBadToken.Error(),
+					},
+					"kind": map[string]interface{}{
+						"type":    "string",
+						"example": TokenMismatch.String(),
+					},
+				},
+			},
+		},
+		"responses": map[string]interface{}{
+			OpenAPIFailureResponse: map[string]interface{}{
+				"description": fmt.Sprintf("The request failed CSRF validation (%d %s).",
+					status, statusText(status)),
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{
+							"$ref": "#/components/schemas/" + OpenAPIErrorSchema,
+						},
+					},
+					"text/plain": map[string]interface{}{
+						"schema": map[string]interface{}{
+							"type":    "string",
+							"example": statusText(status) + " - " + ErrBadToken.Error(),
+						},
+					},
+				},
+			},
+		},
+	}
+}
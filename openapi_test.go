@@ -0,0 +1,109 @@
+package csrf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIComponents checks that the generated components reflect the
+// configured header and cookie names.
+func TestOpenAPIComponents(t *testing.T) {
+	header := "X-XSRF-Token"
+	name := "_chimpanzee_csrf"
+
+	c := OpenAPIComponents(RequestHeader(header), CookieName(name))
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schemes := c["securitySchemes"].(map[string]interface{})
+	headerScheme := schemes[OpenAPIHeaderScheme].(map[string]interface{})
+	if headerScheme["name"] != header || headerScheme["in"] != "header" {
+		t.Fatalf("header scheme does not match RequestHeader option: got %s", b)
+	}
+
+	cookieScheme := schemes[OpenAPICookieScheme].(map[string]interface{})
+	if cookieScheme["name"] != name || cookieScheme["in"] != "cookie" {
+		t.Fatalf("cookie scheme does not match CookieName option: got %s", b)
+	}
+
+	if !strings.Contains(string(b), OpenAPIFailureResponse) {
+		t.Fatalf("failure response missing from components: got %s", b)
+	}
+
+	// Defaults apply when no options are given.
+	c = OpenAPIComponents()
+	schemes = c["securitySchemes"].(map[string]interface{})
+	if got := schemes[OpenAPIHeaderScheme].(map[string]interface{})["name"]; got != headerName {
+		t.Fatalf("default header name not used: got %v want %v", got, headerName)
+	}
+}
+
+// TestOpenAPIComponentsRuntime checks that the generated components describe
+// what the middleware does with the same options: the prefixed cookie name,
+// every header the token is accepted in and the failure status and body.
+func TestOpenAPIComponentsRuntime(t *testing.T) {
+	opts := []Option{
+		WithCookiePrefix(HostPrefix),
+		XSRFCookie("", ""),
+		AuthorizationScheme("CSRF"),
+		FailureStatus(419),
+	}
+
+	c := OpenAPIComponents(opts...)
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	Protect(testKey, opts...)(http.HandlerFunc(testHandler)).ServeHTTP(rr, r)
+
+	schemes := c["securitySchemes"].(map[string]interface{})
+	name := schemes[OpenAPICookieScheme].(map[string]interface{})["name"].(string)
+	if !strings.HasPrefix(rr.Header().Get("Set-Cookie"), name+"=") {
+		t.Fatalf("cookie scheme %q does not match the cookie set: %q",
+			name, rr.Header().Get("Set-Cookie"))
+	}
+
+	var schemeTests = []struct {
+		scheme string
+		key    string
+		want   string
+	}{
+		{OpenAPIHeaderScheme, "name", headerName},
+		{OpenAPIXSRFHeaderScheme, "name", defaultXSRFHeader},
+		{OpenAPIAuthorizationScheme, "scheme", "CSRF"},
+	}
+
+	for _, st := range schemeTests {
+		scheme, ok := schemes[st.scheme].(map[string]interface{})
+		if !ok || scheme[st.key] != st.want {
+			t.Fatalf("%s: scheme missing or wrong: got %s", st.scheme, b)
+		}
+	}
+
+	response := c["responses"].(map[string]interface{})[OpenAPIFailureResponse].(map[string]interface{})
+	if !strings.Contains(response["description"].(string), "419") {
+		t.Fatalf("failure response does not describe FailureStatus: got %s", b)
+	}
+
+	content := response["content"].(map[string]interface{})
+	if _, ok := content["application/json"]; !ok {
+		t.Fatalf("failure response has no JSON body: got %s", b)
+	}
+
+	if _, ok := c["schemas"].(map[string]interface{})[OpenAPIErrorSchema]; !ok {
+		t.Fatalf("ErrorResponse schema missing: got %s", b)
+	}
+}
@@ -1,6 +1,17 @@
 package csrf
 
-import "net/http"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
 
 // Option describes a functional option for configuring the CSRF handler.
 type Option func(*csrf)
@@ -25,6 +36,60 @@ func Domain(domain string) Option {
 	}
 }
 
+// DomainFunc sets a function that returns the Domain of the CSRF cookie for a
+// request, for deployments where it can't be fixed with Domain - e.g. to scope
+// the cookie to each tenant's apex domain when tenants are served from
+// wildcard virtual hosts:
+//
+//	csrf.DomainFunc(func(r *http.Request) string {
+//		return tenantApex(r.Host)
+//	})
+//
+// If the function returns "", the configured Domain is used. The result is
+// ignored for __Host- cookies (see WithCookiePrefix) and under IsolatedScope,
+// and is overridden by WithCookieAttributes.
+func DomainFunc(fn func(r *http.Request) string) Option {
+	return func(cs *csrf) {
+		cs.opts.DomainFunc = fn
+	}
+}
+
+// PathFunc sets a function that returns the Path of the CSRF cookie for a
+// request, as DomainFunc does for its Domain. If the function returns "", the
+// configured Path is used.
+func PathFunc(fn func(r *http.Request) string) Option {
+	return func(cs *csrf) {
+		cs.opts.PathFunc = fn
+	}
+}
+
+// SharedDomain shares the CSRF cookie between the apex domain and all of its
+// subdomains - e.g. for an SSO portal on "login.example.com" that posts to
+// "app.example.com" - by scoping the cookie to domain. Every subdomain must
+// run the middleware with the same authentication key (or KeyFunc key ring).
+//
+// Because any subdomain can then read and set the cookie, requests with unsafe
+// methods must carry a Referer from domain or one of its subdomains, made with
+// the same scheme as the request, over plain HTTP as well as HTTPS. Only
+// enable this if every subdomain is trusted.
+func SharedDomain(domain string) Option {
+	return func(cs *csrf) {
+		cs.opts.SharedDomain = domain
+		cs.opts.Domain = domain
+	}
+}
+
+// Scope sets whether the hosts served by the middleware share CSRF cookies and
+// tokens (SharedScope, the default) or each have their own (IsolatedScope).
+// Use IsolatedScope when one application serves several unrelated domains, so
+// that a token issued on one domain can never be accepted on another. The
+// Domain and SharedDomain options are ignored under IsolatedScope.
+func Scope(scope CookieScope) Option {
+	return func(cs *csrf) {
+		cs.opts.Scope = scope
+	}
+}
+
 // Path sets the cookie path. Defaults to the path the cookie was issued from
 // (recommended).
 //
@@ -58,10 +123,50 @@ func HttpOnly(h bool) Option {
 	}
 }
 
+// TokenMaxAge limits how long a token (as returned by Token) remains valid,
+// independently of the MaxAge of the CSRF cookie - e.g. 12-hour cookies but
+// 30-minute form tokens. Tokens carry the time they were issued, and requests
+// with a token older than d fail with ErrTokenExpired. Tokens issued before
+// TokenMaxAge was set are rejected.
+//
+// The time is authenticated with a key derived from the key passed to Protect
+// (or PreviousKeys), which must be set even with KeyFunc or WithSigner.
+func TokenMaxAge(d time.Duration) Option {
+	return func(cs *csrf) {
+		cs.opts.TokenMaxAge = d
+	}
+}
+
+// WithCookiePrefix prefixes the name of the CSRF cookie with p, and sets the
+// cookie attributes the prefix requires, so that browsers enforce them:
+// HostPrefix names the cookie "__Host-_gorilla_csrf" (with the default
+// CookieName) and makes it Secure and host-only with Path "/", overriding the
+// Domain, SharedDomain and Path options; SecurePrefix makes it Secure. The
+// cookie stays Secure in development (see Development); browsers accept
+// Secure cookies from http://localhost.
+func WithCookiePrefix(p CookiePrefix) Option {
+	return func(cs *csrf) {
+		cs.opts.CookiePrefix = p
+	}
+}
+
+// SameSite sets the 'SameSite' attribute on the cookie. Defaults to
+// SameSiteDefaultMode, which omits the attribute. SameSiteNoneMode - e.g. for
+// forms embedded in a third-party iframe - also requires the cookie to be
+// Secure, which it is by default. See also WithCookieAttributes to set the
+// attribute for individual requests.
+func SameSite(s SameSiteMode) Option {
+	return func(cs *csrf) {
+		cs.opts.SameSite = s
+	}
+}
+
 // ErrorHandler allows you to change the handler called when CSRF request
 // processing encounters an invalid token or request. A typical use would be to
 // provide a handler that returns a static HTML file with a HTTP 403 status. By
-// default a HTTP 403 status and a plain text CSRF failure reason are served.
+// default a HTTP 403 status is served with an HTML page, a JSON ErrorResponse or
+// the plain text CSRF failure reason, according to the request's Accept header
+// (see NegotiatedErrorHandler).
 //
 // Note that a custom error handler can also access the csrf.FailureReason(r)
 // function to retrieve the CSRF validation reason from the request context.
@@ -71,6 +176,78 @@ func ErrorHandler(h http.Handler) Option {
 	}
 }
 
+// ErrorHandlerFor sets the handler called for requests matched by match when
+// CSRF request processing fails, in place of the ErrorHandler. This allows
+// different parts of an application to render failures differently - e.g. JSON
+// for an API subtree and an HTML page elsewhere - while sharing a single CSRF
+// cookie.
+//
+// ErrorHandlerFor may be passed more than once: the handler for the first
+// matching option is used, and requests matched by none use the ErrorHandler.
+func ErrorHandlerFor(match func(r *http.Request) bool, h http.Handler) Option {
+	return func(cs *csrf) {
+		cs.opts.ErrorHandlers = append(cs.opts.ErrorHandlers, errorRoute{match, h})
+	}
+}
+
+// HTMXErrors answers htmx requests (see IsHTMX) that fail CSRF validation
+// with the response configured by e, in place of the ErrorHandler. By default
+// they get a 422 Unprocessable Entity status, which htmx reports as an error
+// rather than swapping into the page, and the failure reason as plain text.
+//
+// It is shorthand for ErrorHandlerFor(IsHTMX, HTMXErrorHandler(e)).
+func HTMXErrors(e HTMXError) Option {
+	return ErrorHandlerFor(IsHTMX, HTMXErrorHandler(e))
+}
+
+// FailureStatus sets the status code that requests failing CSRF validation
+// are rejected with by the default ErrorHandler, in place of 403 Forbidden -
+// e.g. 419, 422 or 400 for front-ends that treat a 403 as the end of a login
+// session. Custom error handlers can get it with FailureStatusOf. Codes
+// outside the 4xx range are ignored.
+func FailureStatus(code int) Option {
+	return func(cs *csrf) {
+		if code < 400 || code > 499 {
+			log.Printf("%signoring invalid failure status %d: not a 4xx code", errorPrefix, code)
+			return
+		}
+
+		cs.opts.FailureStatus = code
+	}
+}
+
+// ReissueOnFailure attaches the token to the responses to requests that fail
+// validation because of their token or CSRF cookie - one that is missing,
+// stale or expired - in the named response header, so that JavaScript clients
+// can retry the request once with it instead of reloading the page. The
+// header defaults to the RequestHeader (X-CSRF-Token), which the retry then
+// sends the token back in. A CSRF cookie that was missing or unusable is
+// replaced on the same response, and the XSRFCookie, if set, is refreshed.
+//
+// Requests rejected for their origin (or by a Validator) get no token.
+// Clients should retry at most once, and only requests that failed with the
+// header present.
+func ReissueOnFailure(header string) Option {
+	return func(cs *csrf) {
+		cs.opts.Reissue = true
+		cs.opts.ReissueHeader = header
+	}
+}
+
+// RedirectOnFailure redirects browsers whose form submissions fail CSRF
+// validation back to the form, with a query parameter marking the failure, in
+// place of the ErrorHandler: a user who left a form open until their token
+// expired then gets the form again instead of a bare error page. Requests
+// from scripts, including htmx, still get the ErrorHandler. See
+// RedirectErrorHandler for how the redirect is built.
+//
+// It is shorthand for ErrorHandlerFor with RedirectErrorHandler(f), matching
+// requests that prefer text/html; pass HTMXErrors or other ErrorHandlerFor
+// options first for them to take precedence.
+func RedirectOnFailure(f FailureRedirect) Option {
+	return ErrorHandlerFor(browserNavigation, RedirectErrorHandler(f))
+}
+
 // RequestHeader allows you to change the request header the CSRF middleware
 // inspects. The default is X-CSRF-Token.
 func RequestHeader(header string) Option {
@@ -79,6 +256,19 @@ func RequestHeader(header string) Option {
 	}
 }
 
+// AuthorizationScheme additionally accepts the token in the Authorization
+// header with the given scheme - e.g. "Authorization: CSRF <token>" for the
+// scheme "CSRF" - for clients that can set the Authorization header but not
+// arbitrary headers. The RequestHeader is checked first.
+//
+// Don't use a scheme that the application uses for authentication, such as
+// "Bearer": the header can only carry one set of credentials.
+func AuthorizationScheme(scheme string) Option {
+	return func(cs *csrf) {
+		cs.opts.AuthScheme = scheme
+	}
+}
+
 // FieldName allows you to change the name attribute of the hidden <input> field
 // inspected by this package. The default is 'gorilla.csrf.Token'.
 func FieldName(name string) Option {
@@ -97,8 +287,776 @@ func CookieName(name string) Option {
 	}
 }
 
+// EnforcementSwitch allows the enforcement mode to be changed at runtime via
+// the provided Switch - e.g. to move a class of routes into ReportOnly mode
+// while a wave of false positives is investigated, without a redeploy.
+// Requests are enforced by default.
+func EnforcementSwitch(s *Switch) Option {
+	return func(cs *csrf) {
+		cs.opts.Enforcement = s
+	}
+}
+
+// Mode sets the enforcement mode for every request. ReportOnly runs
+// validation and records failures - in the request context (see
+// FailureKindOf) and with any Metrics, Logger or Tracer - but serves the
+// request anyway, so that protection can be trialled on an existing
+// application before it is enforced. Defaults to Enforce. An
+// EnforcementSwitch, if set, takes precedence.
+func Mode(e Enforcement) Option {
+	return func(cs *csrf) {
+		cs.opts.Mode = e
+	}
+}
+
+// FingerprintHeader sets a response header in which the middleware reports a
+// short hash of its effective configuration. Comparing the header across
+// responses makes it easy to spot instances behind a load balancer that are
+// running a stale or divergent CSRF policy. The hash does not include the
+// authentication key.
+//
+// The header is diagnostic and discloses (a digest of) internal
+// configuration: only enable it in internal environments.
+func FingerprintHeader(name string) Option {
+	return func(cs *csrf) {
+		cs.opts.FingerprintHeader = name
+	}
+}
+
+// FailurePolicy sets how the middleware responds to its own internal errors -
+// e.g. a failure of the system's random number generator or of the token
+// store - as opposed to requests that fail validation. The default,
+// FailClosed, rejects such requests with a HTTP 503 status.
+//
+// FailOpen serves the request without CSRF protection and logs the error. Only
+// choose it where availability matters more than protection and the logs are
+// monitored.
+func FailurePolicy(m FailureMode) Option {
+	return func(cs *csrf) {
+		cs.opts.FailurePolicy = m
+	}
+}
+
+// RandomRetry sets how many attempts are made at reading from the system's
+// secure random number generator when generating a token, and the delay
+// before the first retry, which doubles with each further attempt. The
+// default is 3 attempts, starting at 10ms; 1 attempt disables retries.
+//
+// If every attempt fails the request is handled according to the
+// FailurePolicy, and reported to the AlertFunc.
+func RandomRetry(attempts int, backoff time.Duration) Option {
+	return func(cs *csrf) {
+		cs.opts.RandAttempts = attempts
+		cs.opts.RandBackoff = backoff
+	}
+}
+
+// AlertFunc sets a function that is called with each of the middleware's
+// internal errors - e.g. a failure of the system's random number generator or
+// of the token store - before the request is handled according to the
+// FailurePolicy. Use it to alert operators: unlike requests that fail
+// validation, these errors indicate that the middleware can't protect (or,
+// under FailOpen, isn't protecting) the application.
+func AlertFunc(fn func(r *http.Request, err error)) Option {
+	return func(cs *csrf) {
+		cs.opts.Alert = fn
+	}
+}
+
+// Honeypot adds a decoy field with the given name to the markup produced by
+// TemplateField. The field is hidden from humans, so a request that submits it
+// with a value is almost certainly from a bot (or a replayed, scraped form) and
+// is rejected with ErrHoneypot. If audit is non-nil it is called for every such
+// request before the ErrorHandler, e.g. to record an audit event.
+//
+// The name should look like a plausible form field (e.g. "website") and must
+// not clash with a real field.
+func Honeypot(name string, audit func(r *http.Request)) Option {
+	return func(cs *csrf) {
+		cs.opts.HoneypotField = name
+		cs.opts.HoneypotAudit = audit
+	}
+}
+
+// Classify sets a Classifier that is called for every request before the CSRF
+// token is validated, allowing CSRF enforcement to be integrated with broader
+// abuse defenses. Depending on its Verdict the request is allowed, tagged,
+// tarpitted or rejected with ErrAutomated.
+func Classify(c Classifier) Option {
+	return func(cs *csrf) {
+		cs.opts.Classifier = c
+	}
+}
+
+// TarpitDelay sets how long a request is delayed when a Classifier returns
+// Tarpit. Defaults to 3 seconds. The delay ends early if the client goes away.
+func TarpitDelay(d time.Duration) Option {
+	return func(cs *csrf) {
+		cs.opts.TarpitDelay = d
+	}
+}
+
+// Validators appends checks that are run, in order, after the CSRF token of a
+// request with an unsafe method has been validated. The first error returned
+// fails the request and is passed through the same error handling (and
+// reporting) as a CSRF failure.
+func Validators(v ...Validator) Option {
+	return func(cs *csrf) {
+		cs.opts.Validators = append(cs.opts.Validators, v...)
+	}
+}
+
+// Normalize appends Normalizers that are applied, in order, to every request
+// before any other CSRF processing takes place.
+func Normalize(n ...Normalizer) Option {
+	return func(cs *csrf) {
+		cs.opts.Normalizers = append(cs.opts.Normalizers, n...)
+	}
+}
+
+// HostOptions configures options for individual hosts, so that a single
+// middleware instance can serve many (e.g. customer) domains with different
+// cookie domains, error handlers and so on. Each host's options are applied on
+// top of the other options passed to Protect. Requests for hosts not in the map
+// use the shared options.
+//
+// Hosts are matched case-insensitively against the request's Host, ignoring
+// any port. Repeated calls add to the map.
+//
+//	csrf.Protect(key,
+//		csrf.Secure(true),
+//		csrf.HostOptions(map[string][]csrf.Option{
+//			"shop.example.com": {csrf.Domain("example.com")},
+//			"www.example.org":  {csrf.ErrorHandler(orgErrorPage)},
+//		}),
+//	)
+func HostOptions(hosts map[string][]Option) Option {
+	return func(cs *csrf) {
+		if cs.opts.Hosts == nil {
+			cs.opts.Hosts = make(map[string][]Option, len(hosts))
+		}
+
+		for host, opts := range hosts {
+			cs.opts.Hosts[host] = opts
+		}
+	}
+}
+
+// KeyFunc sets a function that returns the authentication key ring for a
+// request, instead of using the key passed to Protect for every request. This
+// allows each tenant (e.g. each host) of a multi-tenant application to use its
+// own keys - say, derived from a per-tenant KMS key - so that tokens issued
+// for one tenant are never accepted by another. For a single key per host:
+//
+//	csrf.KeyFunc(func(r *http.Request) ([][]byte, error) {
+//		key, err := tenantKey(r.Host)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return [][]byte{key}, nil
+//	})
+//
+// Scope(IsolatedScope) isolates hosts without separate keys, by deriving a key
+// for each host from the key passed to Protect.
+//
+// Cookies are signed with the first key in the ring and accepted if they
+// verify with any of them, so keys can be rotated by prepending the new key.
+// An error returned by the function is handled according to the
+// FailurePolicy.
+func KeyFunc(fn func(r *http.Request) ([][]byte, error)) Option {
+	return func(cs *csrf) {
+		cs.opts.KeyFunc = fn
+	}
+}
+
+// PreviousKeys sets authentication keys that were previously passed to
+// Protect, so that the key can be rotated without invalidating the tokens of
+// every visitor mid-form. Cookies are always signed with the key passed to
+// Protect, and accepted if they verify with it or any of the previous keys;
+// cookies verified with a previous key are re-signed with the new key as the
+// visitor's token is reissued. Remove previous keys once cookies signed with
+// them have expired (see MaxAge).
+//
+// PreviousKeys has no effect if a KeyFunc is set: include the previous keys in
+// the key ring it returns instead.
+func PreviousKeys(keys ...[]byte) Option {
+	return func(cs *csrf) {
+		cs.prevKeys = append(cs.prevKeys, keys...)
+	}
+}
+
+// WithSigner signs and verifies CSRF cookies with signer instead of the
+// authentication key, so that the signing key can be kept in a KMS or HSM and
+// never held in process memory. Each request that issues or validates a token
+// makes a call to signer, so its latency adds to that of the request.
+//
+// The key passed to Protect (which may be nil) is still used by the options
+// that derive keys from it, such as SessionCookie and RequestSigning. KeyFunc,
+// PreviousKeys and CookieEncoding have no effect on cookies when a Signer is
+// set: rotate keys within the Signer, which should accept signatures made with
+// previous keys until cookies signed with them have expired (see MaxAge).
+func WithSigner(signer Signer) Option {
+	return func(cs *csrf) {
+		cs.opts.Signer = signer
+	}
+}
+
+// WithMetrics reports the tokens issued, and the requests that pass and fail
+// validation (by FailureKind), to m. Set Name to distinguish the counts of
+// several middleware instances.
+func WithMetrics(m Metrics) Option {
+	return func(cs *csrf) {
+		cs.opts.Metrics = m
+	}
+}
+
+// WithTracer starts spans with t around the issuance of new tokens
+// ("csrf.issue") and the validation of requests with unsafe methods
+// ("csrf.validate"), recording the reason for any failure on the validation
+// span. The otelcsrf package provides an OpenTelemetry Tracer.
+func WithTracer(t Tracer) Option {
+	return func(cs *csrf) {
+		cs.opts.Tracer = t
+	}
+}
+
+// JSONField sets the name of a top-level field of JSON request bodies
+// ("application/json" or any "+json" media type) that carries the token, for
+// clients that can't set a request header - e.g. {"csrf_token": "..."}. The
+// body is buffered and restored, so the handler can still decode it in full.
+// Bodies larger than MaxBodyBytes aren't searched.
+func JSONField(name string) Option {
+	return func(cs *csrf) {
+		cs.opts.JSONField = name
+	}
+}
+
+// WithExtractors sets where the token is looked for, in order: the first
+// extractor to return a token wins. For example, an API that should never
+// have its body read might use
+//
+//	csrf.WithExtractors(csrf.FromHeader("X-CSRF-Token"))
+//
+// When set, the extractors replace the default lookup order: the
+// RequestHeader, the AuthorizationScheme and XSRFCookie headers (if set), the
+// JSONField (if set) and then the form FieldName.
+func WithExtractors(extractors ...TokenExtractor) Option {
+	return func(cs *csrf) {
+		cs.opts.Extractors = append(cs.opts.Extractors, extractors...)
+	}
+}
+
+// MaxBodyBytes limits how much of a request body - a form or, with JSONField,
+// JSON - the middleware reads in search of a token. Multipart forms are read
+// only as far as the token field, which must precede any files, so a token
+// sent ahead of a larger upload is still found; other bodies over the limit
+// are passed on unread. If the token isn't found within the limit, the request
+// fails with ErrNoToken unless the token is sent in a header. Signed requests
+// (see RequestSigning) with larger bodies fail with ErrBadSignature, as their
+// signatures can't be checked.
+//
+// The default limit is 10MB, matching net/http's limit for URL-encoded forms.
+func MaxBodyBytes(n int64) Option {
+	return func(cs *csrf) {
+		cs.opts.MaxBodyBytes = n
+	}
+}
+
+// EnforceTLS refuses to issue or validate CSRF tokens for requests that were
+// not made over TLS, failing them with ErrInsecureRequest instead. This makes
+// a misconfigured reverse proxy that forwards plaintext requests fail loudly,
+// rather than silently issuing cookies whose Secure flag the browser will
+// refuse to send back.
+func EnforceTLS(enforce bool) Option {
+	return func(cs *csrf) {
+		cs.opts.EnforceTLS = enforce
+	}
+}
+
+// ResponseHeaders sets the names of response headers the middleware sets to
+// the request's token (see Token), for clients that read their token from
+// responses rather than from a rendered page. Passing more than one name
+// emits the token under each of them, which allows clients to be migrated
+// from one header to another.
+func ResponseHeaders(names ...string) Option {
+	return func(cs *csrf) {
+		cs.opts.ResponseHeaders = names
+	}
+}
+
+// ExpiryHeader sets the name of a response header in which the middleware
+// reports when the request's token expires (see TokenExpiry), as a Unix
+// timestamp. Single-page applications can use it to schedule a refresh of
+// their token before it expires. The header is omitted if tokens don't expire.
+// An empty name sets the header X-CSRF-Token-Expires.
+func ExpiryHeader(name string) Option {
+	return func(cs *csrf) {
+		if name == "" {
+			name = expiryHeaderName
+		}
+		cs.opts.ExpiryHeader = name
+	}
+}
+
+// Development sets whether requests are treated as local development requests,
+// which are served over plaintext HTTP: the Secure flag is left off their
+// cookie, and the Referer and EnforceTLS checks are skipped. DevModeAuto
+// limits this to requests to and from loopback addresses, which is safer than
+// conditionally passing Secure(false) and risking it reaching production.
+func Development(m DevMode) Option {
+	return func(cs *csrf) {
+		cs.opts.DevMode = m
+	}
+}
+
+// TrustForwardedProto sets whether the X-Forwarded-Proto (or Forwarded) header
+// is believed when determining whether a request was made over TLS. Only
+// enable this if the application is always served through a proxy that sets
+// the header, as clients can otherwise set it themselves; otherwise, use
+// TrustedProxies.
+func TrustForwardedProto(trust bool) Option {
+	return func(cs *csrf) {
+		cs.opts.TrustForwarded = trust
+	}
+}
+
+// TrustedProxies sets the addresses of the proxies (such as load balancers)
+// whose forwarding headers are believed: for requests received from them, the
+// scheme and host reported in the Forwarded header (RFC 7239) or else the
+// X-Forwarded-Proto and X-Forwarded-Host headers are used as the request's
+// own, e.g. by the Referer check. Each entry is a CIDR network
+// ("10.0.0.0/8") or a single address. Invalid entries are logged and ignored.
+func TrustedProxies(cidrs []string) Option {
+	return func(cs *csrf) {
+		cs.opts.TrustedProxies = append(cs.opts.TrustedProxies, cidrs...)
+	}
+}
+
+// SchemeFunc sets a function that returns the scheme ("http" or "https") a
+// request was made with, for deployments where neither r.TLS nor the
+// X-Forwarded-Proto header reflects it - e.g. behind a proxy that connects
+// over a Unix socket or reports the scheme in a custom header. The result is
+// used by the Referer check, EnforceTLS and Development. If the function
+// returns "", the scheme is detected as usual.
+func SchemeFunc(fn func(r *http.Request) string) Option {
+	return func(cs *csrf) {
+		cs.opts.SchemeFunc = fn
+	}
+}
+
+// RequestSigning allows first-party machine clients to sign unsafe requests
+// instead of presenting a CSRF cookie and token. Clients sign each request
+// with SignRequest, using the key returned by SigningKey for each key in the
+// middleware's key ring, and requests are accepted if they were signed within
+// window of the current time.
+//
+// Requests without a signature are checked as usual, so browsers are
+// unaffected.
+func RequestSigning(window time.Duration) Option {
+	return func(cs *csrf) {
+		cs.opts.SigningWindow = window
+	}
+}
+
+// IdempotentReplays accepts up to max retries, within ttl, of an unsafe
+// request that carried an Idempotency-Key header. A retry must carry the same
+// key and token and be otherwise identical (method, URL and body); it is then
+// accepted even if its token has since been consumed (e.g. the previous token
+// after MigrateToken), so that client retry logic doesn't fail CSRF
+// validation. Up to 10,000 requests are remembered, the oldest being
+// forgotten first, and bodies over the MaxBodyBytes limit are never replayed.
+func IdempotentReplays(max int, ttl time.Duration) Option {
+	return func(cs *csrf) {
+		cs.opts.ReplayLimit = max
+		cs.opts.ReplayTTL = ttl
+	}
+}
+
+// CookieEncoding sets the format of the CSRF cookie. CompactEncoding produces
+// smaller cookies than the default SecureCookieEncoding and doesn't rely on
+// gorilla/securecookie. DoubleSubmitEncoding enables a stateless mode, where
+// tokens can be validated by layers that only share the key (see
+// VerifyDoubleSubmit).
+//
+// Cookies in one format aren't accepted in the other, so changing the format
+// issues new tokens to existing sessions: forms rendered before the change
+// will fail validation.
+func CookieEncoding(e Encoding) Option {
+	return func(cs *csrf) {
+		cs.opts.Encoding = e
+	}
+}
+
+// Vary sets the request headers the middleware adds to the Vary header of the
+// responses it serves, so that shared caches don't serve a page carrying one
+// user's token to another. Defaults to "Cookie"; add "Origin" if responses
+// also depend on the Origin header. Calling Vary with no headers leaves the
+// Vary header alone, for applications that manage caching themselves.
+func Vary(headers ...string) Option {
+	return func(cs *csrf) {
+		// Non-nil even if empty, to distinguish it from the default.
+		cs.opts.Vary = append([]string{}, headers...)
+	}
+}
+
+// CacheControl sets a Cache-Control directive (e.g. "no-store") for responses
+// that use the request's token - by calling Token or TemplateField, or via
+// ResponseHeaders - and don't set a Cache-Control header themselves. This
+// keeps CDNs and other shared caches from storing pages that embed a
+// per-session token.
+//
+// The token must be used before the response is written for the header to be
+// set.
+func CacheControl(directive string) Option {
+	return func(cs *csrf) {
+		cs.opts.CacheControl = directive
+	}
+}
+
+// PublicCache sets what the middleware does to responses that the handler
+// marks as publicly cacheable (with a public or s-maxage Cache-Control
+// directive) and that set a CSRF cookie, which a CDN or other shared cache
+// could otherwise store and serve to other users. See PublicCacheMode for the
+// choices; the default, PublicCacheAllow, leaves such responses alone.
+func PublicCache(mode PublicCacheMode) Option {
+	return func(cs *csrf) {
+		cs.opts.PublicCache = mode
+	}
+}
+
+// DeferredTokens keeps tokens out of rendered pages, so that pages are the
+// same for every user and can be cached and revalidated (ETag/304) like any
+// other static content. TemplateField renders an empty field instead, and
+// TemplateScript renders a script that fetches the token from endpoint (a
+// path, e.g. "/csrf") once the page has loaded and fills in the fields.
+//
+// The middleware answers GET requests for endpoint itself, with a 204 No
+// Content response carrying the token in the RequestHeader header, so no
+// handler needs to be registered for it.
+func DeferredTokens(endpoint string) Option {
+	return func(cs *csrf) {
+		cs.opts.DeferredEndpoint = endpoint
+	}
+}
+
+// RenewEndpoint serves a lightweight token renewal endpoint at endpoint (a
+// path, e.g. "/csrf/renew"), for pages restored from the browser's
+// back/forward cache whose embedded tokens may have gone stale since they were
+// rendered. Pages include RenewScript, which fetches a fresh token from the
+// endpoint when the page is restored and updates the page's token fields
+// before any form is submitted.
+//
+// As with DeferredTokens, the middleware answers GET requests for endpoint
+// itself, with a 204 No Content response carrying the token in the
+// RequestHeader header.
+func RenewEndpoint(endpoint string) Option {
+	return func(cs *csrf) {
+		cs.opts.RenewEndpoint = endpoint
+	}
+}
+
+// InjectForms rewrites text/html responses to add the hidden token field to
+// each form with method="post", for applications whose templates can't be
+// changed to use TemplateField. Forms that already include the field, and
+// forms that submit to another origin (or have a button or input whose
+// formaction does), are left as they are.
+//
+// HTML responses are buffered in full, so that the field can be injected
+// before they're sent; flushing them early has no effect. Compressed responses
+// (with a Content-Encoding) are passed through unchanged, so compression
+// middleware must wrap the CSRF middleware rather than the other way round.
+func InjectForms(inject bool) Option {
+	return func(cs *csrf) {
+		cs.opts.InjectForms = inject
+	}
+}
+
+// StaticSiteMode configures the middleware for a statically pre-rendered
+// frontend served from another origin, such as a CDN. The frontend includes
+// the bootstrap script in its pages:
+//
+//	<script src="https://api.example.com/csrf-bootstrap.js" defer></script>
+//
+// which fetches a token from the bootstrap endpoint when the page loads and
+// fills in the token field (named by FieldName, or marked with a
+// data-csrf-token attribute) of each form. The token is also made available
+// to other scripts as window.csrfToken, along with the name of the header to
+// send it in as window.csrfHeader.
+//
+// Unsafe requests with a Referer from the frontend's origins are accepted,
+// and the CSRF cookie is issued with SameSite=Lax (or SameSite=None if the
+// frontend is on another site) so that it accompanies them.
+func StaticSiteMode(s StaticSite) Option {
+	return func(cs *csrf) {
+		if s.Endpoint == "" {
+			s.Endpoint = defaultBootstrapEndpoint
+		}
+
+		cs.opts.StaticSite = s
+		cs.opts.TrustedOrigins = append(cs.opts.TrustedOrigins, s.Origins...)
+
+		cs.opts.SameSite = SameSiteLaxMode
+		if s.CrossSite {
+			cs.opts.SameSite = SameSiteNoneMode
+		}
+	}
+}
+
+// TokenPool keeps up to size random tokens (and the one-time pads used to
+// mask them) generated ahead of time by a background goroutine, so that
+// traffic spikes - e.g. to a campaign's landing page, where most visitors
+// need a new token - don't serialize on crypto/rand at request time. Requests
+// generate their own tokens if the pool runs dry.
+//
+// The goroutine only runs while the pool is being topped up, so a middleware
+// that is discarded (or a Middleware that is reconfigured) leaves nothing
+// running.
+func TokenPool(size int) Option {
+	return func(cs *csrf) {
+		cs.opts.TokenPool = size
+	}
+}
+
+// Name sets a name for the middleware, distinguishing it from other instances
+// in the same process. Named middleware labels its work in CPU profiles with
+// runtime/pprof labels: "csrf" is set to the name and "csrf_phase" to "issue"
+// (token issuance), "validate" (token validation) or "reject" (the error
+// handler), so that profiles of busy services attribute the middleware's cost
+// to the instance responsible. Labels require Go 1.9 or later.
+func Name(name string) Option {
+	return func(cs *csrf) {
+		cs.opts.Name = name
+	}
+}
+
+// WithStore keeps CSRF base tokens in s rather than in the CSRF cookie, which
+// then holds only a random ID that references the token. Tokens can then be
+// invalidated on the server (see TokenStore.Delete), and aren't sent back and
+// forth with every request. MemoryStore is a TokenStore for single-node
+// applications.
+func WithStore(s TokenStore) Option {
+	return func(cs *csrf) {
+		cs.opts.Store = s
+	}
+}
+
+// SessionCookie binds the CSRF token to the value of the application's session
+// cookie with the given name. Whenever that cookie changes - e.g. the user logs
+// in or out, or their session is regenerated - the CSRF token is discarded and
+// a new one issued, so that a token obtained before the change (including one
+// planted by an attacker) can't be used after it.
+//
+// Forms rendered before the change will fail validation with ErrBadToken once
+// submitted, and should be re-rendered.
+func SessionCookie(name string) Option {
+	return func(cs *csrf) {
+		cs.opts.SessionCookie = name
+	}
+}
+
+// ChannelBinding binds the tokens handed out by the middleware to the TLS
+// connection they were issued on, using its exported keying material (the
+// RFC 9266 tls-exporter channel binding). A token exfiltrated from a page -
+// e.g. via XSS - can then not be replayed on a different connection.
+//
+// This is experimental. It only applies when TLS is terminated by this process
+// (i.e. http.Request.TLS is set) and requires Go 1.11 or later. Since every
+// connection has its own keying material, forms must be submitted on the
+// connection the page was served on: clients that open new connections
+// between requests, or intermediaries that don't preserve them, will see
+// their tokens rejected.
+func ChannelBinding(enabled bool) Option {
+	return func(cs *csrf) {
+		cs.opts.ChannelBinding = enabled
+	}
+}
+
+// MethodBoundTokens requires requests with the given HTTP methods to carry a
+// token bound to their method, issued with MethodToken rather than Token. A
+// token bound to one method is rejected for any other - e.g. a token issued
+// for a DELETE confirmation can't be replayed as a POST - and the tokens
+// returned by Token are rejected for the bound methods. This suits
+// high-sensitivity actions, such as those in an admin interface.
+//
+// Bound tokens are derived with the key passed to Protect (or the KeyFunc key
+// ring), so a client holding a plain token can't derive the bound ones.
+func MethodBoundTokens(methods ...string) Option {
+	return func(cs *csrf) {
+		for _, method := range methods {
+			cs.opts.BoundMethods = append(cs.opts.BoundMethods, strings.ToUpper(method))
+		}
+	}
+}
+
+// SafeMethods sets the HTTP methods that are treated as safe: requests with
+// them are issued tokens but never validated. Defaults to GET, HEAD, OPTIONS
+// and TRACE. Add a method that a client uses for reads (such as WebDAV's
+// REPORT), or drop GET for a handler that changes state on GET requests by
+// wrapping it in its own middleware:
+//
+//	legacy := csrf.Protect(key, csrf.SafeMethods("HEAD", "OPTIONS"))
+//	r.Handle("/delete", legacy(deleteHandler))
+//
+// Only add methods that browsers can't send cross-origin without a CORS
+// preflight.
+func SafeMethods(methods ...string) Option {
+	return func(cs *csrf) {
+		cs.opts.SafeMethods = make([]string, 0, len(methods))
+		for _, method := range methods {
+			cs.opts.SafeMethods = append(cs.opts.SafeMethods, strings.ToUpper(method))
+		}
+	}
+}
+
+// ProtectWebSockets checks WebSocket handshakes, which are otherwise served as
+// safe GET requests, to prevent cross-site WebSocket hijacking: a page on
+// another site opening a WebSocket with the visitor's cookies. Browsers send
+// an Origin header with every handshake, which must be the origin the request
+// was made to or one of the TrustedOrigins. Handshakes without an Origin
+// header come from clients other than browsers, and are allowed.
+//
+// If requireToken is set, handshakes must also carry a token, in the
+// RequestHeader or - as browsers can't set headers on WebSocket requests - in
+// a query parameter named after the FieldName:
+//
+//	new WebSocket("wss://example.com/ws?gorilla.csrf.Token=" +
+//		encodeURIComponent(token));
+func ProtectWebSockets(requireToken bool) Option {
+	return func(cs *csrf) {
+		cs.opts.WebSockets = true
+		cs.opts.WebSocketToken = requireToken
+	}
+}
+
+// FetchMetadata sets how the Sec-Fetch-Site request header, which modern
+// browsers send to say where a request came from, is used to check requests
+// with unsafe methods. See FetchMetadataMode.
+func FetchMetadata(mode FetchMetadataMode) Option {
+	return func(cs *csrf) {
+		cs.opts.FetchMetadata = mode
+	}
+}
+
+// OriginCheck sets how the Origin and Referer headers of requests with unsafe
+// methods are checked. See OriginMode.
+func OriginCheck(mode OriginMode) Option {
+	return func(cs *csrf) {
+		cs.opts.OriginMode = mode
+	}
+}
+
+// WithOriginCheck allows requests with unsafe methods from the origins that fn
+// approves, in addition to the origin the request was made to, the
+// TrustedOrigins and any SharedDomain - e.g. for a service that serves each
+// tenant on its own domain:
+//
+//	csrf.WithOriginCheck(func(r *http.Request, origin *url.URL) bool {
+//		return tenants.OwnsDomain(tenantID(r), origin.Hostname())
+//	})
+//
+// fn is called with the origin from the request's Origin header or, failing
+// that, its Referer header, and for WebSocket handshakes checked by
+// ProtectWebSockets. Only the scheme and host of origin are meaningful.
+// Requests must still carry a valid token.
+func WithOriginCheck(fn func(r *http.Request, origin *url.URL) bool) Option {
+	return func(cs *csrf) {
+		cs.opts.OriginFunc = fn
+	}
+}
+
+// SingleUseTokens requires requests with unsafe methods to paths matching
+// patterns (or to any path, if none are given) to carry a single-use token
+// issued by OneTimeToken. Each token is recorded in store when it is issued
+// and consumed by the first request that carries it, so that a submission
+// can't be replayed - e.g. on a payment form. Patterns have the same syntax
+// as ExemptPaths.
+//
+// Use a store that implements TokenTaker, such as MemoryStore, so that a
+// token can't be consumed by two concurrent requests. Retries accepted by
+// IdempotentReplays aren't checked again.
+func SingleUseTokens(store TokenStore, patterns ...string) Option {
+	return func(cs *csrf) {
+		cs.opts.SingleUseStore = store
+		cs.opts.SingleUsePaths = append(cs.opts.SingleUsePaths, patterns...)
+	}
+}
+
+// TrustedOrigins allows requests with unsafe methods from the given origins,
+// in addition to the origin the request was made to - e.g. a form served from
+// "https://app.example.com" that posts to "https://api.example.com". Each
+// entry is either an origin ("https://app.example.com") or a host
+// ("app.example.com", for any scheme), and may start with a "*." wildcard
+// that matches any subdomain: "*.example.com" matches "app.example.com" and
+// "a.b.example.com", but not "example.com" itself. Ports must match
+// exactly.
+//
+// Requests must still carry a valid token: trusted origins only pass the
+// Referer check.
+func TrustedOrigins(origins []string) Option {
+	return func(cs *csrf) {
+		cs.opts.TrustedOrigins = append(cs.opts.TrustedOrigins, origins...)
+	}
+}
+
+// ExemptPaths exempts requests for the given paths from CSRF protection
+// entirely, as UnsafeSkipCheck does - e.g. for webhook endpoints, which are
+// called by other servers and can never carry a token. Patterns starting with
+// "^" are regular expressions; others are matched as with path.Match, so
+// "/webhooks/*" matches "/webhooks/stripe" but not "/webhooks/stripe/events".
+// Invalid patterns are logged and ignored.
+//
+// Exempt endpoints must authenticate their requests by other means, such as
+// the webhook provider's signature.
+func ExemptPaths(patterns ...string) Option {
+	return func(cs *csrf) {
+		cs.opts.ExemptPaths = append(cs.opts.ExemptPaths, patterns...)
+	}
+}
+
+// SkipFunc sets a function that decides, for each request, whether to skip
+// CSRF protection entirely, as UnsafeSkipCheck does - e.g. for requests that
+// authenticate with an API key header rather than a cookie. Unlike
+// UnsafeSkipCheck, it doesn't need to run before the middleware.
+//
+// fn must only skip requests that can't be forged by a browser: a header that
+// an attacker's page can't set, not merely the absence of a cookie.
+func SkipFunc(fn func(r *http.Request) bool) Option {
+	return func(cs *csrf) {
+		cs.opts.SkipFunc = fn
+	}
+}
+
+// XSRFCookie adopts the convention used by Angular and Axios: the masked token
+// is also issued in a second, script-readable (non-HttpOnly) cookie, and
+// accepted back in a request header, so that single-page applications don't
+// need a round trip to fetch a token. The cookie and header names default to
+// "XSRF-TOKEN" and "X-XSRF-TOKEN" when empty.
+//
+// The token cookie is refreshed on every response the middleware passes to
+// the application, and - like the token itself - is useless without the
+// HttpOnly CSRF cookie it was issued against.
+func XSRFCookie(cookieName, header string) Option {
+	return func(cs *csrf) {
+		if cookieName == "" {
+			cookieName = defaultXSRFCookie
+		}
+		if header == "" {
+			header = defaultXSRFHeader
+		}
+
+		cs.opts.XSRFCookie = cookieName
+		cs.opts.XSRFHeader = header
+	}
+}
+
+// WithRequestStore keeps CSRF base tokens in s in place of the CSRF cookie -
+// e.g. in an existing session, so that the application sets a single cookie.
+// The WithStore option has no effect when it is set.
+func WithRequestStore(s RequestStore) Option {
+	return setStore(s)
+}
+
 // setStore sets the store used by the CSRF middleware.
-// Note: this is private (for now) to allow for internal API changes.
 func setStore(s store) Option {
 	return func(cs *csrf) {
 		cs.st = s
@@ -128,3 +1086,100 @@ func parseOptions(h http.Handler, opts ...Option) *csrf {
 
 	return cs
 }
+
+// setDefaults fills in any options that were not explicitly configured.
+func (o *options) setDefaults() {
+	if o.ErrorHandler == nil {
+		o.ErrorHandler = NegotiatedErrorHandler(ErrorFormats{})
+	}
+
+	if o.MaxAge < 0 {
+		// Default of 12 hours
+		o.MaxAge = defaultAge
+	}
+
+	if o.FieldName == "" {
+		o.FieldName = fieldName
+	}
+
+	if o.CookieName == "" {
+		o.CookieName = cookieName
+	}
+
+	if o.RequestHeader == "" {
+		o.RequestHeader = headerName
+	}
+
+	if o.Reissue && o.ReissueHeader == "" {
+		o.ReissueHeader = o.RequestHeader
+	}
+
+	if o.Vary == nil {
+		o.Vary = []string{"Cookie"}
+	}
+
+	if o.TarpitDelay <= 0 {
+		o.TarpitDelay = defaultTarpitDelay
+	}
+
+	if o.MaxBodyBytes <= 0 {
+		o.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
+	if o.RandAttempts <= 0 {
+		o.RandAttempts = defaultRandAttempts
+	}
+
+	if o.RandBackoff <= 0 {
+		o.RandBackoff = defaultRandBackoff
+	}
+
+	if o.SafeMethods == nil {
+		o.SafeMethods = safeMethods
+	}
+
+	if o.FailureStatus == 0 {
+		o.FailureStatus = http.StatusForbidden
+	}
+}
+
+// fingerprint returns a short, stable hash of the configured options. Values of
+// plain fields are hashed directly, and slices and structs element by element;
+// for functions, handlers and other reference types only their presence (and,
+// for interfaces, their type) is recorded, as their addresses differ between
+// processes.
+func (o options) fingerprint() string {
+	h := sha256.New()
+	v := reflect.ValueOf(o)
+	for i := 0; i < v.NumField(); i++ {
+		hashValue(h, v.Type().Field(i).Name, v.Field(i))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// hashValue writes name and a representation of v that is stable between
+// processes to w.
+func hashValue(w io.Writer, name string, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Func, reflect.Ptr, reflect.Map, reflect.Chan, reflect.UnsafePointer:
+		fmt.Fprintf(w, "%s=%t;", name, !v.IsNil())
+	case reflect.Interface:
+		if v.IsNil() {
+			fmt.Fprintf(w, "%s=false;", name)
+		} else {
+			fmt.Fprintf(w, "%s=%s;", name, v.Elem().Type())
+		}
+	case reflect.Slice, reflect.Array:
+		fmt.Fprintf(w, "%s=%d;", name, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			hashValue(w, fmt.Sprintf("%s[%d]", name, i), v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hashValue(w, name+"."+v.Type().Field(i).Name, v.Field(i))
+		}
+	default:
+		fmt.Fprintf(w, "%s=%v;", name, v)
+	}
+}
@@ -1,8 +1,11 @@
 package csrf
 
 import (
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -71,3 +74,278 @@ func TestOptions(t *testing.T) {
 			cs.opts.CookieName, name)
 	}
 }
+
+// TestFingerprintHeader checks that the config fingerprint is stable for
+// identical options and changes with the effective configuration.
+func TestFingerprintHeader(t *testing.T) {
+	fingerprint := func(opts ...Option) string {
+		s := http.NewServeMux()
+		s.HandleFunc("/", testHandler)
+		p := Protect(testKey, append(opts, FingerprintHeader("X-CSRF-Config"))...)(s)
+
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+		return rr.Header().Get("X-CSRF-Config")
+	}
+
+	a := fingerprint(MaxAge(600))
+	if a == "" {
+		t.Fatal("fingerprint header not set")
+	}
+
+	if b := fingerprint(MaxAge(600)); a != b {
+		t.Fatalf("fingerprint is not stable: got %v and %v", a, b)
+	}
+
+	if b := fingerprint(MaxAge(900)); a == b {
+		t.Fatalf("fingerprint did not change with the configuration: got %v", b)
+	}
+
+	// Handlers nested in slices are hashed by type, not address.
+	onAPI := func(r *http.Request) bool { return strings.HasPrefix(r.URL.Path, "/api/") }
+	a = fingerprint(ErrorHandlerFor(onAPI, http.RedirectHandler("/", http.StatusFound)))
+	if b := fingerprint(ErrorHandlerFor(onAPI, http.RedirectHandler("/", http.StatusFound))); a != b {
+		t.Fatalf("fingerprint is not stable for nested handlers: got %v and %v", a, b)
+	}
+}
+
+// TestHostOptions checks that per-host options are applied on top of the
+// shared options, and only for their host.
+func TestHostOptions(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+	p := Protect(testKey, Path("/"), HostOptions(map[string][]Option{
+		"Tenant.example.com": {CookieName("tenant_csrf"), Domain("example.com")},
+	}))(s)
+
+	var hostTests = []struct {
+		url    string
+		cookie []string
+	}{
+		{"http://tenant.example.com:8080/", []string{"tenant_csrf=", "Domain=example.com", "Path=/"}},
+		{"http://www.example.org/", []string{cookieName + "=", "Path=/"}},
+	}
+
+	for _, ht := range hostTests {
+		r, err := http.NewRequest("GET", ht.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		cookie := rr.Header().Get("Set-Cookie")
+		for _, want := range ht.cookie {
+			if !strings.Contains(cookie, want) {
+				t.Fatalf("%s: cookie does not respect host options: got %v want %v",
+					ht.url, cookie, want)
+			}
+		}
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	keys := map[string][]byte{
+		"a.example.com": []byte("tenant-a-key-0123456789abcdefghi"),
+		"b.example.com": []byte("tenant-b-key-0123456789abcdefghi"),
+	}
+
+	s := http.NewServeMux()
+	p := Protect(testKey, KeyFunc(func(r *http.Request) ([][]byte, error) {
+		key, ok := keys[r.Host]
+		if !ok {
+			return nil, errors.New("unknown tenant")
+		}
+
+		return [][]byte{key}, nil
+	}))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	// Fetch a token and cookie from tenant a.
+	r, err := http.NewRequest("GET", "http://a.example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("middleware failed to pass to the next handler: got %v want %v",
+			rr.Code, http.StatusOK)
+	}
+
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var keyTests = []struct {
+		host string
+		code int
+	}{
+		{"a.example.com", http.StatusOK},
+		{"b.example.com", http.StatusForbidden},
+		{"c.example.com", http.StatusServiceUnavailable},
+	}
+
+	for _, kt := range keyTests {
+		r, err := http.NewRequest("POST", "http://"+kt.host+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Cookie", cookie)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != kt.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", kt.host, rr.Code, kt.code)
+		}
+	}
+}
+
+func TestPreviousKeys(t *testing.T) {
+	oldKey := []byte("old-auth-key-0123456789abcdefghi")
+
+	var token string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	// Fetch a token and cookie signed with the old key.
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	Protect(oldKey)(handler).ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var keyTests = []struct {
+		name string
+		p    http.Handler
+		code int
+	}{
+		{"rotated", Protect(testKey, PreviousKeys(oldKey))(handler), http.StatusOK},
+		{"not rotated", Protect(testKey)(handler), http.StatusForbidden},
+	}
+
+	for _, kt := range keyTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Cookie", cookie)
+
+		rr := httptest.NewRecorder()
+		kt.p.ServeHTTP(rr, r)
+
+		if rr.Code != kt.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", kt.name, rr.Code, kt.code)
+		}
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, ResponseHeaders("X-CSRF-Token", "X-XSRF-Token"))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	for _, name := range []string{"X-CSRF-Token", "X-XSRF-Token"} {
+		if got := rr.Header().Get(name); got != token {
+			t.Fatalf("token not emitted in %s: got %q want %q", name, got, token)
+		}
+	}
+}
+
+func TestCookieEncoding(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, CookieEncoding(CompactEncoding))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setCookie(rr, r)
+	r.Header.Set("X-CSRF-Token", token)
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("middleware rejected a compact cookie: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestVary(t *testing.T) {
+	var varyTests = []struct {
+		opts   []Option
+		preset string
+		want   []string
+	}{
+		{nil, "", []string{"Cookie"}},
+		{nil, "Accept-Encoding, cookie", []string{"Accept-Encoding, cookie"}},
+		{[]Option{Vary("Cookie", "Origin")}, "", []string{"Cookie", "Origin"}},
+		{[]Option{Vary()}, "", nil},
+	}
+
+	for _, vt := range varyTests {
+		s := http.NewServeMux()
+		s.HandleFunc("/", testHandler)
+		p := Protect(testKey, vt.opts...)(s)
+
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		if vt.preset != "" {
+			rr.Header().Set("Vary", vt.preset)
+		}
+		p.ServeHTTP(rr, r)
+
+		if got := rr.Header()["Vary"]; !reflect.DeepEqual(got, vt.want) {
+			t.Fatalf("wrong Vary header: got %q want %q", got, vt.want)
+		}
+	}
+}
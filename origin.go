@@ -0,0 +1,36 @@
+package csrf
+
+// OriginMode sets how the Origin and Referer headers of requests with unsafe
+// methods are checked against the origin the request was made to and the
+// TrustedOrigins. Browsers send the Origin header with nearly every such
+// request, while privacy tools and Referrer-Policy settings often strip the
+// Referer. In every mode, an Origin of "null" is treated as absent.
+type OriginMode int
+
+const (
+	// OriginOrReferer checks the Origin header of HTTPS requests, or the
+	// Referer header if there is no Origin header, in which case the Referer
+	// is required. This is the default.
+	OriginOrReferer OriginMode = iota
+	// OriginAndReferer checks both headers of HTTPS requests where both are
+	// present. The Referer is required only if there is no Origin header.
+	OriginAndReferer
+	// OriginOnly checks the Origin header of all requests, including plain
+	// HTTP ones, wherever it is present, and ignores the Referer. Requests
+	// without an Origin header rely on the token alone.
+	OriginOnly
+)
+
+// String returns the name of m.
+func (m OriginMode) String() string {
+	switch m {
+	case OriginOrReferer:
+		return "origin-or-referer"
+	case OriginAndReferer:
+		return "origin-and-referer"
+	case OriginOnly:
+		return "origin-only"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,118 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestOriginCheck checks each OriginMode against combinations of the Origin
+// and Referer headers.
+func TestOriginCheck(t *testing.T) {
+	var token string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	s := httptest.NewRecorder()
+	Protect(testKey)(handler).ServeHTTP(s, httptest.NewRequest("GET", "https://www.gorillatoolkit.org/", nil))
+	cookie := s.Header().Get("Set-Cookie")
+	valid := token
+
+	const (
+		self  = "https://www.gorillatoolkit.org"
+		other = "https://evil.example.com"
+	)
+
+	var originTests = []struct {
+		mode     OriginMode
+		url      string
+		origin   string
+		referer  string
+		expected int
+	}{
+		{OriginOrReferer, self, self, "", http.StatusOK},
+		{OriginOrReferer, self, self, other + "/", http.StatusOK},
+		{OriginOrReferer, self, "", "", http.StatusForbidden},
+		{OriginOrReferer, self, "null", self + "/", http.StatusOK},
+		{OriginOrReferer, "http://www.gorillatoolkit.org", other, "", http.StatusOK},
+		{OriginAndReferer, self, self, "", http.StatusOK},
+		{OriginAndReferer, self, self, self + "/", http.StatusOK},
+		{OriginAndReferer, self, self, other + "/", http.StatusForbidden},
+		{OriginAndReferer, self, other, self + "/", http.StatusForbidden},
+		{OriginAndReferer, self, "", "", http.StatusForbidden},
+		{OriginOnly, self, self, other + "/", http.StatusOK},
+		{OriginOnly, self, "", "", http.StatusOK},
+		{OriginOnly, self, other, "", http.StatusForbidden},
+		{OriginOnly, "http://www.gorillatoolkit.org", other, "", http.StatusForbidden},
+		{OriginOnly, "http://www.gorillatoolkit.org", "http://www.gorillatoolkit.org", "",
+			http.StatusOK},
+	}
+
+	for _, ot := range originTests {
+		r := httptest.NewRequest("POST", ot.url+"/", nil)
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", valid)
+		if ot.origin != "" {
+			r.Header.Set("Origin", ot.origin)
+		}
+		if ot.referer != "" {
+			r.Header.Set("Referer", ot.referer)
+		}
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, OriginCheck(ot.mode))(handler).ServeHTTP(rr, r)
+
+		if rr.Code != ot.expected {
+			t.Errorf("%v, %s, Origin %q, Referer %q: got %v want %v",
+				ot.mode, ot.url, ot.origin, ot.referer, rr.Code, ot.expected)
+		}
+	}
+}
+
+func TestWithOriginCheck(t *testing.T) {
+	var token string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	s := httptest.NewRecorder()
+	Protect(testKey)(handler).ServeHTTP(s, httptest.NewRequest("GET", "https://www.gorillatoolkit.org/", nil))
+	cookie := s.Header().Get("Set-Cookie")
+	valid := token
+
+	// Allow each tenant's vanity domain for its own path.
+	check := WithOriginCheck(func(r *http.Request, origin *url.URL) bool {
+		return r.URL.Path == "/acme/" && origin.Host == "acme.example.com"
+	})
+
+	var checkTests = []struct {
+		path     string
+		origin   string
+		expected int
+	}{
+		{"/acme/", "https://www.gorillatoolkit.org", http.StatusOK},
+		{"/acme/", "https://acme.example.com", http.StatusOK},
+		{"/other/", "https://acme.example.com", http.StatusForbidden},
+		{"/acme/", "https://evil.example.com", http.StatusForbidden},
+	}
+
+	for _, ct := range checkTests {
+		r := httptest.NewRequest("POST", "https://www.gorillatoolkit.org"+ct.path, nil)
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", valid)
+		r.Header.Set("Origin", ct.origin)
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, check)(handler).ServeHTTP(rr, r)
+
+		if rr.Code != ct.expected {
+			t.Errorf("%s from %s: got %v want %v", ct.path, ct.origin, rr.Code, ct.expected)
+		}
+	}
+
+	if _, err := NewTokens(testKey, check); err == nil {
+		t.Error("NewTokens accepted WithOriginCheck")
+	}
+}
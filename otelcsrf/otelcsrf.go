@@ -0,0 +1,70 @@
+// Package otelcsrf traces the work of the gorilla/csrf middleware with
+// OpenTelemetry, so that the cost of issuing and validating tokens, and the
+// requests that fail validation, show up in distributed traces.
+//
+//	CSRF := csrf.Protect([]byte("32-byte-long-auth-key"),
+//		otelcsrf.WithTracerProvider(otel.GetTracerProvider()))
+//
+// Failures are recorded on the "csrf.validate" span as a "csrf.failure" event
+// carrying the csrf.failure.kind and csrf.failure.reason attributes, and set
+// the span's status to Error.
+package otelcsrf
+
+import (
+	"context"
+
+	"github.com/gorilla/csrf"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans started by this package.
+const instrumentationName = "github.com/gorilla/csrf/otelcsrf"
+
+// WithTracerProvider returns a csrf.Option that traces the middleware with a
+// tracer from tp. A nil tp uses the global TracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) csrf.Option {
+	return csrf.WithTracer(NewTracer(tp))
+}
+
+// NewTracer returns a csrf.Tracer that starts spans with a tracer from tp. A
+// nil tp uses the global TracerProvider.
+func NewTracer(tp trace.TracerProvider) csrf.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return tracer{tp.Tracer(instrumentationName)}
+}
+
+// tracer adapts an OpenTelemetry tracer to csrf.Tracer.
+type tracer struct {
+	t trace.Tracer
+}
+
+func (t tracer) Start(ctx context.Context, name string) (context.Context, csrf.Span) {
+	ctx, s := t.t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+	return ctx, span{s}
+}
+
+// span adapts an OpenTelemetry span to csrf.Span.
+type span struct {
+	s trace.Span
+}
+
+func (s span) Fail(kind csrf.FailureKind, reason error) {
+	attrs := []attribute.KeyValue{attribute.String("csrf.failure.kind", kind.String())}
+	if reason != nil {
+		attrs = append(attrs, attribute.String("csrf.failure.reason", reason.Error()))
+	}
+
+	s.s.AddEvent("csrf.failure", trace.WithAttributes(attrs...))
+	s.s.SetAttributes(attrs...)
+	s.s.SetStatus(codes.Error, kind.String())
+}
+
+func (s span) End() {
+	s.s.End()
+}
@@ -0,0 +1,60 @@
+package otelcsrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/csrf"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestWithTracerProvider(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+
+	p := csrf.Protect(testKey, WithTracerProvider(tp))(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+
+	r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("wrong number of spans: got %d want 2", len(spans))
+	}
+
+	if spans[0].Name() != "csrf.issue" || spans[1].Name() != "csrf.validate" {
+		t.Fatalf("wrong spans: got %q, %q", spans[0].Name(), spans[1].Name())
+	}
+
+	validate := spans[1]
+	if validate.Status().Code != codes.Error {
+		t.Fatalf("validation span not marked as failed: %v", validate.Status())
+	}
+
+	var kind string
+	for _, kv := range validate.Attributes() {
+		if kv.Key == attribute.Key("csrf.failure.kind") {
+			kind = kv.Value.AsString()
+		}
+	}
+
+	if kind != csrf.MissingCookie.String() && kind != csrf.MissingToken.String() {
+		t.Fatalf("wrong failure kind attribute: got %q", kind)
+	}
+}
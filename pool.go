@@ -0,0 +1,139 @@
+package csrf
+
+import (
+	"crypto/rand"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultRandAttempts is the default number of attempts at reading random
+	// bytes for a token.
+	defaultRandAttempts = 3
+	// defaultRandBackoff is the default delay before retrying a failed read.
+	defaultRandBackoff = 10 * time.Millisecond
+)
+
+// tokenPool holds random tokens generated ahead of time, so that requests
+// that need a new token (or one-time pad) don't wait on crypto/rand during
+// traffic spikes. Tokens are taken from the pool when available and
+// generated on demand otherwise.
+//
+// The pool is topped up by a goroutine that is started when tokens are taken
+// and exits once the pool is full, so a pool that is no longer used - e.g.
+// after a Middleware is reconfigured - leaves nothing running.
+type tokenPool struct {
+	tokens chan []byte
+	random io.Reader
+	// filling is 1 while a goroutine is topping up the pool.
+	filling int32
+}
+
+// newTokenPool returns a pool of up to size tokens read from random, and
+// starts filling it.
+func newTokenPool(size int, random io.Reader) *tokenPool {
+	p := &tokenPool{tokens: make(chan []byte, size), random: random}
+	p.refill()
+	return p
+}
+
+// refill starts topping up the pool, unless that is already under way.
+func (p *tokenPool) refill() {
+	if atomic.CompareAndSwapInt32(&p.filling, 0, 1) {
+		go p.fill()
+	}
+}
+
+// fill tops up the pool, returning once it is full. A failure to generate a
+// token also ends it: requests will report the failure when they generate
+// tokens themselves, and the next token taken restarts the fill.
+func (p *tokenPool) fill() {
+	defer atomic.StoreInt32(&p.filling, 0)
+
+	for {
+		token, err := readRandom(p.random, tokenLength)
+		if err != nil {
+			return
+		}
+
+		select {
+		case p.tokens <- token:
+		default:
+			return
+		}
+	}
+}
+
+// get returns a token from the pool, or a newly generated one if the pool is
+// empty.
+func (p *tokenPool) get() ([]byte, error) {
+	defer p.refill()
+
+	select {
+	case token := <-p.tokens:
+		return token, nil
+	default:
+		return readRandom(p.random, tokenLength)
+	}
+}
+
+// randomToken returns tokenLength random bytes, from the TokenPool if one is
+// configured. Failures to read from the system's random number generator are
+// retried up to RandAttempts times in all, doubling the delay between
+// attempts from RandBackoff.
+func (cs *csrf) randomToken() ([]byte, error) {
+	token := make([]byte, tokenLength)
+	if err := cs.fillRandom(token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// fillRandom is randomToken for a caller-supplied buffer of tokenLength
+// bytes, so that one-time pads can be read without allocating.
+func (cs *csrf) fillRandom(token []byte) error {
+	backoff := cs.opts.RandBackoff
+	for attempt := 1; ; attempt++ {
+		err := cs.readToken(token)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= cs.opts.RandAttempts {
+			return errors.Wrapf(err, "reading random bytes failed after %d attempts", attempt)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// readToken makes a single attempt at reading tokenLength random bytes into
+// token.
+func (cs *csrf) readToken(token []byte) error {
+	if cs.pool != nil {
+		pooled, err := cs.pool.get()
+		if err != nil {
+			return err
+		}
+
+		copy(token, pooled)
+		return nil
+	}
+
+	return readRandomFrom(cs.randomSource(), token)
+}
+
+// randomSource returns the source of random bytes for tokens: crypto/rand,
+// unless replaced by tests.
+func (cs *csrf) randomSource() io.Reader {
+	if cs.random != nil {
+		return cs.random
+	}
+
+	return rand.Reader
+}
@@ -0,0 +1,163 @@
+package csrf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Tests that the pool is filled in the background and hands out distinct
+// tokens, falling back to generating them when empty.
+func TestTokenPool(t *testing.T) {
+	p := newTokenPool(4, rand.Reader)
+
+	deadline := time.Now().Add(time.Second)
+	for len(p.tokens) < cap(p.tokens) {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool not filled: got %d tokens want %d", len(p.tokens), cap(p.tokens))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var tokens [][]byte
+	for i := 0; i < 2*cap(p.tokens); i++ {
+		token, err := p.get()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(token) != tokenLength {
+			t.Fatalf("wrong token length: got %d want %d", len(token), tokenLength)
+		}
+
+		for _, other := range tokens {
+			if bytes.Equal(token, other) {
+				t.Fatal("pool returned the same token twice")
+			}
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// Tests that the goroutine filling the pool exits once the pool is full, and
+// is restarted when tokens are taken.
+func TestTokenPoolFillExits(t *testing.T) {
+	p := newTokenPool(4, rand.Reader)
+
+	// waitFull waits for the pool to fill and its filler to exit.
+	waitFull := func() {
+		deadline := time.Now().Add(time.Second)
+		for len(p.tokens) < cap(p.tokens) || atomic.LoadInt32(&p.filling) != 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("pool not filled: got %d tokens, filling %d",
+					len(p.tokens), atomic.LoadInt32(&p.filling))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitFull()
+	for i := 0; i < 2; i++ {
+		if _, err := p.get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFull()
+}
+
+func TestTokenPoolMiddleware(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, TokenPool(8))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setCookie(rr, r)
+	r.Header.Set("X-CSRF-Token", token)
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("token from the pool was rejected: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+// failingReader fails the first n reads, and then reads from crypto/rand.
+type failingReader struct {
+	n        int
+	original io.Reader
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if fr.n > 0 {
+		fr.n--
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return fr.original.Read(p)
+}
+
+// Tests that failed reads from crypto/rand are retried, and that requests are
+// reported to the AlertFunc and rejected once the attempts are exhausted.
+func TestRandomRetry(t *testing.T) {
+	random := &failingReader{original: rand.Reader}
+	useRandom := func(cs *csrf) { cs.random = random }
+
+	var alerts int
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	p := Protect(testKey, useRandom, RandomRetry(3, time.Millisecond),
+		AlertFunc(func(r *http.Request, err error) {
+			alerts++
+		}))(s)
+
+	var retryTests = []struct {
+		failures int
+		code     int
+		alerts   int
+	}{
+		{2, http.StatusOK, 0},
+		{3, http.StatusServiceUnavailable, 1},
+	}
+
+	for _, rt := range retryTests {
+		random.n = rt.failures
+		alerts = 0
+
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != rt.code {
+			t.Fatalf("%d failures: wrong status code: got %v want %v", rt.failures, rr.Code, rt.code)
+		}
+
+		if alerts != rt.alerts {
+			t.Fatalf("%d failures: wrong number of alerts: got %d want %d", rt.failures, alerts, rt.alerts)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+//go:build go1.9
+// +build go1.9
+
+package csrf
+
+import (
+	"net/http"
+	"runtime/pprof"
+)
+
+// label sets the pprof labels of the current goroutine to attribute the work
+// that follows to phase ("issue", "validate" or "reject") of this middleware,
+// if it has a Name. It returns r with the labels added to its context.
+func (cs *csrf) label(r *http.Request, phase string) *http.Request {
+	if cs.opts.Name == "" {
+		return r
+	}
+
+	ctx := pprof.WithLabels(r.Context(), pprof.Labels("csrf", cs.opts.Name, "csrf_phase", phase))
+	pprof.SetGoroutineLabels(ctx)
+	return r.WithContext(ctx)
+}
+
+// unlabel restores the pprof labels the current goroutine had before the
+// middleware labelled it, given the request it was passed.
+func (cs *csrf) unlabel(r *http.Request) {
+	if cs.opts.Name == "" {
+		return
+	}
+
+	pprof.SetGoroutineLabels(r.Context())
+}
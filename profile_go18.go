@@ -0,0 +1,14 @@
+//go:build !go1.9
+// +build !go1.9
+
+package csrf
+
+import "net/http"
+
+// runtime/pprof labels are only available from Go 1.9.
+
+func (cs *csrf) label(r *http.Request, phase string) *http.Request {
+	return r
+}
+
+func (cs *csrf) unlabel(r *http.Request) {}
@@ -0,0 +1,53 @@
+//go:build go1.9
+// +build go1.9
+
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+)
+
+// Tests that named middleware labels the error handler's request, and not
+// the wrapped handler's.
+func TestProfileLabels(t *testing.T) {
+	var labels map[string]string
+	record := func(w http.ResponseWriter, r *http.Request) {
+		labels = make(map[string]string)
+		pprof.ForLabels(r.Context(), func(key, value string) bool {
+			labels[key] = value
+			return true
+		})
+	}
+
+	p := Protect(testKey, Name("signup"),
+		ErrorHandler(http.HandlerFunc(record)))(http.HandlerFunc(record))
+
+	var labelTests = []struct {
+		method string
+		phase  string
+	}{
+		{"GET", ""},
+		{"POST", "reject"},
+	}
+
+	for _, lt := range labelTests {
+		r, err := http.NewRequest(lt.method, "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p.ServeHTTP(httptest.NewRecorder(), r)
+
+		if labels["csrf_phase"] != lt.phase {
+			t.Fatalf("%s: wrong csrf_phase label: got %q want %q",
+				lt.method, labels["csrf_phase"], lt.phase)
+		}
+
+		if lt.phase != "" && labels["csrf"] != "signup" {
+			t.Fatalf("%s: wrong csrf label: got %q want %q", lt.method, labels["csrf"], "signup")
+		}
+	}
+}
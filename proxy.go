@@ -0,0 +1,115 @@
+package csrf
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// compileProxies parses the TrustedProxies. Invalid entries are logged and
+// ignored.
+func compileProxies(cidrs []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		// Accept single addresses as well as networks.
+		network := cidr
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				network += "/32"
+			} else {
+				network += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(network)
+		if err != nil {
+			log.Printf("%signoring invalid trusted proxy %q: %v", errorPrefix, cidr, err)
+			continue
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets
+}
+
+// trustedProxy reports whether r was received from one of the
+// TrustedProxies.
+func (cs *csrf) trustedProxy(r *http.Request) bool {
+	if len(cs.proxies) == 0 {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range cs.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwarded returns the scheme and host that the client-facing proxy reports
+// for r: from the first element of the Forwarded header (RFC 7239) if there
+// is one, or else from the X-Forwarded-Proto and X-Forwarded-Host headers.
+// Either may be empty. The caller must check that the headers can be
+// trusted.
+func forwarded(r *http.Request) (proto, host string) {
+	if fwd := r.Header.Get("Forwarded"); fwd != "" {
+		for _, pair := range splitQuoted(firstElement(fwd), ';') {
+			i := strings.IndexByte(pair, '=')
+			if i < 0 {
+				continue
+			}
+
+			value := strings.Trim(strings.TrimSpace(pair[i+1:]), `"`)
+			switch strings.ToLower(strings.TrimSpace(pair[:i])) {
+			case "proto":
+				proto = value
+			case "host":
+				host = value
+			}
+		}
+
+		return strings.ToLower(proto), host
+	}
+
+	proto = firstElement(r.Header.Get("X-Forwarded-Proto"))
+	host = firstElement(r.Header.Get("X-Forwarded-Host"))
+	return strings.ToLower(proto), host
+}
+
+// firstElement returns the first element of a comma-separated header value.
+func firstElement(v string) string {
+	return strings.TrimSpace(splitQuoted(v, ',')[0])
+}
+
+// splitQuoted splits v at each sep that isn't inside a quoted string.
+func splitQuoted(v string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, v[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, v[start:])
+}
@@ -0,0 +1,71 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	var token string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	s := httptest.NewRecorder()
+	Protect(testKey)(handler).ServeHTTP(s, httptest.NewRequest("GET", "http://backend:8080/", nil))
+	cookie := s.Header().Get("Set-Cookie")
+	valid := token
+
+	proxies := TrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "bogus"})
+
+	var proxyTests = []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   int
+	}{
+		{"forwarded", "10.1.2.3:4567", map[string]string{
+			"Forwarded": `for=203.0.113.7;proto=https;host="www.gorillatoolkit.org", for=10.1.1.1`,
+			"Origin":    "https://www.gorillatoolkit.org",
+		}, http.StatusOK},
+		{"x-forwarded", "192.0.2.1:4567", map[string]string{
+			"X-Forwarded-Proto": "https, http",
+			"X-Forwarded-Host":  "www.gorillatoolkit.org",
+			"Origin":            "https://www.gorillatoolkit.org",
+		}, http.StatusOK},
+		// The forwarded scheme turns on the Referer check.
+		{"https without referer", "10.1.2.3:4567", map[string]string{
+			"X-Forwarded-Proto": "https",
+			"X-Forwarded-Host":  "www.gorillatoolkit.org",
+		}, http.StatusForbidden},
+		{"wrong forwarded host", "10.1.2.3:4567", map[string]string{
+			"X-Forwarded-Proto": "https",
+			"X-Forwarded-Host":  "evil.example.com",
+			"Origin":            "https://www.gorillatoolkit.org",
+		}, http.StatusForbidden},
+		// Headers from other clients are ignored, so the request is plain
+		// HTTP and its Origin isn't checked.
+		{"untrusted client", "203.0.113.7:4567", map[string]string{
+			"X-Forwarded-Proto": "https",
+			"X-Forwarded-Host":  "evil.example.com",
+		}, http.StatusOK},
+	}
+
+	for _, pt := range proxyTests {
+		r := httptest.NewRequest("POST", "http://backend:8080/", nil)
+		r.RemoteAddr = pt.remoteAddr
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", valid)
+		for k, v := range pt.headers {
+			r.Header.Set(k, v)
+		}
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, proxies)(handler).ServeHTTP(rr, r)
+
+		if rr.Code != pt.expected {
+			t.Errorf("%s: got %v want %v", pt.name, rr.Code, pt.expected)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package csrf
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PublicCacheMode sets what the middleware does to responses that the handler
+// marks as cacheable by shared caches, such as CDNs: those with a
+// Cache-Control header that includes the public or s-maxage directive. A
+// shared cache may store the CSRF cookie along with such a response and
+// serve it to other users.
+type PublicCacheMode int
+
+const (
+	// PublicCacheAllow leaves publicly cacheable responses as they are. This
+	// is the default.
+	PublicCacheAllow PublicCacheMode = iota
+	// PublicCacheStripCookie removes the CSRF cookies from publicly cacheable
+	// responses, so that the response can still be cached. Clients that
+	// don't have a cookie yet get one from their next uncacheable response.
+	PublicCacheStripCookie
+	// PublicCachePrivate keeps responses that set a CSRF cookie out of shared
+	// caches: the public and s-maxage directives are replaced by private,
+	// and Cookie is added to the Vary header.
+	PublicCachePrivate
+)
+
+// String returns the name of m.
+func (m PublicCacheMode) String() string {
+	switch m {
+	case PublicCacheAllow:
+		return "allow"
+	case PublicCacheStripCookie:
+		return "strip-cookie"
+	case PublicCachePrivate:
+		return "private"
+	}
+
+	return "unknown"
+}
+
+// publicCacheWriter is a http.ResponseWriter that applies the PublicCacheMode
+// before the response headers are written.
+type publicCacheWriter struct {
+	http.ResponseWriter
+	cs      *csrf
+	written bool
+}
+
+// check applies the PublicCacheMode if the response is publicly cacheable.
+func (pw *publicCacheWriter) check() {
+	if pw.written {
+		return
+	}
+	pw.written = true
+
+	h := pw.ResponseWriter.Header()
+	if !publiclyCacheable(h) {
+		return
+	}
+
+	var cookies, others []string
+	for _, c := range h["Set-Cookie"] {
+		if pw.cs.ownCookie(c) {
+			cookies = append(cookies, c)
+		} else {
+			others = append(others, c)
+		}
+	}
+
+	if len(cookies) == 0 {
+		return
+	}
+
+	switch pw.cs.opts.PublicCache {
+	case PublicCacheStripCookie:
+		if len(others) == 0 {
+			h.Del("Set-Cookie")
+		} else {
+			h["Set-Cookie"] = others
+		}
+	case PublicCachePrivate:
+		h.Set("Cache-Control", privateCacheControl(h.Get("Cache-Control")))
+		addVary(h, "Cookie")
+	}
+}
+
+func (pw *publicCacheWriter) WriteHeader(code int) {
+	pw.check()
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+func (pw *publicCacheWriter) Write(b []byte) (int, error) {
+	pw.check()
+	return pw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter does.
+func (pw *publicCacheWriter) Flush() {
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		pw.check()
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying ResponseWriter does.
+func (pw *publicCacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := pw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New(errorPrefix + "ResponseWriter does not implement http.Hijacker")
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (pw *publicCacheWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// publiclyCacheable reports whether the Cache-Control header in h allows
+// shared caches to store the response.
+func publiclyCacheable(h http.Header) bool {
+	for _, v := range h["Cache-Control"] {
+		for _, directive := range strings.Split(v, ",") {
+			name := strings.ToLower(strings.TrimSpace(directive))
+			if name == "public" || strings.HasPrefix(name, "s-maxage") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// privateCacheControl returns cc with the public and s-maxage directives
+// replaced by private.
+func privateCacheControl(cc string) string {
+	directives := []string{"private"}
+	for _, directive := range strings.Split(cc, ",") {
+		directive = strings.TrimSpace(directive)
+		name := strings.ToLower(directive)
+		if directive == "" || name == "public" || name == "private" || strings.HasPrefix(name, "s-maxage") {
+			continue
+		}
+
+		directives = append(directives, directive)
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// ownCookie reports whether setCookie (the value of a Set-Cookie header) sets
+// one of the middleware's cookies.
+func (cs *csrf) ownCookie(setCookie string) bool {
+	name := setCookie
+	if i := strings.IndexByte(name, '='); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimSpace(name)
+
+	return name == cs.opts.CookieName || name == cs.opts.CookieName+graceSuffix ||
+		(cs.opts.XSRFCookie != "" && name == cs.opts.XSRFCookie)
+}
@@ -0,0 +1,61 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPublicCache checks each PublicCacheMode against cacheable and
+// uncacheable responses.
+func TestPublicCache(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/public", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "theme", Value: "dark"})
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write([]byte("public"))
+	})
+	s.HandleFunc("/shared", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60, s-maxage=300")
+	})
+	s.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Write([]byte("private"))
+	})
+
+	var cacheTests = []struct {
+		mode         PublicCacheMode
+		path         string
+		cookie       bool
+		cacheControl string
+	}{
+		{PublicCacheAllow, "/public", true, "public, max-age=300"},
+		{PublicCacheStripCookie, "/public", false, "public, max-age=300"},
+		{PublicCacheStripCookie, "/shared", false, "max-age=60, s-maxage=300"},
+		{PublicCacheStripCookie, "/private", true, "private, max-age=60"},
+		{PublicCachePrivate, "/public", true, "private, max-age=300"},
+		{PublicCachePrivate, "/shared", true, "private, max-age=60"},
+		{PublicCachePrivate, "/private", true, "private, max-age=60"},
+	}
+
+	for _, ct := range cacheTests {
+		r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org"+ct.path, nil)
+		rr := httptest.NewRecorder()
+		Protect(testKey, PublicCache(ct.mode))(s).ServeHTTP(rr, r)
+
+		cookies := strings.Join(rr.Header()["Set-Cookie"], "; ")
+		if got := strings.Contains(cookies, cookieName+"="); got != ct.cookie {
+			t.Errorf("%v, %s: CSRF cookie set %v want %v", ct.mode, ct.path, got, ct.cookie)
+		}
+
+		if ct.path == "/public" && !strings.Contains(cookies, "theme=dark") {
+			t.Errorf("%v, %s: other cookies were removed: %q", ct.mode, ct.path, cookies)
+		}
+
+		if got := rr.Header().Get("Cache-Control"); got != ct.cacheControl {
+			t.Errorf("%v, %s: wrong Cache-Control header: got %q want %q",
+				ct.mode, ct.path, got, ct.cacheControl)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package csrf
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FailureRedirect configures the redirect sent to browsers whose form
+// submissions fail CSRF validation (see RedirectOnFailure).
+type FailureRedirect struct {
+	// Param is the query parameter added to the redirect, with the value "1",
+	// so that the form page can tell the user what happened. The default is
+	// "csrf_expired".
+	Param string
+	// Fallback is the path redirected to when the request has no Referer
+	// from the same host. The default is "/".
+	Fallback string
+	// Status is the redirect status code. The default is 303 See Other,
+	// which has the browser load the form with a GET request.
+	Status int
+}
+
+// RedirectErrorHandler returns an http.Handler for requests that fail CSRF
+// validation, which redirects the browser back to the page the request came
+// from - the form, typically - with the query parameter f.Param set. The page
+// is served with a fresh token, and can ask the user to submit the form again
+// rather than leaving them on an error page:
+//
+//	data["expired"] = r.URL.Query().Get("csrf_expired") != ""
+//
+//	{{ if .expired }}
+//		<p>Your session expired. Please check the form and send it again.</p>
+//	{{ end }}
+//
+// Only the path and query of the Referer are used, and only if it is from the
+// same host as the request; otherwise f.Fallback is redirected to. The
+// submitted form values are not kept: forms that should survive expiry can
+// save their drafts client-side, e.g. in localStorage.
+func RedirectErrorHandler(f FailureRedirect) http.Handler {
+	if f.Param == "" {
+		f.Param = "csrf_expired"
+	}
+	if f.Fallback == "" {
+		f.Fallback = "/"
+	}
+	if f.Status == 0 {
+		f.Status = http.StatusSeeOther
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := returnTo(r)
+		if target == nil {
+			var err error
+			if target, err = url.Parse(f.Fallback); err != nil {
+				target = &url.URL{Path: "/"}
+			}
+		}
+
+		q := target.Query()
+		q.Set(f.Param, "1")
+		target.RawQuery = q.Encode()
+		target.Fragment = ""
+
+		http.Redirect(w, r, target.String(), f.Status)
+	})
+}
+
+// returnTo returns the path and query of r's Referer, or nil if it has none
+// from the same host as r or the path could be taken for another host.
+func returnTo(r *http.Request) *url.URL {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Host == "" || !strings.EqualFold(referer.Host, r.Host) {
+		return nil
+	}
+
+	path := referer.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") ||
+		strings.HasPrefix(path, "/\\") {
+		return nil
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil
+	}
+	u.RawQuery = referer.RawQuery
+
+	return u
+}
+
+// browserNavigation reports whether r is a browser navigation, such as a form
+// submission, that can be redirected: one that prefers HTML and wasn't made
+// by htmx.
+func browserNavigation(r *http.Request) bool {
+	return !IsHTMX(r) && errorFormat(r) == "html"
+}
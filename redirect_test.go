@@ -0,0 +1,62 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectOnFailure(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var redirectTests = []struct {
+		f        FailureRedirect
+		accept   string
+		referer  string
+		status   int
+		location string
+	}{
+		{FailureRedirect{}, "text/html", "http://www.gorillatoolkit.org/signup?plan=pro#form",
+			http.StatusSeeOther, "/signup?csrf_expired=1&plan=pro"},
+		{FailureRedirect{}, "text/html", "http://www.gorillatoolkit.org",
+			http.StatusSeeOther, "/?csrf_expired=1"},
+		{FailureRedirect{}, "text/html", "http://evil.example/signup",
+			http.StatusSeeOther, "/?csrf_expired=1"},
+		{FailureRedirect{}, "text/html", "http://www.gorillatoolkit.org//evil.example/",
+			http.StatusSeeOther, "/?csrf_expired=1"},
+		{FailureRedirect{}, "text/html", "",
+			http.StatusSeeOther, "/?csrf_expired=1"},
+		{FailureRedirect{Param: "expired", Fallback: "/login?next=%2F", Status: http.StatusFound},
+			"text/html", "", http.StatusFound, "/login?expired=1&next=%2F"},
+		{FailureRedirect{}, "application/json", "http://www.gorillatoolkit.org/signup",
+			http.StatusForbidden, ""},
+	}
+
+	for _, rt := range redirectTests {
+		r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/signup/post", nil)
+		r.Header.Set("Accept", rt.accept)
+		r.Header.Set("Referer", rt.referer)
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, RedirectOnFailure(rt.f))(handler).ServeHTTP(rr, r)
+
+		if rr.Code != rt.status {
+			t.Errorf("%+v, %q: wrong status code: got %v want %v", rt.f, rt.referer, rr.Code, rt.status)
+		}
+
+		if got := rr.Header().Get("Location"); got != rt.location {
+			t.Errorf("%+v, %q: wrong Location: got %q want %q", rt.f, rt.referer, got, rt.location)
+		}
+	}
+
+	// htmx requests get the ErrorHandler.
+	r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/signup/post", nil)
+	r.Header.Set("Accept", "text/html")
+	r.Header.Set("HX-Request", "true")
+	rr := httptest.NewRecorder()
+	Protect(testKey, RedirectOnFailure(FailureRedirect{}))(handler).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("htmx request redirected: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,18 @@
+module github.com/gorilla/csrf/redisstore
+
+go 1.24
+
+require (
+	github.com/gorilla/csrf v1.6.2
+	github.com/redis/go-redis/v9 v9.22.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/gorilla/securecookie v1.1.1 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
+
+replace github.com/gorilla/csrf => ../
@@ -0,0 +1,93 @@
+package redisstore
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/csrf"
+)
+
+// testStore returns a Store connected to the Redis server at $REDIS_URL, or
+// skips the test if it isn't set.
+func testStore(t *testing.T, opts ...Option) *Store {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL not set")
+	}
+
+	s, err := Dial(url, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestOptions(t *testing.T) {
+	s := New(nil, Prefix("app:"), TTL(time.Minute))
+
+	if s.key("id") != "app:id" {
+		t.Fatalf("wrong key: got %q want %q", s.key("id"), "app:id")
+	}
+
+	if s.ttl != time.Minute {
+		t.Fatalf("wrong TTL: got %v want %v", s.ttl, time.Minute)
+	}
+}
+
+func TestDialInvalidURL(t *testing.T) {
+	if _, err := Dial("http://localhost"); err == nil {
+		t.Fatal("Dial accepted an invalid URL")
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := testStore(t, Prefix("csrf-test:"), TTL(time.Minute))
+	defer s.Close()
+
+	if _, err := s.Get(ctx, "missing"); err != csrf.ErrTokenNotFound {
+		t.Fatalf("wrong error for a missing ID: got %v want %v", err, csrf.ErrTokenNotFound)
+	}
+
+	if err := s.Save(ctx, "id", []byte("token")); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := s.Get(ctx, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(token) != "token" {
+		t.Fatalf("wrong token: got %q want %q", token, "token")
+	}
+
+	if err := s.Delete(ctx, "id"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, "id"); err != csrf.ErrTokenNotFound {
+		t.Fatalf("token not deleted: got %v want %v", err, csrf.ErrTokenNotFound)
+	}
+}
+
+func TestTake(t *testing.T) {
+	ctx := context.Background()
+	s := testStore(t, Prefix("csrf-test:"), TTL(time.Minute))
+	defer s.Close()
+
+	if err := s.Save(ctx, "once", []byte("token")); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err := s.Take(ctx, "once"); err != nil || string(token) != "token" {
+		t.Fatalf("wrong token: got %q, %v want %q", token, err, "token")
+	}
+
+	if _, err := s.Take(ctx, "once"); err != csrf.ErrTokenNotFound {
+		t.Fatalf("token taken twice: got %v want %v", err, csrf.ErrTokenNotFound)
+	}
+}
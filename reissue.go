@@ -0,0 +1,29 @@
+package csrf
+
+import (
+	"net/http"
+)
+
+// reissue attaches the request's token to the response to a request that
+// failed validation, in the ReissueHeader and, if set, the XSRFCookie, so that
+// the client can retry the request with it. The CSRF cookie itself has
+// already been replaced if it was missing or unusable.
+func (cs *csrf) reissue(w http.ResponseWriter, r *http.Request, kind FailureKind) {
+	switch kind {
+	case MissingCookie, MissingToken, TokenMismatch, DecodeError, ExpiredToken:
+	default:
+		// Retrying won't help a request from the wrong origin, or one that
+		// failed a Validator.
+		return
+	}
+
+	token := Token(r)
+	if token == "" {
+		return
+	}
+
+	w.Header().Set(cs.opts.ReissueHeader, token)
+	if cs.opts.XSRFCookie != "" {
+		cs.setXSRFCookie(w, r)
+	}
+}
@@ -0,0 +1,84 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestReissueOnFailure checks that a client can retry a failed request with
+// the token from the failure response.
+func TestReissueOnFailure(t *testing.T) {
+	served := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	})
+	p := Protect(testKey, ReissueOnFailure(""))(handler)
+
+	// post makes a POST request with cookie and token, returning the
+	// response.
+	post := func(cookie, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		r.Header.Set("X-CSRF-Token", token)
+
+		served = false
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+		return rr
+	}
+
+	// A request without a cookie gets a new cookie and a token for it.
+	rr := post("", "stale")
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("request without a cookie accepted: got %v", rr.Code)
+	}
+
+	token := rr.Header().Get("X-CSRF-Token")
+	cookies := rr.Result().Cookies()
+	if token == "" || len(cookies) == 0 {
+		t.Fatalf("no token reissued: token %q, cookies %v", token, cookies)
+	}
+	cookie := cookies[0].Name + "=" + cookies[0].Value
+
+	if rr := post(cookie, token); rr.Code != http.StatusOK || !served {
+		t.Fatalf("retry rejected: got %v", rr.Code)
+	}
+
+	// A request with a stale token gets a token for its cookie.
+	rr = post(cookie, "")
+	if rr.Code != http.StatusForbidden || len(rr.Result().Cookies()) != 0 {
+		t.Fatalf("wrong response to a missing token: got %v, %v", rr.Code, rr.Result().Cookies())
+	}
+
+	if rr := post(cookie, rr.Header().Get("X-CSRF-Token")); rr.Code != http.StatusOK || !served {
+		t.Fatalf("retry rejected: got %v", rr.Code)
+	}
+
+	// Requests from the wrong origin get no token.
+	r := httptest.NewRequest("POST", "https://www.gorillatoolkit.org/", nil)
+	r.Header.Set("Cookie", cookie)
+	r.Header.Set("Referer", "https://golang.org/")
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if token := rr.Header().Get("X-CSRF-Token"); rr.Code != http.StatusForbidden || token != "" {
+		t.Fatalf("token reissued for a bad referer: got %v, %q", rr.Code, token)
+	}
+
+	// The header can be named, and defaults to the RequestHeader.
+	for _, opts := range [][]Option{
+		{ReissueOnFailure("X-Retry-Token")},
+		{ReissueOnFailure(""), RequestHeader("X-Retry-Token")},
+	} {
+		rr := httptest.NewRecorder()
+		Protect(testKey, opts...)(handler).ServeHTTP(rr,
+			httptest.NewRequest("POST", "http://www.gorillatoolkit.org/", nil))
+
+		if rr.Header().Get("X-Retry-Token") == "" {
+			t.Fatalf("no token in the named header: %v", rr.Header())
+		}
+	}
+}
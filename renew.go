@@ -0,0 +1,46 @@
+package csrf
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// renewScript renews the page's tokens from the renewal endpoint when the page
+// is restored from the back/forward cache, and holds back form submissions
+// until the renewal has completed.
+const renewScript = `<script>(function(){` +
+	`var endpoint="%s",header="%s",field="%s",pending=null;` +
+	`function renew(){pending=fetch(endpoint,{credentials:"same-origin",cache:"no-store"})` +
+	`.then(function(res){var token=res.headers.get(header);if(!token){return}` +
+	`window.csrfToken=token;` +
+	`var fields=document.querySelectorAll('input[name="'+field+'"],input[data-csrf-token]');` +
+	`for(var i=0;i<fields.length;i++){fields[i].value=token}` +
+	`var meta=document.querySelector('meta[name="csrf-token"]');if(meta){meta.content=token}})` +
+	`.catch(function(){}).then(function(){pending=null});return pending}` +
+	`window.addEventListener("pageshow",function(e){if(e.persisted){renew()}});` +
+	`document.addEventListener("submit",function(e){if(!pending){return}` +
+	`var form=e.target;e.preventDefault();pending.then(function(){form.submit()})},true)` +
+	`})();</script>`
+
+// RenewScript is a template helper for html/template that provides a <script>
+// that renews the page's tokens when it is restored from the browser's
+// back/forward cache, when the RenewEndpoint option is set. Forms submitted
+// while a renewal is in flight are submitted once it completes. It renders
+// nothing otherwise.
+func RenewScript(r *http.Request) template.HTML {
+	val, err := contextGet(r, csrfKey)
+	if err != nil {
+		return template.HTML("")
+	}
+
+	cs, ok := val.(*csrf)
+	if !ok || cs.opts.RenewEndpoint == "" {
+		return template.HTML("")
+	}
+
+	return template.HTML(fmt.Sprintf(renewScript,
+		template.JSEscapeString(cs.opts.RenewEndpoint),
+		template.JSEscapeString(cs.opts.RequestHeader),
+		template.JSEscapeString(cs.opts.FieldName)))
+}
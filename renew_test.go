@@ -0,0 +1,81 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests that the renewal endpoint serves a token that is accepted, and that
+// RenewScript points at it.
+func TestRenewEndpoint(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RenewScript(r)))
+	})
+	p := Protect(testKey, RenewEndpoint("/csrf/renew"))(s)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	for _, want := range []string{`<script>`, `"/csrf/renew"`, `"pageshow"`, `"gorilla.csrf.Token"`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Fatalf("page %q does not contain %q", rr.Body.String(), want)
+		}
+	}
+
+	r, err = http.NewRequest("GET", "http://www.gorillatoolkit.org/csrf/renew", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Cookie", cookie)
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	token := rr.Header().Get("X-CSRF-Token")
+	if rr.Code != http.StatusNoContent || token == "" {
+		t.Fatalf("endpoint did not serve a token: got %v %q", rr.Code, token)
+	}
+
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Cookie", cookie)
+	r.Header.Set("X-CSRF-Token", token)
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("renewed token rejected: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+// Tests that RenewScript renders nothing without a renewal endpoint.
+func TestRenewScriptDisabled(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RenewScript(r)))
+	})
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	Protect(testKey)(s).ServeHTTP(rr, r)
+
+	if rr.Body.Len() != 0 {
+		t.Fatalf("script rendered without a renewal endpoint: %q", rr.Body.String())
+	}
+}
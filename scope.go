@@ -0,0 +1,59 @@
+package csrf
+
+import (
+	"log"
+	"net/http"
+)
+
+// CookieScope controls whether the hosts served by one middleware share their
+// CSRF cookies and tokens.
+type CookieScope int
+
+const (
+	// SharedScope authenticates every host's cookies with the same keys, so
+	// that a cookie issued for one host is accepted by the others if the
+	// client sends it there (e.g. with the Domain option). This is the
+	// default.
+	SharedScope CookieScope = iota
+	// IsolatedScope authenticates each host's cookies with keys derived from
+	// the host name, and issues host-only cookies, so that a cookie (and the
+	// tokens issued against it) is only ever accepted by the host that issued
+	// it. It suits a single binary serving several unrelated domains.
+	IsolatedScope
+)
+
+// hostLabel prefixes the host name when deriving a host's keys.
+const hostLabel = "csrf-host:"
+
+// hostKeys derives the keys used to authenticate cookies for r's host from
+// keys.
+func hostKeys(r *http.Request, keys [][]byte) [][]byte {
+	label := []byte(hostLabel + requestHost(r))
+
+	derived := make([][]byte, len(keys))
+	for i, key := range keys {
+		derived[i] = deriveToken(key, label)
+	}
+
+	return derived
+}
+
+// checkScope drops the cookie options that would share cookies between hosts
+// under IsolatedScope, which would otherwise be silently ineffective.
+func (cs *csrf) checkScope() {
+	if cs.opts.Scope != IsolatedScope {
+		return
+	}
+
+	if cs.opts.Domain != "" || cs.opts.SharedDomain != "" {
+		domain := cs.opts.Domain
+		if domain == "" {
+			domain = cs.opts.SharedDomain
+		}
+
+		log.Printf("%signoring cookie domain %q: IsolatedScope issues host-only cookies",
+			errorPrefix, domain)
+		cs.opts.Domain = ""
+		cs.opts.SharedDomain = ""
+	}
+}
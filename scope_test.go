@@ -0,0 +1,58 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests that under IsolatedScope a cookie is only accepted by the host that
+// issued it.
+func TestIsolatedScope(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, Scope(IsolatedScope), Domain("example.com"))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	r, err := http.NewRequest("GET", "http://shop.example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	if strings.Contains(cookie, "Domain=") {
+		t.Fatalf("cookie not host-only under IsolatedScope: %q", cookie)
+	}
+
+	var scopeTests = []struct {
+		url  string
+		code int
+	}{
+		{"http://shop.example.com/", http.StatusOK},
+		{"http://blog.example.org/", http.StatusForbidden},
+	}
+
+	for _, st := range scopeTests {
+		r, err := http.NewRequest("POST", st.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", token)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != st.code {
+			t.Fatalf("%+v: wrong status code: got %v want %v", st, rr.Code, st.code)
+		}
+	}
+}
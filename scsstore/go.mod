@@ -0,0 +1,15 @@
+module github.com/gorilla/csrf/scsstore
+
+go 1.23
+
+require (
+	github.com/alexedwards/scs/v2 v2.9.0
+	github.com/gorilla/csrf v1.6.2
+)
+
+require (
+	github.com/gorilla/securecookie v1.1.1 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+)
+
+replace github.com/gorilla/csrf => ../
@@ -0,0 +1,75 @@
+// Package scsstore keeps CSRF base tokens in a session managed by
+// alexedwards/scs, so that they live server-side alongside the rest of the
+// session - and are discarded with it when the session is destroyed at logout.
+//
+//	sessionManager := scs.New()
+//	CSRF := csrf.Protect([]byte("32-byte-long-auth-key"),
+//		csrf.WithRequestStore(scsstore.New(sessionManager)))
+//
+//	http.ListenAndServe(":8000", sessionManager.LoadAndSave(CSRF(r)))
+//
+// The CSRF middleware must run inside the SessionManager's LoadAndSave
+// middleware; requests served without it fail as an internal error (see
+// csrf.FailurePolicy).
+package scsstore
+
+import (
+	"net/http"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/gorilla/csrf"
+)
+
+// defaultKey is the default key the token is saved under in the session.
+const defaultKey = "_csrf_token"
+
+// Option describes a functional option for configuring a Store.
+type Option func(*Store)
+
+// Key sets the key the token is saved under in the session. Defaults to
+// "_csrf_token".
+func Key(key string) Option {
+	return func(s *Store) {
+		s.key = key
+	}
+}
+
+// Store is a csrf.RequestStore that keeps tokens in an scs session.
+type Store struct {
+	sm  *scs.SessionManager
+	key string
+}
+
+var _ csrf.RequestStore = (*Store)(nil)
+
+// New returns a Store that keeps tokens in the sessions managed by sm.
+func New(sm *scs.SessionManager, opts ...Option) *Store {
+	s := &Store{
+		sm:  sm,
+		key: defaultKey,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Get returns the token saved in r's session, or http.ErrNoCookie if it holds
+// none.
+func (s *Store) Get(r *http.Request) ([]byte, error) {
+	token := s.sm.GetBytes(r.Context(), s.key)
+	if token == nil {
+		return nil, http.ErrNoCookie
+	}
+
+	return token, nil
+}
+
+// Save saves token in r's session. The session itself is saved by the
+// SessionManager's LoadAndSave middleware.
+func (s *Store) Save(token []byte, w http.ResponseWriter, r *http.Request) error {
+	s.sm.Put(r.Context(), s.key, token)
+	return nil
+}
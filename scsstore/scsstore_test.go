@@ -0,0 +1,77 @@
+package scsstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/gorilla/csrf"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestStore(t *testing.T) {
+	sm := scs.New()
+
+	var token string
+	p := sm.LoadAndSave(csrf.Protect(testKey, csrf.WithRequestStore(New(sm)))(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			token = csrf.Token(r)
+			if r.URL.Path == "/logout" {
+				sm.Destroy(r.Context())
+			}
+		})))
+
+	// get fetches path and returns the session cookie it set.
+	get := func(path, cookie string) string {
+		r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		cookies := rr.Header()["Set-Cookie"]
+		if len(cookies) != 1 || !strings.HasPrefix(cookies[0], "session=") {
+			t.Fatalf("token not saved in the session alone: got %q", cookies)
+		}
+
+		return strings.SplitN(cookies[0], ";", 2)[0]
+	}
+
+	post := func(cookie string) int {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", token)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	cookie := get("/", "")
+	if code := post(cookie); code != http.StatusOK {
+		t.Fatalf("wrong status code: got %v want %v", code, http.StatusOK)
+	}
+
+	// Destroying the session at logout discards the token with it.
+	get("/logout", cookie)
+	if code := post(cookie); code != http.StatusForbidden {
+		t.Fatalf("token outlived its session: got %v want %v", code, http.StatusForbidden)
+	}
+}
+
+func TestKey(t *testing.T) {
+	if s := New(nil, Key("csrf")); s.key != "csrf" {
+		t.Fatalf("wrong key: got %q want %q", s.key, "csrf")
+	}
+}
@@ -0,0 +1,67 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// sessionDigestLength is the length of the session digest kept alongside a
+// token bound to a session cookie.
+const sessionDigestLength = 16
+
+// errSessionChanged is reported by a sessionStore when the session cookie has
+// changed since the token was issued.
+var errSessionChanged = errors.New("session changed since the CSRF token was issued")
+
+// sessionStore binds the tokens kept in another store to the value of the
+// application's session cookie. Each token is saved with a digest of the
+// session cookie, and is discarded - so that a new one is issued - once the
+// session cookie no longer matches it: e.g. when the user logs in or out.
+type sessionStore struct {
+	store
+	name string
+	key  []byte
+}
+
+func (ss *sessionStore) Get(r *http.Request) ([]byte, error) {
+	value, err := ss.store.Get(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value) != tokenLength+sessionDigestLength {
+		return nil, errSessionChanged
+	}
+
+	token, digest := value[:tokenLength], value[tokenLength:]
+	if !hmac.Equal(digest, ss.digest(r)) {
+		return nil, errSessionChanged
+	}
+
+	return token, nil
+}
+
+func (ss *sessionStore) Save(token []byte, w http.ResponseWriter, r *http.Request) error {
+	value := make([]byte, 0, len(token)+sessionDigestLength)
+	value = append(value, token...)
+	value = append(value, ss.digest(r)...)
+
+	return ss.store.Save(value, w, r)
+}
+
+// digest returns a keyed digest of the request's session cookie. A request
+// without the cookie has a session of its own, so that a token issued before
+// the session was established is rotated once it is.
+func (ss *sessionStore) digest(r *http.Request) []byte {
+	var value string
+	if c, err := r.Cookie(ss.name); err == nil {
+		value = c.Value
+	}
+
+	mac := hmac.New(sha256.New, ss.key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)[:sessionDigestLength]
+}
@@ -0,0 +1,58 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Tests that the token is rotated when the session cookie changes, and kept
+// while it doesn't.
+func TestSessionCookie(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, SessionCookie("session"))(s)
+
+	var token string
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	post := func(rr *httptest.ResponseRecorder, session string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		setCookie(rr, r)
+		r.AddCookie(&http.Cookie{Name: "session", Value: session})
+		r.Header.Set("X-CSRF-Token", token)
+
+		rr2 := httptest.NewRecorder()
+		p.ServeHTTP(rr2, r)
+		return rr2
+	}
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddCookie(&http.Cookie{Name: "session", Value: "before"})
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr2 := post(rr, "before"); rr2.Code != http.StatusOK {
+		t.Fatalf("token rejected for an unchanged session: got %v want %v",
+			rr2.Code, http.StatusOK)
+	}
+
+	rr2 := post(rr, "after")
+	if rr2.Code != http.StatusForbidden {
+		t.Fatalf("token accepted after the session changed: got %v want %v",
+			rr2.Code, http.StatusForbidden)
+	}
+
+	if rr2.Header().Get("Set-Cookie") == "" {
+		t.Fatal("token not rotated after the session changed")
+	}
+}
@@ -0,0 +1,15 @@
+module github.com/gorilla/csrf/sessionsstore
+
+go 1.23
+
+require (
+	github.com/gorilla/csrf v1.6.2
+	github.com/gorilla/sessions v1.4.0
+)
+
+require (
+	github.com/gorilla/securecookie v1.1.2 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+)
+
+replace github.com/gorilla/csrf => ../
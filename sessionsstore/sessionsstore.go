@@ -0,0 +1,88 @@
+// Package sessionsstore keeps CSRF base tokens in a gorilla/sessions session,
+// so that applications which already issue a session cookie don't need a
+// second cookie for CSRF protection.
+//
+//	sessions := sessions.NewCookieStore([]byte("session-key"))
+//	CSRF := csrf.Protect([]byte("32-byte-long-auth-key"),
+//		csrf.WithRequestStore(sessionsstore.New(sessions, "session")))
+//
+// The token is saved in the session whenever a new one is issued, which also
+// saves any other changes made to the session earlier in the request.
+package sessionsstore
+
+import (
+	"net/http"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/sessions"
+)
+
+// defaultKey is the default key the token is saved under in the session.
+const defaultKey = "_csrf_token"
+
+// Option describes a functional option for configuring a Store.
+type Option func(*Store)
+
+// Key sets the key the token is saved under in the session's Values. Defaults
+// to "_csrf_token".
+func Key(key string) Option {
+	return func(s *Store) {
+		s.key = key
+	}
+}
+
+// Store is a csrf.RequestStore that keeps tokens in a gorilla/sessions
+// session.
+type Store struct {
+	store sessions.Store
+	name  string
+	key   string
+}
+
+var _ csrf.RequestStore = (*Store)(nil)
+
+// New returns a Store that keeps tokens in the session named name from store.
+func New(store sessions.Store, name string, opts ...Option) *Store {
+	s := &Store{
+		store: store,
+		name:  name,
+		key:   defaultKey,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Get returns the token saved in r's session. It returns http.ErrNoCookie if
+// the session holds no token, and the session store's error if the session
+// can't be decoded.
+func (s *Store) Get(r *http.Request) ([]byte, error) {
+	session, err := s.store.Get(r, s.name)
+	if err != nil {
+		return nil, err
+	}
+
+	token, ok := session.Values[s.key].([]byte)
+	if !ok {
+		return nil, http.ErrNoCookie
+	}
+
+	return token, nil
+}
+
+// Save saves token in r's session, replacing a session that can't be
+// decoded with a new one.
+func (s *Store) Save(token []byte, w http.ResponseWriter, r *http.Request) error {
+	// A session that fails to decode is returned as a new session along with
+	// the error.
+	session, err := s.store.Get(r, s.name)
+	if session == nil {
+		return err
+	}
+
+	session.Values[s.key] = token
+	return session.Save(r, w)
+}
@@ -0,0 +1,69 @@
+package sessionsstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/sessions"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestStore(t *testing.T) {
+	store := New(sessions.NewCookieStore([]byte("session-key-0123456789abcdefghij")), "session")
+
+	var token string
+	p := csrf.Protect(testKey, csrf.WithRequestStore(store))(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			token = csrf.Token(r)
+		}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	cookies := rr.Header()["Set-Cookie"]
+	if len(cookies) != 1 || !strings.HasPrefix(cookies[0], "session=") {
+		t.Fatalf("token not saved in the session cookie alone: got %q", cookies)
+	}
+
+	var storeTests = []struct {
+		name   string
+		cookie string
+		code   int
+	}{
+		{"session", cookies[0], http.StatusOK},
+		{"no session", "", http.StatusForbidden},
+		{"tampered session", "session=tampered", http.StatusForbidden},
+	}
+
+	for _, st := range storeTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", st.cookie)
+		r.Header.Set("X-CSRF-Token", token)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != st.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", st.name, rr.Code, st.code)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	if s := New(nil, "session", Key("csrf")); s.key != "csrf" {
+		t.Fatalf("wrong key: got %q want %q", s.key, "csrf")
+	}
+}
@@ -0,0 +1,105 @@
+package csrf
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Signer signs and verifies CSRF cookies on behalf of the middleware, so that
+// the signing key can be held by an external service - such as a cloud KMS or
+// an HSM - rather than in process memory. See WithSigner.
+//
+// Sign and Verify are called with the context of the request being served.
+// Implementations must be safe for concurrent use.
+type Signer interface {
+	// Sign returns a signature over msg.
+	Sign(ctx context.Context, msg []byte) ([]byte, error)
+	// Verify returns nil if sig is a valid signature over msg, and an error
+	// otherwise.
+	Verify(ctx context.Context, msg, sig []byte) error
+}
+
+// signerVersion is the version byte that prefixes values encoded by
+// signerCodec.
+const signerVersion = 0x81
+
+// signerHeader is the length of the fixed header of a signerCodec value: the
+// version byte, a 32-bit timestamp and the 16-bit length of the value.
+const signerHeader = 7
+
+// signerCodec is the codec used with WithSigner. It encodes values as the
+// unpadded base64url encoding of a version byte, a 32-bit timestamp, the
+// length of the value, the value and a signature over all of them, the cookie
+// name and (under IsolatedScope) the host.
+type signerCodec struct {
+	ctx    context.Context
+	signer Signer
+	maxAge int64
+	host   string
+}
+
+// signed returns the message that is signed for the named cookie's encoded
+// message.
+func (sc signerCodec) signed(name string, msg []byte) []byte {
+	b := make([]byte, 0, len(name)+len(sc.host)+2+len(msg))
+	b = append(b, name...)
+	b = append(b, 0)
+	b = append(b, sc.host...)
+	b = append(b, 0)
+	return append(b, msg...)
+}
+
+func (sc signerCodec) Encode(name string, value []byte) (string, error) {
+	if len(value) > 0xffff {
+		return "", errors.New(errorPrefix + "cookie value too long")
+	}
+
+	msg := make([]byte, signerHeader, signerHeader+len(value))
+	msg[0] = signerVersion
+	binary.BigEndian.PutUint32(msg[1:], uint32(time.Now().Unix()))
+	binary.BigEndian.PutUint16(msg[5:], uint16(len(value)))
+	msg = append(msg, value...)
+
+	sig, err := sc.signer.Sign(sc.ctx, sc.signed(name, msg))
+	if err != nil {
+		return "", errors.Wrap(err, "signer failed")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(append(msg, sig...)), nil
+}
+
+func (sc signerCodec) Decode(name, value string) ([]byte, error) {
+	if len(value) > maxCookieLength {
+		return nil, errors.New(errorPrefix + "cookie value too long")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "cookie value not valid base64")
+	}
+
+	if len(b) < signerHeader || b[0] != signerVersion {
+		return nil, errors.New(errorPrefix + "cookie value not valid")
+	}
+
+	n := signerHeader + int(binary.BigEndian.Uint16(b[5:]))
+	if len(b) <= n {
+		return nil, errors.New(errorPrefix + "cookie value not valid")
+	}
+
+	msg, sig := b[:n], b[n:]
+	if err := sc.signer.Verify(sc.ctx, sc.signed(name, msg), sig); err != nil {
+		return nil, errors.New(errorPrefix + "cookie value not authentic")
+	}
+
+	ts := int64(binary.BigEndian.Uint32(msg[1:5]))
+	if sc.maxAge != 0 && ts < time.Now().Unix()-sc.maxAge {
+		return nil, ErrTokenExpired
+	}
+
+	return msg[signerHeader:], nil
+}
@@ -0,0 +1,86 @@
+package csrf
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// hmacSigner is a Signer backed by an in-memory key, standing in for a KMS.
+type hmacSigner struct {
+	key   []byte
+	calls int
+}
+
+func (s *hmacSigner) Sign(ctx context.Context, msg []byte) ([]byte, error) {
+	s.calls++
+	h := hmac.New(sha256.New, s.key)
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+func (s *hmacSigner) Verify(ctx context.Context, msg, sig []byte) error {
+	s.calls++
+	want, _ := s.Sign(ctx, msg)
+	if !hmac.Equal(sig, want) {
+		return errors.New("bad signature")
+	}
+
+	return nil
+}
+
+func TestWithSigner(t *testing.T) {
+	signer := &hmacSigner{key: []byte("kms-held-key-0123456789abcdefghi")}
+
+	var token string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	p := Protect(nil, WithSigner(signer))(handler)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	if signer.calls == 0 {
+		t.Fatal("cookie was not signed by the signer")
+	}
+
+	var signerTests = []struct {
+		name string
+		p    http.Handler
+		code int
+	}{
+		{"same signer", p, http.StatusOK},
+		{"other signer", Protect(nil, WithSigner(&hmacSigner{key: testKey}))(handler),
+			http.StatusForbidden},
+		{"auth key", Protect(testKey)(handler), http.StatusForbidden},
+	}
+
+	for _, st := range signerTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Cookie", cookie)
+
+		rr := httptest.NewRecorder()
+		st.p.ServeHTTP(rr, r)
+
+		if rr.Code != st.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", st.name, rr.Code, st.code)
+		}
+	}
+}
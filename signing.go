@@ -0,0 +1,140 @@
+package csrf
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// signatureHeader is the request header that carries a request signature.
+const signatureHeader = "X-CSRF-Signature"
+
+// signingLabel identifies request signing keys derived from an auth key.
+var signingLabel = []byte("request-signing")
+
+// SigningKey returns the key that machine clients use to sign requests (see
+// SignRequest) for a middleware created with authKey. It is derived from
+// authKey, so it can be handed to clients without revealing authKey itself.
+func SigningKey(authKey []byte) []byte {
+	return deriveToken(authKey, signingLabel)
+}
+
+// SignRequest signs r with key (see SigningKey), so that it is accepted by a
+// middleware configured with RequestSigning without a CSRF cookie or token.
+// The signature covers the method, path, query, body and the current time;
+// r's body is read and replaced so that it can still be sent.
+func SignRequest(r *http.Request, key []byte) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := signature(key, r, ts, body)
+	r.Header.Set(signatureHeader, "t="+ts+",s="+base64.RawURLEncoding.EncodeToString(sig))
+
+	return nil
+}
+
+// signature returns the HMAC of the signed parts of r.
+func signature(key []byte, r *http.Request, ts string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n" + ts + "\n"))
+	h.Write([]byte(hex.EncodeToString(sum[:])))
+	return h.Sum(nil)
+}
+
+// readBody reads r's body and replaces it with a copy, so that it can be read
+// again.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// parseSignature splits a signature header into its timestamp and signature.
+func parseSignature(header string) (ts string, sig []byte, ok bool) {
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return "", nil, false
+		}
+
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "s":
+			var err error
+			if sig, err = base64.RawURLEncoding.DecodeString(kv[1]); err != nil {
+				return "", nil, false
+			}
+		}
+	}
+
+	return ts, sig, ts != "" && sig != nil
+}
+
+// verifySignature checks the signature on r against the signing keys derived
+// from the request's key ring. It returns ErrBadSignature if the signature is
+// malformed, doesn't match, or was made outside the replay window, or if r's
+// body is larger than the MaxBodyBytes limit.
+func (cs *csrf) verifySignature(r *http.Request) error {
+	ts, sig, ok := parseSignature(r.Header.Get(signatureHeader))
+	if !ok {
+		return ErrBadSignature
+	}
+
+	signed, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+
+	// Reject signatures made too long ago (or too far in the future, to
+	// allow for clock skew) to limit the window in which they can be replayed.
+	skew := time.Since(time.Unix(signed, 0))
+	if skew < -cs.opts.SigningWindow || skew > cs.opts.SigningWindow {
+		return ErrBadSignature
+	}
+
+	keys, err := cs.keyRing(r)
+	if err != nil {
+		return errors.Wrap(err, "key ring unavailable")
+	}
+
+	// The signature covers the whole body, so a body over the MaxBodyBytes
+	// limit can't be verified.
+	var body []byte
+	if r.Body != nil {
+		if body, ok = peekBody(r, cs.opts.MaxBodyBytes); !ok {
+			return ErrBadSignature
+		}
+	}
+
+	for _, key := range keys {
+		if hmac.Equal(sig, signature(SigningKey(key), r, ts, body)) {
+			return nil
+		}
+	}
+
+	return ErrBadSignature
+}
@@ -0,0 +1,102 @@
+package csrf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that signed requests are accepted without a cookie or token, and that
+// tampered or stale signatures are rejected.
+func TestRequestSigning(t *testing.T) {
+	var body string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	})
+	p := Protect(testKey, RequestSigning(time.Minute))(h)
+	key := SigningKey(testKey)
+
+	newRequest := func() *http.Request {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/jobs?run=1",
+			strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	}
+
+	var signingTests = []struct {
+		name   string
+		modify func(r *http.Request)
+		code   int
+	}{
+		{"valid", func(r *http.Request) {}, http.StatusOK},
+		{"unsigned", func(r *http.Request) {
+			r.Header.Del(signatureHeader)
+		}, http.StatusForbidden},
+		{"path", func(r *http.Request) {
+			r.URL.RawQuery = "run=2"
+		}, http.StatusForbidden},
+		{"body", func(r *http.Request) {
+			r.Body = ioutil.NopCloser(strings.NewReader("tampered"))
+		}, http.StatusForbidden},
+		{"stale", func(r *http.Request) {
+			ts := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+			sig := r.Header.Get(signatureHeader)
+			r.Header.Set(signatureHeader, "t="+ts+sig[strings.Index(sig, ","):])
+		}, http.StatusForbidden},
+	}
+
+	for _, st := range signingTests {
+		r := newRequest()
+		if err := SignRequest(r, key); err != nil {
+			t.Fatal(err)
+		}
+		st.modify(r)
+
+		body = ""
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != st.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", st.name, rr.Code, st.code)
+		}
+
+		if st.code == http.StatusOK && body != "payload" {
+			t.Fatalf("%s: body not passed to the handler: got %q", st.name, body)
+		}
+	}
+
+	// A signature made with another key is rejected.
+	r := newRequest()
+	if err := SignRequest(r, SigningKey([]byte("some-other-key"))); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("signature with the wrong key accepted: got %v", rr.Code)
+	}
+
+	// Bodies over the MaxBodyBytes limit aren't read to verify them.
+	p = Protect(testKey, RequestSigning(time.Minute), MaxBodyBytes(4))(h)
+	r = newRequest()
+	if err := SignRequest(r, key); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("body over the limit accepted: got %v", rr.Code)
+	}
+}
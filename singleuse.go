@@ -0,0 +1,107 @@
+package csrf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// TokenTaker is implemented by TokenStores that can atomically retrieve and
+// remove a token, such as MemoryStore. SingleUseTokens relies on it to make
+// sure that two concurrent requests can't both consume the same token; with
+// other stores, it falls back to Get followed by Delete.
+type TokenTaker interface {
+	// Take returns and removes the token saved under id, or returns
+	// ErrTokenNotFound if there is none.
+	Take(ctx context.Context, id string) ([]byte, error)
+}
+
+// unusedMarker is the value recorded for an unused single-use token.
+var unusedMarker = []byte{1}
+
+// OneTimeToken returns a single-use token for the form or request that will
+// submit to one of the SingleUseTokens paths. Each token is recorded in the
+// store when it is issued and consumed by the first request that carries it,
+// so a replay of that request fails with ErrTokenUsed. An error is returned if
+// the middleware has not been applied or SingleUseTokens is not set.
+func OneTimeToken(r *http.Request) (string, error) {
+	val, err := contextGet(r, csrfKey)
+	if err != nil {
+		return "", errors.New(errorPrefix + "OneTimeToken called without the CSRF middleware")
+	}
+
+	cs := val.(*csrf)
+	if cs.opts.SingleUseStore == nil {
+		return "", errors.New(errorPrefix + "OneTimeToken called without SingleUseTokens")
+	}
+
+	masked, err := cs.mask(baseToken(r))
+	if err != nil {
+		return "", err
+	}
+
+	// The token was just encoded, so decoding it can't fail.
+	// Tokens are recorded without the timestamp added for TokenMaxAge.
+	issued, _ := base64.StdEncoding.DecodeString(masked)
+	issued = issued[:tokenLength*2]
+	if err := cs.opts.SingleUseStore.Save(r.Context(), singleUseID(issued), unusedMarker); err != nil {
+		return "", errors.Wrap(err, "failed to record single-use token")
+	}
+
+	return masked, nil
+}
+
+// singleUseID returns the ID a single-use token (pad + masked token) is
+// recorded under.
+func singleUseID(issued []byte) string {
+	sum := sha256.Sum256(issued)
+	return hex.EncodeToString(sum[:])
+}
+
+// singleUse reports whether r must carry a single-use token.
+func (cs *csrf) singleUse(r *http.Request) bool {
+	if cs.opts.SingleUseStore == nil {
+		return false
+	}
+
+	if len(cs.singleUsePaths) == 0 {
+		return true
+	}
+
+	for _, m := range cs.singleUsePaths {
+		if m.match(r.URL.Path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// consume consumes the single-use token issued (pad + masked token) carried by
+// r. It returns ErrTokenUsed if the token was never recorded by OneTimeToken
+// or has already been consumed.
+func (cs *csrf) consume(r *http.Request, issued []byte) error {
+	id := singleUseID(issued)
+
+	st := cs.opts.SingleUseStore
+	if taker, ok := st.(TokenTaker); ok {
+		_, err := taker.Take(r.Context(), id)
+		if err == ErrTokenNotFound {
+			return ErrTokenUsed
+		}
+
+		return err
+	}
+
+	if _, err := st.Get(r.Context(), id); err == ErrTokenNotFound {
+		return ErrTokenUsed
+	} else if err != nil {
+		return err
+	}
+
+	return st.Delete(r.Context(), id)
+}
@@ -0,0 +1,130 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSingleUseTokens(t *testing.T) {
+	store := NewMemoryStore(100, time.Hour)
+
+	var token, oneTime string
+	p := Protect(testKey, SingleUseTokens(store, "/charge"))(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			token = Token(r)
+
+			var err error
+			if oneTime, err = OneTimeToken(r); err != nil {
+				t.Fatal(err)
+			}
+		}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/checkout", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	// Keep the tokens issued by the GET: each request that passes issues new
+	// ones.
+	issuedToken, issuedOneTime := token, oneTime
+
+	var singleUseTests = []struct {
+		name  string
+		path  string
+		token string
+		code  int
+	}{
+		{"regular token", "/charge", issuedToken, http.StatusForbidden},
+		{"first use", "/charge", issuedOneTime, http.StatusOK},
+		{"replay", "/charge", issuedOneTime, http.StatusForbidden},
+		{"other path", "/profile", issuedToken, http.StatusOK},
+	}
+
+	for _, st := range singleUseTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org"+st.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", st.token)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != st.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", st.name, rr.Code, st.code)
+		}
+	}
+
+	if _, err := OneTimeToken(r); err == nil {
+		t.Fatal("OneTimeToken did not report a missing middleware")
+	}
+}
+
+// TestSingleUseReplays checks that an identical retry of a request carrying
+// an Idempotency-Key is accepted after it consumed a single-use token.
+func TestSingleUseReplays(t *testing.T) {
+	store := NewMemoryStore(100, time.Hour)
+
+	var oneTime string
+	p := Protect(testKey, SingleUseTokens(store, "/charge"),
+		IdempotentReplays(1, time.Minute))(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var err error
+			if oneTime, err = OneTimeToken(r); err != nil {
+				t.Fatal(err)
+			}
+		}))
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/checkout", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+	issuedOneTime := oneTime
+
+	var replayTests = []struct {
+		name string
+		key  string
+		body string
+		code int
+	}{
+		{"first use", "k1", "amount=1", http.StatusOK},
+		{"no key", "", "amount=1", http.StatusForbidden},
+		{"different body", "k1", "amount=2", http.StatusForbidden},
+		{"retry", "k1", "amount=1", http.StatusOK},
+		{"second retry", "k1", "amount=1", http.StatusForbidden},
+	}
+
+	for _, rt := range replayTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/charge",
+			strings.NewReader(rt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", issuedOneTime)
+		if rt.key != "" {
+			r.Header.Set("Idempotency-Key", rt.key)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != rt.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", rt.name, rr.Code, rt.code)
+		}
+	}
+}
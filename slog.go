@@ -0,0 +1,62 @@
+//go:build go1.21
+// +build go1.21
+
+package csrf
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// WithLogger writes structured log records to l: a Debug record for each new
+// token issued, and Warn records for requests that fail validation (with the
+// reason, method, path, Origin and Referer) and for CSRF cookies that can't be
+// decoded. A nil l uses slog.Default(). WithLogger requires Go 1.21 or later.
+func WithLogger(l *slog.Logger) Option {
+	return func(cs *csrf) {
+		if l == nil {
+			l = slog.Default()
+		}
+
+		cs.opts.Logger = slogLogger{l}
+	}
+}
+
+// slogLogger is the eventLogger set by WithLogger.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// attrs returns the attributes common to every record for r.
+func (sl slogLogger) attrs(r *http.Request, name string) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	}
+
+	if name != "" {
+		attrs = append(attrs, slog.String("csrf", name))
+	}
+
+	return attrs
+}
+
+func (sl slogLogger) tokenIssued(r *http.Request, name string) {
+	sl.l.LogAttrs(r.Context(), slog.LevelDebug, "csrf: token issued", sl.attrs(r, name)...)
+}
+
+func (sl slogLogger) validationFailed(r *http.Request, name string, kind FailureKind, reason error) {
+	attrs := append(sl.attrs(r, name),
+		slog.String("reason", reason.Error()),
+		slog.String("kind", kind.String()),
+		slog.String("origin", r.Header.Get("Origin")),
+		slog.String("referer", r.Referer()),
+	)
+
+	sl.l.LogAttrs(r.Context(), slog.LevelWarn, "csrf: validation failed", attrs...)
+}
+
+func (sl slogLogger) decodeError(r *http.Request, name string, err error) {
+	attrs := append(sl.attrs(r, name), slog.String("error", err.Error()))
+	sl.l.LogAttrs(r.Context(), slog.LevelWarn, "csrf: cookie decode failed", attrs...)
+}
@@ -0,0 +1,51 @@
+//go:build go1.21
+// +build go1.21
+
+package csrf
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	p := Protect(testKey, WithLogger(logger))(s)
+
+	r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Header.Set("Origin", "http://evil.example.com")
+	r.Header.Set("Cookie", cookieName+"=tampered")
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	logged := buf.String()
+	for _, want := range []string{
+		`level=WARN msg="csrf: cookie decode failed"`,
+		`level=DEBUG msg="csrf: token issued"`,
+		`level=WARN msg="csrf: validation failed"`,
+		"path=/login",
+		"origin=http://evil.example.com",
+		"kind=missing-token",
+	} {
+		if !strings.Contains(logged, want) {
+			t.Fatalf("log output does not contain %q:\n%s", want, logged)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package csrf
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// defaultBootstrapEndpoint is the default path of the StaticSite bootstrap
+// endpoint.
+const defaultBootstrapEndpoint = "/csrf-bootstrap"
+
+// StaticSite describes a statically pre-rendered frontend, served from a
+// different origin (e.g. a CDN) than the application it submits forms and
+// requests to. See StaticSiteMode.
+type StaticSite struct {
+	// Origins are the origins the frontend is served from - e.g.
+	// "https://www.example.com". Unsafe requests with a Referer from these
+	// origins are accepted, and the bootstrap endpoint may be read from them.
+	Origins []string
+	// Endpoint is the path of the bootstrap endpoint. The script that
+	// populates forms is served at the same path with a ".js" suffix.
+	// Defaults to "/csrf-bootstrap".
+	Endpoint string
+	// CrossSite must be set if the frontend is served from a different site
+	// (registrable domain) than the application - e.g. "example-cdn.net"
+	// rather than "www.example.com" - so that the CSRF cookie is sent with
+	// requests from the frontend. This requires the cookie to be Secure.
+	CrossSite bool
+}
+
+// bootstrapScript fetches a token from the bootstrap endpoint and fills in
+// the token field of every form on the page. The endpoint is resolved against
+// the script's own URL, so the same script works for any application origin.
+const bootstrapScript = `(function(){` +
+	`var src=document.currentScript&&document.currentScript.src;` +
+	`var endpoint=new URL("%s",src||location.href).href;` +
+	`function load(){fetch(endpoint,{credentials:"include",cache:"no-store"})` +
+	`.then(function(res){return res.json()}).then(function(t){` +
+	`window.csrfToken=t.token;window.csrfHeader=t.header;` +
+	`var fields=document.querySelectorAll('input[name="'+t.field+'"],input[data-csrf-token]');` +
+	`for(var i=0;i<fields.length;i++){fields[i].value=t.token}})}` +
+	`if(document.readyState==="loading"){document.addEventListener("DOMContentLoaded",load)}` +
+	`else{load()}})();
+`
+
+// allowOrigin allows the StaticSite origins to read a cross-origin response
+// to r, with credentials.
+func (cs *csrf) allowOrigin(w http.ResponseWriter, r *http.Request) {
+	addVary(w.Header(), "Origin")
+
+	origin := r.Header.Get("Origin")
+	for _, allowed := range cs.opts.StaticSite.Origins {
+		if origin != "" && origin == allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			return
+		}
+	}
+}
+
+// serveBootstrap responds with the request's token, and the header and field
+// it should be submitted in, as JSON.
+func (cs *csrf) serveBootstrap(w http.ResponseWriter, r *http.Request) {
+	cs.allowOrigin(w, r)
+	WriteTokenJSON(w, r)
+}
+
+// serveBootstrapScript responds with the script that populates forms from
+// the bootstrap endpoint. The script is the same for every user, so it may be
+// cached.
+func (cs *csrf) serveBootstrapScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	fmt.Fprintf(w, bootstrapScript, template.JSEscapeString(cs.opts.StaticSite.Endpoint))
+}
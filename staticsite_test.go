@@ -0,0 +1,104 @@
+package csrf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests the bootstrap endpoint and script, and that forms posted from the
+// static frontend are accepted.
+func TestStaticSiteMode(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+	p := Protect(testKey, StaticSiteMode(StaticSite{
+		Origins: []string{"https://www.example.com"},
+	}))(s)
+
+	r, err := http.NewRequest("GET", "https://api.example.com/csrf-bootstrap", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Origin", "https://www.example.com")
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://www.example.com" {
+		t.Fatalf("bootstrap endpoint not readable from the frontend: got %q", got)
+	}
+
+	if cookie := rr.Header().Get("Set-Cookie"); !strings.Contains(cookie, "SameSite=Lax") {
+		t.Fatalf("cookie not tuned for the frontend: got %q", cookie)
+	}
+
+	var resp TokenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Token == "" || resp.Header != headerName || resp.Field != fieldName {
+		t.Fatalf("unexpected bootstrap response: %+v", resp)
+	}
+
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var postTests = []struct {
+		referer string
+		code    int
+	}{
+		{"https://www.example.com/signup", http.StatusOK},
+		{"https://evil.example.org/signup", http.StatusForbidden},
+	}
+
+	for _, pt := range postTests {
+		r, err := http.NewRequest("POST", "https://api.example.com/signup", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("Referer", pt.referer)
+		r.Header.Set(resp.Header, resp.Token)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, r)
+
+		if rr.Code != pt.code {
+			t.Fatalf("%s: wrong status code: got %v want %v", pt.referer, rr.Code, pt.code)
+		}
+	}
+
+	// Other origins can't read the token.
+	r, err = http.NewRequest("GET", "https://api.example.com/csrf-bootstrap", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Origin", "https://evil.example.org")
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("bootstrap endpoint readable from another origin: got %q", got)
+	}
+
+	// The script is served alongside the endpoint.
+	r, err = http.NewRequest("GET", "https://api.example.com/csrf-bootstrap.js", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if !strings.Contains(rr.Body.String(), `"/csrf-bootstrap"`) {
+		t.Fatalf("bootstrap script does not use the endpoint: %s", rr.Body.String())
+	}
+
+	// It is publicly cached, so it must not set the user's cookie.
+	if cookie := rr.Header().Get("Set-Cookie"); cookie != "" {
+		t.Fatalf("bootstrap script sets a cookie: got %q", cookie)
+	}
+}
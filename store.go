@@ -1,12 +1,43 @@
 package csrf
 
 import (
+	"context"
+	"encoding/hex"
 	"net/http"
 	"time"
-
-	"github.com/gorilla/securecookie"
 )
 
+// TokenStore stores CSRF base tokens on the server, keyed by an opaque ID that
+// is kept in the CSRF cookie in place of the token itself. See WithStore.
+//
+// Implementations must be safe for concurrent use. IDs are hex-encoded random
+// values, and tokens are (at most) 32 byte values.
+type TokenStore interface {
+	// Get returns the token saved under id, or ErrTokenNotFound if there is
+	// none (e.g. it has expired or been deleted).
+	Get(ctx context.Context, id string) ([]byte, error)
+	// Save saves token under id, replacing any token already saved under it.
+	Save(ctx context.Context, id string, token []byte) error
+	// Delete removes the token saved under id, if any. Requests carrying a
+	// token issued against it will fail validation, and be issued a new
+	// token.
+	Delete(ctx context.Context, id string) error
+}
+
+// RequestStore keeps the base token of the visitor making a request, such as
+// in the application's own session. See WithRequestStore. Implementations must
+// be safe for concurrent use.
+type RequestStore interface {
+	// Get returns the base token for the visitor making r. It should return
+	// http.ErrNoCookie if the visitor has no token yet (reported as
+	// ErrNoCookie), and any other error if the stored token can't be read
+	// (reported as ErrCookieDecode).
+	Get(r *http.Request) ([]byte, error)
+	// Save saves token as the base token for the visitor making r, writing
+	// any cookie it requires to w.
+	Save(token []byte, w http.ResponseWriter, r *http.Request) error
+}
+
 // store represents the session storage used for CSRF tokens.
 type store interface {
 	// Get returns the real CSRF token from the store.
@@ -16,7 +47,42 @@ type store interface {
 	// For non-cookie stores, the cookie should contain a unique (256 bit) ID
 	// or key that references the token in the backend store.
 	// csrf.GenerateRandomBytes is a helper function for generating secure IDs.
-	Save(token []byte, w http.ResponseWriter) error
+	// The request is provided so that stores can vary their behaviour (e.g.
+	// the keys used) per request.
+	Save(token []byte, w http.ResponseWriter, r *http.Request) error
+}
+
+// serverStore keeps CSRF tokens in a TokenStore, and only a random ID that
+// references the token in a signed cookie.
+type serverStore struct {
+	ids     *cookieStore
+	backend TokenStore
+}
+
+func (ss *serverStore) Get(r *http.Request) ([]byte, error) {
+	id, err := ss.ids.Get(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ss.backend.Get(r.Context(), hex.EncodeToString(id))
+}
+
+func (ss *serverStore) Save(token []byte, w http.ResponseWriter, r *http.Request) error {
+	// Reuse the request's ID if it has one, so that the cookie doesn't need
+	// to be replaced.
+	id, err := ss.ids.Get(r)
+	if err != nil || len(id) != tokenLength {
+		if id, err = generateRandomBytes(tokenLength); err != nil {
+			return err
+		}
+	}
+
+	if err := ss.backend.Save(r.Context(), hex.EncodeToString(id), token); err != nil {
+		return err
+	}
+
+	return ss.ids.Save(id, w, r)
 }
 
 // cookieStore is a signed cookie session store for CSRF tokens.
@@ -27,11 +93,14 @@ type cookieStore struct {
 	httpOnly bool
 	path     string
 	domain   string
-	sc       *securecookie.SecureCookie
+	sameSite SameSiteMode
+	// codecs returns the codec used to authenticate the cookie for a request.
+	codecs func(r *http.Request) (codec, error)
 }
 
 // Get retrieves a CSRF token from the session cookie. It returns an empty token
 // if decoding fails (e.g. HMAC validation fails or the named cookie doesn't exist).
+// A cookie that is authentic but has expired returns ErrTokenExpired.
 func (cs *cookieStore) Get(r *http.Request) ([]byte, error) {
 	// Retrieve the cookie from the request
 	cookie, err := r.Cookie(cs.name)
@@ -39,30 +108,38 @@ func (cs *cookieStore) Get(r *http.Request) ([]byte, error) {
 		return nil, err
 	}
 
-	token := make([]byte, tokenLength)
-	// Decode the HMAC authenticated cookie.
-	err = cs.sc.Decode(cs.name, cookie.Value, &token)
+	sc, err := cs.codecs(r)
 	if err != nil {
 		return nil, err
 	}
 
-	return token, nil
+	// Decode the HMAC authenticated cookie.
+	return sc.Decode(cs.name, cookie.Value)
 }
 
 // Save stores the CSRF token in the session cookie.
-func (cs *cookieStore) Save(token []byte, w http.ResponseWriter) error {
+func (cs *cookieStore) Save(token []byte, w http.ResponseWriter, r *http.Request) error {
+	sc, err := cs.codecs(r)
+	if err != nil {
+		return err
+	}
+
 	// Generate an encoded cookie value with the CSRF token.
-	encoded, err := cs.sc.Encode(cs.name, token)
+	encoded, err := sc.Encode(cs.name, token)
 	if err != nil {
 		return err
 	}
 
+	// Browsers reject prefixed cookies that aren't Secure, so they stay
+	// Secure in development.
+	secure := cs.secure && (!isDevelopment(r) || prefixed(cs.name))
+
 	cookie := &http.Cookie{
 		Name:     cs.name,
 		Value:    encoded,
 		MaxAge:   cs.maxAge,
 		HttpOnly: cs.httpOnly,
-		Secure:   cs.secure,
+		Secure:   secure,
 		Path:     cs.path,
 		Domain:   cs.domain,
 	}
@@ -76,7 +153,43 @@ func (cs *cookieStore) Save(token []byte, w http.ResponseWriter) error {
 	}
 
 	// Write the authenticated cookie to the response.
-	http.SetCookie(w, cookie)
+	writeCookie(w, r, cookie, cs.sameSite)
 
 	return nil
 }
+
+// issued returns the time at which the token in r's cookie was issued, if r
+// carries a valid cookie.
+func (cs *cookieStore) issued(r *http.Request) (time.Time, bool) {
+	cookie, err := r.Cookie(cs.name)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	sc, err := cs.codecs(r)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if sc, ok := sc.(issuer); ok {
+		return sc.issued(cs.name, cookie.Value)
+	}
+
+	return time.Time{}, false
+}
+
+// clear instructs the client to delete the session cookie.
+func (cs *cookieStore) clear(w http.ResponseWriter, r *http.Request) {
+	cookie := &http.Cookie{
+		Name:     cs.name,
+		Value:    "",
+		MaxAge:   -1,
+		HttpOnly: cs.httpOnly,
+		Secure:   cs.secure,
+		Path:     cs.path,
+		Domain:   cs.domain,
+	}
+
+	scopeCookie(r, cookie)
+	http.SetCookie(w, cookie)
+}
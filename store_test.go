@@ -8,8 +8,6 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
-
-	"github.com/gorilla/securecookie"
 )
 
 // Check store implementations
@@ -25,7 +23,7 @@ func (bs *brokenSaveStore) Get(*http.Request) ([]byte, error) {
 	return generateRandomBytes(24)
 }
 
-func (bs *brokenSaveStore) Save(realToken []byte, w http.ResponseWriter) error {
+func (bs *brokenSaveStore) Save(realToken []byte, w http.ResponseWriter, r *http.Request) error {
 	return errors.New("test error")
 }
 
@@ -44,9 +42,9 @@ func TestStoreCannotSave(t *testing.T) {
 	rr := httptest.NewRecorder()
 	p.ServeHTTP(rr, r)
 
-	if rr.Code != http.StatusForbidden {
+	if rr.Code != http.StatusServiceUnavailable {
 		t.Fatalf("broken store did not set an error status: got %v want %v",
-			rr.Code, http.StatusForbidden)
+			rr.Code, http.StatusServiceUnavailable)
 	}
 
 	if c := rr.Header().Get("Set-Cookie"); c != "" {
@@ -56,6 +54,63 @@ func TestStoreCannotSave(t *testing.T) {
 
 }
 
+// panicStore is a CSRF store whose codec blows up.
+type panicStore struct {
+	store
+}
+
+func (ps *panicStore) Get(*http.Request) ([]byte, error) {
+	panic("codec exploded")
+}
+
+// Tests that a panicking store is handled as an internal error.
+func TestStorePanics(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+	p := Protect(testKey, setStore(&panicStore{}))(s)
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("panicking store did not set an error status: got %v want %v",
+			rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+// Tests that the FailOpen policy serves the request when the store fails, and
+// that the failure is still reported.
+func TestStoreFailOpen(t *testing.T) {
+	var reason error
+	s := http.NewServeMux()
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		reason = FailureReason(r)
+	})
+	p := Protect(testKey, setStore(&brokenSaveStore{}), FailurePolicy(FailOpen))(s)
+
+	r, err := http.NewRequest("POST", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("FailOpen did not serve the request: got %v want %v",
+			rr.Code, http.StatusOK)
+	}
+
+	if reason == nil {
+		t.Fatal("FailOpen did not record the failure reason")
+	}
+}
+
 // TestCookieDecode tests that an invalid cookie store returns a decoding error.
 func TestCookieDecode(t *testing.T) {
 	r, err := http.NewRequest("GET", "/", nil)
@@ -66,9 +121,9 @@ func TestCookieDecode(t *testing.T) {
 	var age = 3600
 
 	// Test with a nil hash key
-	sc := securecookie.New(nil, nil)
-	sc.MaxAge(age)
-	st := &cookieStore{cookieName, age, true, true, "", "", sc}
+	sc := newCodec(age, nil)
+	st := &cookieStore{cookieName, age, true, true, "", "", SameSiteDefaultMode,
+		func(*http.Request) (codec, error) { return sc, nil }}
 
 	// Set a fake cookie value so r.Cookie passes.
 	r.Header.Set("Cookie", fmt.Sprintf("%s=%s", cookieName, "notacookie"))
@@ -84,13 +139,13 @@ func TestCookieEncode(t *testing.T) {
 	var age = 3600
 
 	// Test with a nil hash key
-	sc := securecookie.New(nil, nil)
-	sc.MaxAge(age)
-	st := &cookieStore{cookieName, age, true, true, "", "", sc}
+	sc := newCodec(age, nil)
+	st := &cookieStore{cookieName, age, true, true, "", "", SameSiteDefaultMode,
+		func(*http.Request) (codec, error) { return sc, nil }}
 
 	rr := httptest.NewRecorder()
 
-	err := st.Save(nil, rr)
+	err := st.Save(nil, rr, nil)
 	if err == nil {
 		t.Fatal("cookiestore did not report an invalid hashkey on encode")
 	}
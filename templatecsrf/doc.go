@@ -0,0 +1,13 @@
+// Package templatecsrf holds helpers that output the hidden CSRF field in
+// template engines other than html/template. Each engine has its own package,
+// so applications only import the engines they use:
+//
+//	github.com/gorilla/csrf/templatecsrf/jet           (jetcsrf)
+//	github.com/gorilla/csrf/templatecsrf/pongo2        (pongo2csrf)
+//	github.com/gorilla/csrf/templatecsrf/quicktemplate (qtcsrf)
+//	github.com/gorilla/csrf/templatecsrf/templ         (templcsrf)
+//
+// Each helper returns the markup of csrf.TemplateField as the engine's own
+// safe-HTML type, so it is output without escaping. For other engines, use
+// csrf.TemplateFieldString and mark the result as safe in the engine's own way.
+package templatecsrf
@@ -0,0 +1,20 @@
+module github.com/gorilla/csrf/templatecsrf
+
+go 1.25.0
+
+require (
+	github.com/CloudyKit/jet/v6 v6.2.0
+	github.com/a-h/templ v0.3.1020
+	github.com/flosch/pongo2/v6 v6.1.0
+	github.com/gorilla/csrf v1.6.2
+	github.com/valyala/quicktemplate v1.7.0
+)
+
+require (
+	github.com/CloudyKit/fastprinter v0.0.0-20200109182630-33d98a066a53 // indirect
+	github.com/gorilla/securecookie v1.1.1 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+)
+
+replace github.com/gorilla/csrf => ../
@@ -0,0 +1,27 @@
+// Package jetcsrf outputs the hidden CSRF field in Jet templates.
+//
+//	vars := make(jet.VarMap)
+//	vars.Set(csrf.TemplateTag, jetcsrf.TemplateField(r))
+//	tmpl.Execute(w, vars, nil)
+//
+// and in the template:
+//
+//	<form method="POST">{{ csrfField }}</form>
+package jetcsrf
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/gorilla/csrf"
+)
+
+// TemplateField returns the hidden <input> field for the request as a
+// jet.Renderer, which Jet outputs without escaping.
+func TemplateField(r *http.Request) jet.Renderer {
+	field := csrf.TemplateFieldString(r)
+	return jet.RendererFunc(func(rt *jet.Runtime) {
+		io.WriteString(rt.Writer, field)
+	})
+}
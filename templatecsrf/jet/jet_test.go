@@ -0,0 +1,41 @@
+package jetcsrf
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/gorilla/csrf"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestTemplateField(t *testing.T) {
+	var got, want string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want = csrf.TemplateFieldString(r)
+		set := jet.NewSet(jet.NewInMemLoader())
+		tmpl, err := set.Parse("form.jet", "<form>{{ csrfField }}</form>")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vars := make(jet.VarMap)
+		vars.Set(csrf.TemplateTag, TemplateField(r))
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, vars, nil); err != nil {
+			t.Fatal(err)
+		}
+		got = buf.String()
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	csrf.Protect(testKey)(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	if want == "" || got != "<form>"+want+"</form>" {
+		t.Fatalf("field not rendered unescaped: got %q want %q", got, want)
+	}
+}
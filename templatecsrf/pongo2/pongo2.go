@@ -0,0 +1,23 @@
+// Package pongo2csrf outputs the hidden CSRF field in pongo2 templates.
+//
+//	tmpl.ExecuteWriter(pongo2.Context{
+//		csrf.TemplateTag: pongo2csrf.TemplateField(r),
+//	}, w)
+//
+// and in the template:
+//
+//	<form method="POST">{{ csrfField }}</form>
+package pongo2csrf
+
+import (
+	"net/http"
+
+	"github.com/flosch/pongo2/v6"
+	"github.com/gorilla/csrf"
+)
+
+// TemplateField returns the hidden <input> field for the request as a safe
+// pongo2 value, which pongo2 outputs without escaping.
+func TemplateField(r *http.Request) *pongo2.Value {
+	return pongo2.AsSafeValue(csrf.TemplateFieldString(r))
+}
@@ -0,0 +1,35 @@
+package pongo2csrf
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+	"github.com/gorilla/csrf"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestTemplateField(t *testing.T) {
+	var got, want string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want = csrf.TemplateFieldString(r)
+		tmpl := pongo2.Must(pongo2.FromString("<form>{{ csrfField }}</form>"))
+
+		var buf bytes.Buffer
+		err := tmpl.ExecuteWriter(pongo2.Context{csrf.TemplateTag: TemplateField(r)}, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = buf.String()
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	csrf.Protect(testKey)(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	if want == "" || got != "<form>"+want+"</form>" {
+		t.Fatalf("field not rendered unescaped: got %q want %q", got, want)
+	}
+}
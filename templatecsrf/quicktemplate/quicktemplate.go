@@ -0,0 +1,36 @@
+// Package qtcsrf outputs the hidden CSRF field in quicktemplate templates.
+// Its functions follow the naming of the code that qtc generates, so the
+// field can be output like any other template:
+//
+//	{% import "github.com/gorilla/csrf/templatecsrf/quicktemplate" %}
+//
+//	{% func SignupPage(r *http.Request) %}
+//	<form method="POST">{%= qtcsrf.TemplateField(r) %}</form>
+//	{% endfunc %}
+package qtcsrf
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gorilla/csrf"
+	"github.com/valyala/quicktemplate"
+)
+
+// StreamTemplateField writes the hidden <input> field for the request to qw
+// without escaping.
+func StreamTemplateField(qw *quicktemplate.Writer, r *http.Request) {
+	qw.N().S(csrf.TemplateFieldString(r))
+}
+
+// WriteTemplateField writes the hidden <input> field for the request to w.
+func WriteTemplateField(w io.Writer, r *http.Request) {
+	qw := quicktemplate.AcquireWriter(w)
+	StreamTemplateField(qw, r)
+	quicktemplate.ReleaseWriter(qw)
+}
+
+// TemplateField returns the hidden <input> field for the request.
+func TemplateField(r *http.Request) string {
+	return csrf.TemplateFieldString(r)
+}
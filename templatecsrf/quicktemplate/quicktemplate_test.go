@@ -0,0 +1,35 @@
+package qtcsrf
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/csrf"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestTemplateField(t *testing.T) {
+	var got, want string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want = csrf.TemplateFieldString(r)
+		var buf bytes.Buffer
+		buf.WriteString("<form>")
+		WriteTemplateField(&buf, r)
+		buf.WriteString("</form>")
+		got = buf.String()
+
+		if TemplateField(r) != want {
+			t.Errorf("TemplateField: got %q want %q", TemplateField(r), want)
+		}
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	csrf.Protect(testKey)(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	if want == "" || got != "<form>"+want+"</form>" {
+		t.Fatalf("field not rendered unescaped: got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+// Package templcsrf outputs the hidden CSRF field in templ components.
+//
+//	templ SignupForm(r *http.Request) {
+//		<form method="POST">
+//			@templcsrf.TemplateField(r)
+//		</form>
+//	}
+package templcsrf
+
+import (
+	"net/http"
+
+	"github.com/a-h/templ"
+	"github.com/gorilla/csrf"
+)
+
+// TemplateField returns the hidden <input> field for the request as a
+// templ.Component, which renders it without escaping.
+func TemplateField(r *http.Request) templ.Component {
+	return templ.Raw(csrf.TemplateFieldString(r))
+}
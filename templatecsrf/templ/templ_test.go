@@ -0,0 +1,33 @@
+package templcsrf
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/csrf"
+)
+
+var testKey = []byte("keep-it-secret-keep-it-safe-----")
+
+func TestTemplateField(t *testing.T) {
+	var got, want string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want = csrf.TemplateFieldString(r)
+		var buf bytes.Buffer
+		buf.WriteString("<form>")
+		if err := TemplateField(r).Render(r.Context(), &buf); err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteString("</form>")
+		got = buf.String()
+	})
+
+	r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	csrf.Protect(testKey)(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	if want == "" || got != "<form>"+want+"</form>" {
+		t.Fatalf("field not rendered unescaped: got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build go1.11
+// +build go1.11
+
+package csrf
+
+import (
+	"crypto/tls"
+)
+
+// exportKeyingMaterial returns the tls-exporter channel binding (RFC 9266) for
+// the connection described by state.
+func exportKeyingMaterial(state *tls.ConnectionState) ([]byte, error) {
+	return state.ExportKeyingMaterial(channelBindingLabel, nil, tokenLength)
+}
@@ -0,0 +1,16 @@
+//go:build !go1.11
+// +build !go1.11
+
+package csrf
+
+import (
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+)
+
+// Exported keying material is only available from Go 1.11.
+
+func exportKeyingMaterial(state *tls.ConnectionState) ([]byte, error) {
+	return nil, errors.New("channel binding requires Go 1.11 or later")
+}
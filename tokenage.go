@@ -0,0 +1,90 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// stampLength is the length of the timestamp and MAC appended to issued
+	// tokens when TokenMaxAge is set.
+	stampLength = 8 + stampMACLength
+	// stampMACLength is the length of the (truncated) MAC of the timestamp.
+	stampMACLength = 16
+	// stampSkew is how far in the future a token's timestamp may be, to allow
+	// for clock differences between instances.
+	stampSkew = time.Minute
+)
+
+// stampLabel identifies the keys that token timestamps are authenticated with.
+var stampLabel = []byte("token-stamp")
+
+// stampKeys derives the keys that token timestamps are authenticated with from
+// the authentication keys, so that clients - who can unmask their own tokens -
+// can't produce a valid timestamp.
+func stampKeys(keys [][]byte) [][]byte {
+	derived := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if len(key) > 0 {
+			derived = append(derived, deriveToken(key, stampLabel))
+		}
+	}
+
+	return derived
+}
+
+// stampMAC returns the MAC, under key, of an issued token's timestamp. It
+// covers the token the issued token unmasks to, so that a timestamp can't be
+// moved to another token.
+func stampMAC(key, issued, ts []byte) []byte {
+	msg := append(append([]byte("issued|"), unmask(issued)...), ts...)
+	return deriveToken(key, msg)[:stampMACLength]
+}
+
+// stamp appends the time at which issued (pad + masked token) was issued, and
+// its MAC, if TokenMaxAge is set.
+func (cs *csrf) stamp(issued []byte) []byte {
+	if cs.opts.TokenMaxAge <= 0 || len(cs.stampKeys) == 0 {
+		return issued
+	}
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().Unix()))
+	issued = append(issued, ts[:]...)
+	return append(issued, stampMAC(cs.stampKeys[0], issued[:tokenLength*2], ts[:])...)
+}
+
+// checkStamp verifies the timestamp of an issued token if TokenMaxAge is set,
+// returning the token without it. It returns ErrBadToken if the token carries
+// no valid timestamp, and ErrTokenExpired if it was issued more than
+// TokenMaxAge ago.
+func (cs *csrf) checkStamp(issued []byte) ([]byte, error) {
+	if cs.opts.TokenMaxAge <= 0 {
+		return issued, nil
+	}
+
+	if len(issued) != tokenLength*2+stampLength {
+		return nil, ErrBadToken
+	}
+
+	token, ts, mac := issued[:tokenLength*2], issued[tokenLength*2:tokenLength*2+8], issued[tokenLength*2+8:]
+	verified := false
+	for _, key := range cs.stampKeys {
+		if hmac.Equal(mac, stampMAC(key, token, ts)) {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, ErrBadToken
+	}
+
+	age := time.Since(time.Unix(int64(binary.BigEndian.Uint64(ts)), 0))
+	if age > cs.opts.TokenMaxAge || age < -stampSkew {
+		return nil, ErrTokenExpired
+	}
+
+	return token, nil
+}
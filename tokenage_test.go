@@ -0,0 +1,88 @@
+package csrf
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenMaxAge(t *testing.T) {
+	var token string
+	var reason error
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		reason = FailureReason(r)
+	})
+	p := Protect(testKey, TokenMaxAge(30*time.Minute), ErrorHandler(h))(h)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	issued, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// restamp returns token with its timestamp replaced by ts, and its MAC
+	// computed by mac.
+	restamp := func(ts time.Time, mac func(issued, ts []byte) []byte) string {
+		b := append([]byte(nil), issued[:tokenLength*2]...)
+		stamp := make([]byte, 8)
+		binary.BigEndian.PutUint64(stamp, uint64(ts.Unix()))
+		b = append(b, stamp...)
+		b = append(b, mac(issued[:tokenLength*2], stamp)...)
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	// serverMAC is the MAC the middleware computes; clientMAC is one a client
+	// can compute from its own token, without the key.
+	serverMAC := func(issued, ts []byte) []byte {
+		return stampMAC(stampKeys([][]byte{testKey})[0], issued, ts)
+	}
+	clientMAC := func(issued, ts []byte) []byte {
+		return deriveToken(unmask(issued), append([]byte("issued|"), ts...))[:stampMACLength]
+	}
+
+	tampered := append([]byte(nil), issued...)
+	tampered[tokenLength*2] ^= 1
+	untimed := base64.StdEncoding.EncodeToString(issued[:tokenLength*2])
+
+	var ageTests = []struct {
+		name   string
+		token  string
+		reason error
+	}{
+		{"fresh", token, nil},
+		{"stale", restamp(time.Now().Add(-31*time.Minute), serverMAC), ErrTokenExpired},
+		{"future", restamp(time.Now().Add(time.Hour), serverMAC), ErrTokenExpired},
+		{"client restamp", restamp(time.Now(), clientMAC), ErrBadToken},
+		{"tampered", base64.StdEncoding.EncodeToString(tampered), ErrBadToken},
+		{"untimed", untimed, ErrBadToken},
+	}
+
+	for _, at := range ageTests {
+		r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Cookie", cookie)
+		r.Header.Set("X-CSRF-Token", at.token)
+
+		reason = nil
+		p.ServeHTTP(httptest.NewRecorder(), r)
+
+		if reason != at.reason {
+			t.Fatalf("%s: wrong failure reason: got %v want %v", at.name, reason, at.reason)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package csrf
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// TokenResponse is the JSON envelope written by WriteTokenJSON (and served by
+// the StaticSiteMode bootstrap endpoint).
+type TokenResponse struct {
+	// Token is the masked CSRF token (see Token).
+	Token string `json:"token"`
+	// Header is the request header the token should be submitted in.
+	Header string `json:"header"`
+	// Field is the form field the token should be submitted in.
+	Field string `json:"field"`
+	// Expires is the Unix time at which the token expires, if it does.
+	Expires int64 `json:"expires,omitempty"`
+}
+
+// WriteTokenJSON writes the request's CSRF token to w as a JSON TokenResponse,
+// along with the header and form field it should be submitted in and its
+// expiry, for JSON APIs that hand tokens to their clients. The response is
+// marked as uncacheable. An error is returned if the middleware has not been
+// applied.
+func WriteTokenJSON(w http.ResponseWriter, r *http.Request) error {
+	val, err := contextGet(r, csrfKey)
+	if err != nil {
+		return errors.New(errorPrefix + "WriteTokenJSON called without the CSRF middleware")
+	}
+	cs := val.(*csrf)
+
+	resp := TokenResponse{
+		Token:  Token(r),
+		Header: cs.opts.RequestHeader,
+		Field:  cs.opts.FieldName,
+	}
+
+	if expiry := TokenExpiry(r); !expiry.IsZero() {
+		resp.Expires = expiry.Unix()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	addVary(w.Header(), "Cookie")
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// TokenHandler returns an http.Handler that responds with the request's CSRF
+// token as JSON (see WriteTokenJSON), for single-page applications to fetch a
+// token from when they start - e.g. at "GET /csrf-token". Register it behind
+// the middleware, which also sets the CSRF cookie if the client doesn't have
+// one. Requests that didn't pass through the middleware get a 500 Internal
+// Server Error.
+func TokenHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := contextGet(r, csrfKey); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+
+		WriteTokenJSON(w, r)
+	})
+}
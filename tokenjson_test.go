@@ -0,0 +1,99 @@
+package csrf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteTokenJSON(t *testing.T) {
+	s := http.NewServeMux()
+	p := Protect(testKey, MaxAge(defaultAge))(s)
+
+	var token string
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+		if err := WriteTokenJSON(w, r); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("wrong Content-Type: got %q want %q", ct, "application/json")
+	}
+
+	if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Fatalf("response is cacheable: got %q", cc)
+	}
+
+	var resp TokenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Token == "" || resp.Header != headerName || resp.Field != fieldName || resp.Expires == 0 {
+		t.Fatalf("incomplete response: %+v", resp)
+	}
+
+	if len(resp.Token) != len(token) {
+		t.Fatalf("wrong token: got %q want a token like %q", resp.Token, token)
+	}
+}
+
+// Tests that WriteTokenJSON reports an error without the middleware.
+func TestWriteTokenJSONNoMiddleware(t *testing.T) {
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteTokenJSON(httptest.NewRecorder(), r); err == nil {
+		t.Fatal("WriteTokenJSON did not report the missing middleware")
+	}
+}
+
+func TestTokenHandler(t *testing.T) {
+	s := http.NewServeMux()
+	s.Handle("/csrf-token", TokenHandler())
+	p := Protect(testKey)(s)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/csrf-token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Set-Cookie") == "" {
+		t.Fatalf("handler did not issue a token: got %v, cookie %q",
+			rr.Code, rr.Header().Get("Set-Cookie"))
+	}
+
+	var resp TokenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Token == "" {
+		t.Fatal("handler responded without a token")
+	}
+
+	// Without the middleware, the handler fails.
+	rr = httptest.NewRecorder()
+	TokenHandler().ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("handler served a request without the middleware: got %v want %v",
+			rr.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,222 @@
+package csrf
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tokens issues and checks CSRF tokens without an *http.Request, for servers
+// such as fasthttp that have their own request types and would otherwise have
+// to convert every request to use the middleware. Tokens share their format,
+// cookie encoding and checks with the middleware, so the two interoperate.
+// See the adapter/fasthttp package for middleware built on Tokens.
+//
+// A Tokens is configured with the same options as Protect. Only the options
+// that concern the cookie, the token and the origin check apply: the cookie
+// name, prefix, attributes and encoding, MaxAge, PreviousKeys, TokenMaxAge,
+// TokenPool, RandomRetry, RequestHeader, FieldName, SafeMethods,
+// TrustedOrigins, SharedDomain, OriginCheck and FailureStatus. NewTokens
+// returns an error for any other option, such as KeyFunc, SingleUseTokens,
+// IdempotentReplays, TrustedProxies or PublicCache.
+type Tokens struct {
+	cs *csrf
+}
+
+// CookieConfig describes the CSRF cookie to be set by servers using Tokens.
+type CookieConfig struct {
+	Name     string
+	Path     string
+	Domain   string
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite SameSiteMode
+}
+
+// NewTokens returns Tokens configured with authKey and opts, as Protect. An
+// error is returned if opts include an option that Tokens don't support.
+func NewTokens(authKey []byte, opts ...Option) (*Tokens, error) {
+	cs := parseOptions(nil, opts...)
+	o := cs.opts
+	switch {
+	case cs.st != nil || o.Store != nil || o.SessionCookie != "":
+		return nil, errors.New(errorPrefix + "Tokens only support cookie storage")
+	case o.KeyFunc != nil, o.Signer != nil, o.Scope == IsolatedScope:
+		return nil, errors.New(errorPrefix + "Tokens don't support per-request keys")
+	case o.OriginFunc != nil:
+		return nil, errors.New(errorPrefix + "Tokens don't support WithOriginCheck")
+	case o.DomainFunc != nil, o.PathFunc != nil:
+		return nil, errors.New(errorPrefix + "Tokens don't support per-request cookie attributes")
+	case len(o.Hosts) > 0:
+		return nil, errors.New(errorPrefix + "Tokens don't support HostOptions")
+	case o.ChannelBinding, o.SingleUseStore != nil, len(o.BoundMethods) > 0,
+		o.ReplayLimit > 0, o.SigningWindow > 0:
+		return nil, errors.New(errorPrefix + "Tokens don't support ChannelBinding, " +
+			"SingleUseTokens, MethodBoundTokens, IdempotentReplays or RequestSigning")
+	case o.TrustForwarded, len(o.TrustedProxies) > 0, o.SchemeFunc != nil, o.EnforceTLS,
+		o.DevMode != DevModeOff, o.FetchMetadata != FetchMetadataOff, o.WebSockets,
+		len(o.ExemptPaths) > 0, o.SkipFunc != nil, o.Classifier != nil,
+		len(o.Normalizers) > 0, len(o.Validators) > 0, o.HoneypotField != "":
+		return nil, errors.New(errorPrefix + "Tokens don't support options that inspect the request")
+	case len(o.Extractors) > 0, o.JSONField != "", o.AuthScheme != "", o.XSRFCookie != "",
+		o.MaxBodyBytes > 0:
+		return nil, errors.New(errorPrefix + "Tokens only support the RequestHeader and FieldName")
+	case o.ErrorHandler != nil, len(o.ErrorHandlers) > 0, o.Mode != Enforce, o.Enforcement != nil,
+		o.FailurePolicy != FailClosed, o.Reissue, o.TarpitDelay > 0, o.Alert != nil:
+		return nil, errors.New(errorPrefix + "Tokens don't handle failures: their callers do")
+	case o.FingerprintHeader != "", o.ExpiryHeader != "", len(o.ResponseHeaders) > 0,
+		len(o.Vary) > 0, o.CacheControl != "", o.PublicCache != PublicCacheAllow, o.InjectForms,
+		o.DeferredEndpoint != "", o.RenewEndpoint != "", o.StaticSite.Endpoint != "":
+		return nil, errors.New(errorPrefix + "Tokens don't write responses")
+	case o.Metrics != nil, o.Tracer != nil, o.Logger != nil, o.Name != "":
+		return nil, errors.New(errorPrefix + "Tokens don't report metrics, traces or logs")
+	}
+
+	cs.setup(authKey)
+	return &Tokens{cs: cs}, nil
+}
+
+// Cookie returns the configuration of the CSRF cookie.
+func (t *Tokens) Cookie() CookieConfig {
+	o := t.cs.opts
+	return CookieConfig{
+		Name:     o.CookieName,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		Secure:   o.Secure,
+		HttpOnly: o.HttpOnly,
+		SameSite: o.SameSite,
+	}
+}
+
+// RequestHeader returns the name of the header that carries the token.
+func (t *Tokens) RequestHeader() string {
+	return t.cs.opts.RequestHeader
+}
+
+// FieldName returns the name of the form field that carries the token.
+func (t *Tokens) FieldName() string {
+	return t.cs.opts.FieldName
+}
+
+// FailureStatus returns the status code that requests failing validation
+// should be rejected with (see the FailureStatus option).
+func (t *Tokens) FailureStatus() int {
+	return t.cs.opts.FailureStatus
+}
+
+// Safe reports whether requests with method are exempt from validation.
+func (t *Tokens) Safe(method string) bool {
+	return contains(t.cs.opts.SafeMethods, method)
+}
+
+// Session returns the session for a request that carried the CSRF cookie
+// value cookie, which is empty if it carried none. If the cookie is missing or
+// can't be used, the session is given a new token, and Session.Cookie must be
+// set on the response. An error is returned if a new token can't be issued.
+func (t *Tokens) Session(cookie string) (*Session, error) {
+	name := t.cs.opts.CookieName
+
+	var sessionErr error = http.ErrNoCookie
+	if cookie != "" {
+		realToken, err := t.cs.sc.Decode(name, cookie)
+		if err == nil && len(realToken) == tokenLength {
+			return &Session{cs: t.cs, realToken: realToken}, nil
+		}
+
+		sessionErr = err
+	}
+
+	realToken, err := t.cs.randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := t.cs.sc.Encode(name, realToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{cs: t.cs, realToken: realToken, sessionErr: sessionErr, Cookie: encoded}, nil
+}
+
+// CheckOrigin checks that a request with an unsafe method, made to host with
+// scheme ("http" or "https"), was not made from another site, as the
+// middleware does. origin and referer are the values of the request's Origin
+// and Referer headers. It returns ErrBadOrigin, ErrNoReferer or ErrBadReferer
+// if the request may have been forged.
+func (t *Tokens) CheckOrigin(scheme, host, origin, referer string) error {
+	return t.cs.checkOrigin(nil, &url.URL{Scheme: scheme, Host: host}, origin, referer)
+}
+
+// Session is the CSRF session of a single request, as returned by
+// Tokens.Session.
+type Session struct {
+	cs        *csrf
+	realToken []byte
+	// sessionErr is why the request's cookie couldn't be used, if it
+	// couldn't.
+	sessionErr error
+
+	// Cookie is the encoded value of a new CSRF cookie to be set on the
+	// response, or "" if the request's cookie is still in use.
+	Cookie string
+}
+
+// Token returns a masked CSRF token for the session, as Token.
+func (s *Session) Token() (string, error) {
+	return s.cs.mask(s.realToken)
+}
+
+// Verify checks the masked token sent with a request, as the middleware
+// does. It returns nil if the token is valid, and otherwise the reason the
+// request must be rejected, such as ErrNoToken or ErrBadToken.
+func (s *Session) Verify(token string) error {
+	return s.cs.verifyToken(token, s.realToken, s.sessionErr)
+}
+
+// verifyToken checks a masked token sent outside the request body against
+// realToken. sessionErr is why the session token had to be replaced, if it
+// did.
+func (cs *csrf) verifyToken(token string, realToken []byte, sessionErr error) error {
+	if token == "" {
+		return ErrNoToken
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return ErrBadToken
+	}
+
+	issued, err := cs.checkStamp(decoded)
+	if err != nil {
+		return err
+	}
+
+	// A token issued against an expired session token can never match the
+	// new one.
+	if sessionErr == ErrTokenExpired {
+		return ErrTokenExpired
+	}
+
+	if !compareTokens(unmask(issued), realToken) {
+		return mismatchReason(sessionErr)
+	}
+
+	return nil
+}
+
+// Expires returns the time at which a new cookie set from Session.Cookie
+// expires, or the zero time if it is a session cookie.
+func (s *Session) Expires() time.Time {
+	if s.cs.opts.MaxAge <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(time.Duration(s.cs.opts.MaxAge) * time.Second)
+}
@@ -0,0 +1,167 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTokens checks that tokens issued by Tokens are accepted by the
+// middleware and vice versa.
+func TestTokens(t *testing.T) {
+	tokens, err := NewTokens(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := tokens.Session("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Cookie == "" {
+		t.Fatal("no cookie issued for a new session")
+	}
+
+	token, err := s.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Verify(token); err != nil {
+		t.Fatalf("token rejected by its own session: %v", err)
+	}
+
+	// The middleware accepts the cookie and token.
+	p := Protect(testKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	r, err := http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.AddCookie(&http.Cookie{Name: tokens.Cookie().Name, Value: s.Cookie})
+	r.Header.Set(tokens.RequestHeader(), token)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("middleware rejected the token: got %v", rr.Code)
+	}
+
+	// And the session accepts the token the middleware issued.
+	s, err = tokens.Session(s.Cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Cookie != "" {
+		t.Fatal("new cookie issued for a valid session")
+	}
+
+	var verifyTests = []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"middleware token", token, nil},
+		{"no token", "", ErrNoToken},
+		{"not base64", "%%%", ErrBadToken},
+		{"other session", mustToken(t, tokens), ErrBadToken},
+	}
+
+	for _, vt := range verifyTests {
+		if err := s.Verify(vt.token); err != vt.err {
+			t.Errorf("%s: got %v want %v", vt.name, err, vt.err)
+		}
+	}
+
+	// A token sent without a cookie is reported as such.
+	s, err = tokens.Session("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Verify(token); err != ErrNoCookie {
+		t.Errorf("missing cookie: got %v want %v", err, ErrNoCookie)
+	}
+}
+
+func TestTokensCheckOrigin(t *testing.T) {
+	tokens, err := NewTokens(testKey, TrustedOrigins([]string{"trusted.example.com"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var originTests = []struct {
+		scheme, origin, referer string
+		err                     error
+	}{
+		{"http", "https://evil.example.com", "", nil},
+		{"https", "https://www.gorillatoolkit.org", "", nil},
+		{"https", "https://trusted.example.com", "", nil},
+		{"https", "https://evil.example.com", "", ErrBadOrigin},
+		{"https", "", "https://www.gorillatoolkit.org/signup", nil},
+		{"https", "", "https://evil.example.com/", ErrBadReferer},
+		{"https", "", "", ErrNoReferer},
+	}
+
+	for _, ot := range originTests {
+		err := tokens.CheckOrigin(ot.scheme, "www.gorillatoolkit.org", ot.origin, ot.referer)
+		if err != ot.err {
+			t.Errorf("%s %q %q: got %v want %v", ot.scheme, ot.origin, ot.referer, err, ot.err)
+		}
+	}
+}
+
+func TestNewTokensUnsupported(t *testing.T) {
+	var unsupportedTests = []struct {
+		name   string
+		option Option
+	}{
+		{"IsolatedScope", Scope(IsolatedScope)},
+		{"WithStore", WithStore(NewMemoryStore(0, 0))},
+		{"ChannelBinding", ChannelBinding(true)},
+		{"SingleUseTokens", SingleUseTokens(NewMemoryStore(0, 0))},
+		{"MethodBoundTokens", MethodBoundTokens("DELETE")},
+		{"IdempotentReplays", IdempotentReplays(1, time.Minute)},
+		{"TrustedProxies", TrustedProxies([]string{"10.0.0.0/8"})},
+		{"ExemptPaths", ExemptPaths("/webhooks/")},
+		{"JSONField", JSONField("csrf_token")},
+		{"ErrorHandler", ErrorHandler(http.NotFoundHandler())},
+		{"Mode", Mode(ReportOnly)},
+		{"PublicCache", PublicCache(PublicCacheStripCookie)},
+		{"InjectForms", InjectForms(true)},
+		{"Name", Name("login")},
+	}
+
+	for _, ut := range unsupportedTests {
+		if _, err := NewTokens(testKey, ut.option); err == nil {
+			t.Errorf("%s accepted", ut.name)
+		}
+	}
+
+	if _, err := NewTokens(testKey, MaxAge(600), TokenMaxAge(time.Hour), TokenPool(4),
+		SafeMethods("GET"), TrustedOrigins([]string{"example.com"}), FailureStatus(419)); err != nil {
+		t.Errorf("supported options rejected: %v", err)
+	}
+}
+
+// mustToken returns a token for a new session of tokens.
+func mustToken(t *testing.T, tokens *Tokens) string {
+	s, err := tokens.Session("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := s.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
@@ -0,0 +1,63 @@
+package csrf
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer starts spans around the middleware's work on a request, so that token
+// issuance and validation show up in distributed traces. See WithTracer, and
+// the otelcsrf package for an OpenTelemetry implementation.
+type Tracer interface {
+	// Start starts a span named name as a child of any span in ctx, and
+	// returns a context carrying the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// Fail records that the request failed validation, and why.
+	Fail(kind FailureKind, reason error)
+	// End ends the span.
+	End()
+}
+
+const (
+	// issueSpan is the name of the span around the issuance of a new token.
+	issueSpan = "csrf.issue"
+	// validateSpan is the name of the span around the validation of a request
+	// with an unsafe method.
+	validateSpan = "csrf.validate"
+)
+
+// startSpan starts the named span for r with the Tracer, if any, returning r
+// with the span's context.
+func (cs *csrf) startSpan(r *http.Request, name string) (*http.Request, Span) {
+	if cs.opts.Tracer == nil {
+		return r, nil
+	}
+
+	ctx, span := cs.opts.Tracer.Start(r.Context(), name)
+	if name == validateSpan {
+		// Keep the span for failSpan.
+		ctx = context.WithValue(ctx, spanKey, span)
+	}
+
+	return r.WithContext(ctx), span
+}
+
+// endSpan ends span, if it was started.
+func endSpan(span Span) {
+	if span != nil {
+		span.End()
+	}
+}
+
+// failSpan records a failure on r's validation span, if any, and ends it.
+func failSpan(r *http.Request, kind FailureKind, reason error) {
+	if val, err := contextGet(r, spanKey); err == nil {
+		span := val.(Span)
+		span.Fail(kind, reason)
+		span.End()
+	}
+}
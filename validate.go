@@ -0,0 +1,74 @@
+package csrf
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Validate checks the CSRF cookie and token carried by r, as the middleware
+// does for requests with unsafe methods, without serving the request. It is
+// for places the middleware doesn't reach: a WebSocket message handler that
+// was given the handshake request and a token, say, or a background job that
+// replays queued requests. authKey and opts must match those passed to
+// Protect for the tokens to verify.
+//
+// It returns nil if the token is valid, and otherwise the reason the request
+// must be rejected, such as ErrNoCookie, ErrNoToken, ErrBadToken or
+// ErrTokenExpired (see FailureReason). Only the cookie and token are checked:
+// the Origin and Referer, Fetch Metadata, the honeypot, single-use tokens and
+// Validators are not, and the request's method is not considered, so that
+// callers decide which requests need validation.
+func Validate(r *http.Request, authKey []byte, opts ...Option) error {
+	cs := parseOptions(nil, opts...)
+
+	// Apply the options for r's host, if it has its own.
+	for host, hostOpts := range cs.opts.Hosts {
+		if strings.EqualFold(host, requestHost(r)) {
+			cs = parseOptions(nil, append(opts[:len(opts):len(opts)], hostOpts...)...)
+			break
+		}
+	}
+
+	// Validation doesn't issue tokens, so needs no pool of them.
+	cs.opts.TokenPool = 0
+	cs.setup(authKey)
+
+	return cs.validate(r)
+}
+
+// validate checks the cookie and token carried by r.
+func (cs *csrf) validate(r *http.Request) error {
+	realToken, sessionErr := cs.st.Get(r)
+	if sessionErr == nil && len(realToken) != tokenLength {
+		realToken = nil
+	}
+
+	// Limit how much of the body is read in search of a token.
+	r = contextSave(r, bodyLimitKey, cs.opts.MaxBodyBytes)
+
+	issued, err := cs.requestToken(r)
+	if err != nil {
+		return err
+	}
+
+	// A token issued against an expired session token can never match the
+	// new one.
+	if sessionErr == ErrTokenExpired {
+		return ErrTokenExpired
+	}
+
+	if realToken == nil {
+		return mismatchReason(sessionErr)
+	}
+
+	realToken, err = cs.bindToken(r, realToken)
+	if err != nil {
+		return err
+	}
+
+	if ok, _ := cs.matchToken(r, realToken, unmask(issued)); !ok {
+		return mismatchReason(sessionErr)
+	}
+
+	return nil
+}
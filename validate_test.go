@@ -0,0 +1,63 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestValidate checks that tokens issued by the middleware can be validated
+// outside it.
+func TestValidate(t *testing.T) {
+	var issued string
+	p := Protect(testKey, FieldName("authenticity_token"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issued = Token(r)
+	}))
+
+	// issue returns a CSRF cookie and a token issued against it.
+	issue := func() (string, string) {
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil))
+
+		c := rr.Result().Cookies()[0]
+		return c.Name + "=" + c.Value, issued
+	}
+
+	cookie, token := issue()
+	_, otherToken := issue()
+
+	var validateTests = []struct {
+		name   string
+		cookie string
+		header string
+		form   string
+		key    []byte
+		err    error
+	}{
+		{"header", cookie, token, "", testKey, nil},
+		{"form field", cookie, "", token, testKey, nil},
+		{"no token", cookie, "", "", testKey, ErrNoToken},
+		{"no cookie", "", token, "", testKey, ErrNoCookie},
+		{"other token", cookie, otherToken, "", testKey, ErrBadToken},
+		{"undecodable token", cookie, "not-base64!", "", testKey, ErrBadToken},
+		{"other key", cookie, token, "", []byte("different-32-byte-long-auth-key!"), ErrCookieDecode},
+	}
+
+	for _, vt := range validateTests {
+		body := url.Values{"authenticity_token": {vt.form}}.Encode()
+		r := httptest.NewRequest("POST", "http://www.gorillatoolkit.org/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if vt.cookie != "" {
+			r.Header.Set("Cookie", vt.cookie)
+		}
+		if vt.header != "" {
+			r.Header.Set("X-CSRF-Token", vt.header)
+		}
+
+		if err := Validate(r, vt.key, FieldName("authenticity_token")); err != vt.err {
+			t.Errorf("%s: got %v want %v", vt.name, err, vt.err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package csrf
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// isWebSocket reports whether r is a WebSocket handshake (RFC 6455).
+func isWebSocket(r *http.Request) bool {
+	if r.Method != "GET" || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+
+	for _, v := range r.Header["Connection"] {
+		for _, option := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(option), "upgrade") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkWebSocket checks the Origin of a WebSocket handshake and, if
+// ProtectWebSockets requires it, its token. It returns the reason the
+// handshake must be rejected, if it must.
+func (cs *csrf) checkWebSocket(r *http.Request, realToken []byte, sessionErr error) error {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		// An opaque ("null") origin can't be the site's own.
+		u, err := url.Parse(origin)
+		if err != nil || origin == "null" || !cs.allowedOrigin(r, cs.origin(r), u) {
+			return ErrBadOrigin
+		}
+	}
+
+	if !cs.opts.WebSocketToken {
+		return nil
+	}
+
+	token := r.Header.Get(cs.opts.RequestHeader)
+	if token == "" {
+		token = r.URL.Query().Get(cs.opts.FieldName)
+	}
+
+	return cs.verifyToken(token, realToken, sessionErr)
+}
@@ -0,0 +1,67 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestProtectWebSockets checks the Origin and token checks on WebSocket
+// handshakes.
+func TestProtectWebSockets(t *testing.T) {
+	var token string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})
+
+	s := httptest.NewRecorder()
+	Protect(testKey)(handler).ServeHTTP(s, httptest.NewRequest("GET", "http://www.gorillatoolkit.org/", nil))
+	cookie := s.Header().Get("Set-Cookie")
+
+	var wsTests = []struct {
+		name     string
+		opts     []Option
+		origin   string
+		query    string
+		upgrade  bool
+		expected int
+	}{
+		{"not protected", nil, "http://evil.example.com", "", true, http.StatusOK},
+		{"same origin", []Option{ProtectWebSockets(false)}, "http://www.gorillatoolkit.org", "", true,
+			http.StatusOK},
+		{"cross origin", []Option{ProtectWebSockets(false)}, "http://evil.example.com", "", true,
+			http.StatusForbidden},
+		{"opaque origin", []Option{ProtectWebSockets(false)}, "null", "", true,
+			http.StatusForbidden},
+		{"trusted origin", []Option{ProtectWebSockets(false),
+			TrustedOrigins([]string{"app.example.com"})}, "http://app.example.com", "", true,
+			http.StatusOK},
+		{"no origin", []Option{ProtectWebSockets(false)}, "", "", true, http.StatusOK},
+		{"plain GET", []Option{ProtectWebSockets(false)}, "http://evil.example.com", "", false,
+			http.StatusOK},
+		{"token required", []Option{ProtectWebSockets(true)}, "http://www.gorillatoolkit.org", "",
+			true, http.StatusForbidden},
+		{"token in query", []Option{ProtectWebSockets(true)}, "http://www.gorillatoolkit.org",
+			"?" + url.Values{fieldName: {token}}.Encode(), true, http.StatusOK},
+	}
+
+	for _, wt := range wsTests {
+		r := httptest.NewRequest("GET", "http://www.gorillatoolkit.org/ws"+wt.query, nil)
+		r.Header.Set("Cookie", cookie)
+		if wt.origin != "" {
+			r.Header.Set("Origin", wt.origin)
+		}
+		if wt.upgrade {
+			r.Header.Set("Connection", "keep-alive, Upgrade")
+			r.Header.Set("Upgrade", "websocket")
+		}
+
+		rr := httptest.NewRecorder()
+		Protect(testKey, wt.opts...)(handler).ServeHTTP(rr, r)
+
+		if rr.Code != wt.expected {
+			t.Errorf("%s: wrong status code: got %v want %v", wt.name, rr.Code, wt.expected)
+		}
+	}
+}
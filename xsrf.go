@@ -0,0 +1,35 @@
+package csrf
+
+import (
+	"net/http"
+)
+
+const (
+	// defaultXSRFCookie and defaultXSRFHeader are the names used by Angular
+	// and Axios for the script-readable token cookie and the header it is
+	// echoed in.
+	defaultXSRFCookie = "XSRF-TOKEN"
+	defaultXSRFHeader = "X-XSRF-TOKEN"
+)
+
+// setXSRFCookie issues the request's masked token in the script-readable
+// XSRF cookie.
+func (cs *csrf) setXSRFCookie(w http.ResponseWriter, r *http.Request) {
+	token := Token(r)
+	if token == "" {
+		return
+	}
+
+	path := cs.opts.Path
+	if path == "" {
+		path = "/"
+	}
+
+	writeCookie(w, r, &http.Cookie{
+		Name:   cs.opts.XSRFCookie,
+		Value:  token,
+		Path:   path,
+		Domain: cs.opts.Domain,
+		Secure: cs.opts.Secure && !isDevelopment(r),
+	}, cs.opts.SameSite)
+}
@@ -0,0 +1,54 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests that the token is issued in a script-readable cookie and accepted in
+// the matching header.
+func TestXSRFCookie(t *testing.T) {
+	s := http.NewServeMux()
+	s.HandleFunc("/", testHandler)
+	p := Protect(testKey, XSRFCookie("", ""))(s)
+
+	r, err := http.NewRequest("GET", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	var cookies, token string
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == "XSRF-TOKEN" {
+			token = c.Value
+			if c.HttpOnly || c.Path != "/" {
+				t.Fatalf("XSRF cookie not readable by scripts: %+v", c)
+			}
+		}
+		cookies += c.Name + "=" + c.Value + "; "
+	}
+
+	if token == "" {
+		t.Fatalf("no XSRF cookie issued: %q", rr.Header()["Set-Cookie"])
+	}
+
+	r, err = http.NewRequest("POST", "http://www.gorillatoolkit.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Cookie", strings.TrimSuffix(cookies, "; "))
+	r.Header.Set("X-XSRF-TOKEN", token)
+
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("token from the XSRF cookie was rejected: got %v want %v",
+			rr.Code, http.StatusOK)
+	}
+}